@@ -4,7 +4,6 @@ import (
 	"bytes"
 	"context"
 	"encoding/json"
-	"errors"
 	"fmt"
 	"io"
 	"net/http"
@@ -22,6 +21,13 @@ func EnableDebug(api *Api) {
 	api.debug = true
 }
 
+// WithHTTPClient replace the default client, it needs a cookie jar to keep the session
+func WithHTTPClient(hc *http.Client) Option {
+	return func(api *Api) {
+		api.hc = hc
+	}
+}
+
 type Api struct {
 	hc                *http.Client
 	address           string
@@ -41,6 +47,20 @@ type service struct {
 	api *Api
 }
 
+// StatusError is returned when qBittorrent answers with a non 200 status code
+type StatusError struct {
+	StatusCode int
+	Body       string
+}
+
+// Error return the body, qBittorrent answers some statuses like 404 and 409 with an empty body
+func (e *StatusError) Error() string {
+	if strings.TrimSpace(e.Body) == "" {
+		return fmt.Sprintf("status %d", e.StatusCode)
+	}
+	return e.Body
+}
+
 func NewApi(address string, options ...Option) (api *Api, err error) {
 	api = &Api{}
 	address = strings.TrimSuffix(address, "/")
@@ -130,7 +150,7 @@ func (a *Api) makeRequest(req *http.Request, v any) (err error) {
 			err = err1
 			return
 		}
-		err = errors.New(string(content))
+		err = &StatusError{StatusCode: resp.StatusCode, Body: string(content)}
 		return
 	}
 
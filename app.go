@@ -90,6 +90,8 @@ type MaxRatioAct int
 
 const PauseTorrent MaxRatioAct = 0
 const RemoveTorrent MaxRatioAct = 1
+const EnableSuperSeeding MaxRatioAct = 2
+const RemoveTorrentAndFiles MaxRatioAct = 3
 
 type BittorrentProtocol int
 
@@ -271,6 +273,8 @@ func (a *App) Preferences(ctx context.Context) (preferences *Preferences, err er
 	return
 }
 
+// SetPreferences send every field of pref, zero values overwrite server settings,
+// use UpdatePreferences or SetPreferenceValues to change only some keys
 func (a *App) SetPreferences(ctx context.Context, pref Preferences) (respText string, err error) {
 	path := "/api/v2/app/setPreferences"
 
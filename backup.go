@@ -0,0 +1,542 @@
+package qbt_api
+
+import (
+	"archive/tar"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"io"
+	"net/http"
+	"os"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+	"time"
+)
+
+const BackupVersion = 1
+
+const backupManifestName = "manifest.json"
+const backupPreferencesName = "preferences.json"
+const backupRssName = "rss.json"
+const backupTorrentsDir = "torrents/"
+
+// BackupManifest describe the content of a backup archive
+type BackupManifest struct {
+	Version    int              `json:"version"`
+	CreatedAt  time.Time        `json:"createdAt"`
+	AppVersion string           `json:"appVersion"`
+	Categories CategoryResponse `json:"categories"`
+	Tags       []string         `json:"tags"`
+	Torrents   []TorrentBackup  `json:"torrents"`
+	// Skipped list torrents the server refused to export, such as magnets still without metadata
+	Skipped []SkippedTorrent `json:"skipped,omitempty"`
+}
+
+type SkippedTorrent struct {
+	Hash  string `json:"hash"`
+	Name  string `json:"name"`
+	Error string `json:"error"`
+}
+
+// TorrentBackup hold everything needed to re-add a torrent the way it was
+type TorrentBackup struct {
+	Hash               string                          `json:"hash"`
+	Name               string                          `json:"name"`
+	File               string                          `json:"file"`
+	Category           string                          `json:"category"`
+	Tags               []string                        `json:"tags"`
+	SavePath           string                          `json:"savePath"`
+	AutoTMM            bool                            `json:"autoTMM"`
+	Paused             bool                            `json:"paused"`
+	RatioLimit         float64                         `json:"ratioLimit"`
+	SeedingTimeLimit   int64                           `json:"seedingTimeLimit"`
+	DlLimit            int64                           `json:"dlLimit"`
+	UpLimit            int64                           `json:"upLimit"`
+	SequentialDownload bool                            `json:"sequentialDownload"`
+	FirstLastPiecePrio bool                            `json:"firstLastPiecePrio"`
+	FilePriorities     []TorrentManagementFilePriority `json:"filePriorities"`
+}
+
+// Backup is an archive read back into memory
+type Backup struct {
+	Manifest    *BackupManifest
+	Preferences *Preferences
+	Rss         *RssConfig
+	// TorrentFiles map TorrentBackup.File to .torrent content
+	TorrentFiles map[string][]byte
+}
+
+type BackupOptions struct {
+	// Hashes limit the torrents backed up, empty means all torrents
+	Hashes          []string
+	SkipPreferences bool
+	SkipRss         bool
+}
+
+// SplitTags split the comma separated tags field of torrent info
+func SplitTags(tags string) (list []string) {
+	for _, it := range strings.Split(tags, ",") {
+		it = strings.TrimSpace(it)
+		if it != "" {
+			list = append(list, it)
+		}
+	}
+	return
+}
+
+func isPausedState(state TorrentManagementInfoState) bool {
+	return state == InfoStatePausedDL || state == InfoStatePausedUP
+}
+
+func newTorrentBackup(info *TorrentManagementInfo, files []*TorrentManagementFile) TorrentBackup {
+	backup := TorrentBackup{
+		Hash:               info.Hash,
+		Name:               info.Name,
+		File:               backupTorrentsDir + info.Hash + ".torrent",
+		Category:           info.Category,
+		Tags:               SplitTags(info.Tags),
+		SavePath:           info.SavePath,
+		AutoTMM:            info.AutoTmm,
+		Paused:             isPausedState(info.State),
+		RatioLimit:         info.RatioLimit,
+		SeedingTimeLimit:   int64(info.SeedingTimeLimit),
+		DlLimit:            int64(info.DlLimit),
+		UpLimit:            int64(info.UpLimit),
+		SequentialDownload: info.SeqDl,
+		FirstLastPiecePrio: info.FLPiecePrio,
+	}
+	backup.FilePriorities = make([]TorrentManagementFilePriority, len(files))
+	for i, it := range files {
+		index := it.Index
+		if index < 0 || index >= len(files) {
+			index = i
+		}
+		backup.FilePriorities[index] = it.Priority
+	}
+	return backup
+}
+
+// Backup write torrents with their metadata, categories, tags, preferences and rss configuration to a tar archive
+func (a *Api) Backup(ctx context.Context, w io.Writer, opts BackupOptions) (manifest *BackupManifest, err error) {
+	manifest = &BackupManifest{Version: BackupVersion, CreatedAt: time.Now().UTC()}
+
+	manifest.AppVersion, err = a.App.Version(ctx)
+	if err != nil {
+		return
+	}
+	manifest.Categories, err = a.TorrentManagement.Categories(ctx)
+	if err != nil {
+		return
+	}
+	manifest.Tags, err = a.TorrentManagement.Tags(ctx)
+	if err != nil {
+		return
+	}
+
+	infoList, err := a.TorrentManagement.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll, Hashes: opts.Hashes})
+	if err != nil {
+		return
+	}
+
+	tw := tar.NewWriter(w)
+	for _, info := range infoList {
+		var files []*TorrentManagementFile
+		var content []byte
+		files, err = a.TorrentManagement.Files(ctx, info.Hash, nil)
+		if err == nil {
+			content, err = a.TorrentManagement.Export(ctx, info.Hash)
+		}
+		// the server refusing this torrent only, 404 when it is gone or 409 for a magnet without metadata,
+		// skip it and keep the rest of the backup. Other statuses such as an expired session fail the backup
+		var statusErr *StatusError
+		if errors.As(err, &statusErr) && (statusErr.StatusCode == http.StatusNotFound || statusErr.StatusCode == http.StatusConflict) {
+			manifest.Skipped = append(manifest.Skipped, SkippedTorrent{Hash: info.Hash, Name: info.Name, Error: err.Error()})
+			err = nil
+			continue
+		}
+		if err != nil {
+			err = fmt.Errorf("export %s: %w", info.Name, err)
+			return
+		}
+
+		backup := newTorrentBackup(info, files)
+		err = writeTarFile(tw, backup.File, content, manifest.CreatedAt)
+		if err != nil {
+			return
+		}
+		manifest.Torrents = append(manifest.Torrents, backup)
+	}
+
+	if !opts.SkipPreferences {
+		var pref *Preferences
+		pref, err = a.App.Preferences(ctx)
+		if err != nil {
+			return
+		}
+		err = writeTarJSON(tw, backupPreferencesName, pref, manifest.CreatedAt)
+		if err != nil {
+			return
+		}
+	}
+
+	if !opts.SkipRss {
+		var cfg *RssConfig
+		cfg, err = a.Rss.Export(ctx, RssExportOptions{IncludeState: true})
+		if err != nil {
+			return
+		}
+		err = writeTarJSON(tw, backupRssName, cfg, manifest.CreatedAt)
+		if err != nil {
+			return
+		}
+	}
+
+	err = writeTarJSON(tw, backupManifestName, manifest, manifest.CreatedAt)
+	if err != nil {
+		return
+	}
+	err = tw.Close()
+	return
+}
+
+func writeTarFile(tw *tar.Writer, name string, content []byte, modTime time.Time) (err error) {
+	err = tw.WriteHeader(&tar.Header{
+		Name:    name,
+		Mode:    0o644,
+		Size:    int64(len(content)),
+		ModTime: modTime,
+	})
+	if err != nil {
+		return
+	}
+	_, err = tw.Write(content)
+	return
+}
+
+func writeTarJSON(tw *tar.Writer, name string, v any, modTime time.Time) (err error) {
+	content, err := json.MarshalIndent(v, "", "  ")
+	if err != nil {
+		return
+	}
+	return writeTarFile(tw, name, content, modTime)
+}
+
+// ReadBackup load an archive written by Api.Backup
+func ReadBackup(r io.Reader) (backup *Backup, err error) {
+	backup = &Backup{TorrentFiles: map[string][]byte{}}
+	tr := tar.NewReader(r)
+	for {
+		var header *tar.Header
+		header, err = tr.Next()
+		if errors.Is(err, io.EOF) {
+			err = nil
+			break
+		}
+		if err != nil {
+			return
+		}
+
+		var content []byte
+		content, err = io.ReadAll(tr)
+		if err != nil {
+			return
+		}
+		switch {
+		case header.Name == backupManifestName:
+			backup.Manifest = &BackupManifest{}
+			err = json.Unmarshal(content, backup.Manifest)
+		case header.Name == backupPreferencesName:
+			backup.Preferences = &Preferences{}
+			err = json.Unmarshal(content, backup.Preferences)
+		case header.Name == backupRssName:
+			backup.Rss = &RssConfig{}
+			err = json.Unmarshal(content, backup.Rss)
+		case strings.HasPrefix(header.Name, backupTorrentsDir):
+			backup.TorrentFiles[header.Name] = content
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", header.Name, err)
+			return
+		}
+	}
+
+	if backup.Manifest == nil {
+		err = errors.New("backup has no manifest")
+		return
+	}
+	if backup.Manifest.Version > BackupVersion {
+		err = fmt.Errorf("backup version %d is newer than supported version %d", backup.Manifest.Version, BackupVersion)
+	}
+	return
+}
+
+type RestoreOptions struct {
+	// SkipChecking add torrents without hash checking their data
+	SkipChecking    bool
+	SkipPreferences bool
+	SkipRss         bool
+	// Timeout wait for each added torrent to show up before file priorities are set, default 30 seconds
+	Timeout time.Duration
+}
+
+type RestoreMismatch struct {
+	Hash     string
+	Name     string
+	Field    string
+	Expected any
+	Actual   any
+}
+
+func (rm RestoreMismatch) String() string {
+	return fmt.Sprintf("%s %s: expected %v, got %v", rm.Name, rm.Field, rm.Expected, rm.Actual)
+}
+
+type RestoreReport struct {
+	Added []string
+	// Existing torrents are not added again but still checked for mismatches
+	Existing   []string
+	Failed     map[string]error
+	Mismatches []RestoreMismatch
+}
+
+// Restore re-add categories, tags, preferences, rss configuration and torrents of a backup archive
+// and report every torrent whose state differs from the backup afterwards
+func (a *Api) Restore(ctx context.Context, r io.Reader, opts RestoreOptions) (report *RestoreReport, err error) {
+	backup, err := ReadBackup(r)
+	if err != nil {
+		return
+	}
+	if opts.Timeout <= 0 {
+		opts.Timeout = 30 * time.Second
+	}
+	report = &RestoreReport{Failed: map[string]error{}}
+
+	err = a.restoreInstance(ctx, backup, opts)
+	if err != nil {
+		return
+	}
+
+	current, err := a.torrentsByHash(ctx, nil)
+	if err != nil {
+		return
+	}
+
+	tmpDir, err := os.MkdirTemp("", "qbt-restore-")
+	if err != nil {
+		return
+	}
+	defer os.RemoveAll(tmpDir)
+
+	for _, it := range backup.Manifest.Torrents {
+		if _, ok := current[it.Hash]; ok {
+			report.Existing = append(report.Existing, it.Hash)
+			continue
+		}
+		addErr := a.restoreTorrent(ctx, backup, it, tmpDir, opts)
+		if addErr != nil {
+			report.Failed[it.Hash] = addErr
+			continue
+		}
+		report.Added = append(report.Added, it.Hash)
+	}
+
+	report.Mismatches, err = a.VerifyBackup(ctx, backup.Manifest)
+	return
+}
+
+func (a *Api) restoreInstance(ctx context.Context, backup *Backup, opts RestoreOptions) (err error) {
+	plan := &InstancePlan{}
+	categories, err := a.TorrentManagement.Categories(ctx)
+	if err != nil {
+		return
+	}
+	desired := map[string]CategoryConfig{}
+	for name, it := range backup.Manifest.Categories {
+		desired[name] = CategoryConfig{SavePath: it.SavePath}
+	}
+	planCategories(plan, categories, desired, false)
+
+	tags, err := a.TorrentManagement.Tags(ctx)
+	if err != nil {
+		return
+	}
+	plan.CreateTags, _ = planTags(tags, backup.Manifest.Tags, false)
+
+	if !opts.SkipRss && backup.Rss != nil {
+		var tree *RssTree
+		tree, err = a.Rss.Items(ctx, false)
+		if err != nil {
+			return
+		}
+		var rules RulesResponse
+		rules, err = a.Rss.Rules(ctx)
+		if err != nil {
+			return
+		}
+		plan.Rss = PlanRssImport(tree, rules, backup.Rss, false)
+	}
+
+	err = a.ApplyInstancePlan(ctx, plan)
+	if err != nil {
+		return
+	}
+
+	if !opts.SkipPreferences && backup.Preferences != nil {
+		var pref *Preferences
+		pref, err = a.App.Preferences(ctx)
+		if err != nil {
+			return
+		}
+		_, err = a.App.ApplyPreferences(ctx, pref, backup.Preferences, PreferencesUpdateOptions{})
+	}
+	return
+}
+
+func (a *Api) torrentsByHash(ctx context.Context, hashes []string) (torrents map[string]*TorrentManagementInfo, err error) {
+	infoList, err := a.TorrentManagement.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll, Hashes: hashes})
+	if err != nil {
+		return
+	}
+	torrents = make(map[string]*TorrentManagementInfo, len(infoList))
+	for _, it := range infoList {
+		torrents[it.Hash] = it
+	}
+	return
+}
+
+func (a *Api) restoreTorrent(ctx context.Context, backup *Backup, it TorrentBackup, tmpDir string, opts RestoreOptions) (err error) {
+	content, ok := backup.TorrentFiles[it.File]
+	if !ok {
+		return fmt.Errorf("%s is missing from backup", it.File)
+	}
+	file := filepath.Join(tmpDir, it.Hash+".torrent")
+	err = os.WriteFile(file, content, 0o600)
+	if err != nil {
+		return
+	}
+
+	addOpts := TorrentManagementAddOptions{
+		Torrents:           []string{file},
+		Tags:               it.Tags,
+		SkipChecking:       opts.SkipChecking,
+		Paused:             it.Paused,
+		RatioLimit:         &it.RatioLimit,
+		SeedingTimeLimit:   &it.SeedingTimeLimit,
+		AutoTMM:            it.AutoTMM,
+		SequentialDownload: it.SequentialDownload,
+		FirstLastPiecePrio: it.FirstLastPiecePrio,
+	}
+	if it.Category != "" {
+		addOpts.Category = &it.Category
+	}
+	if !it.AutoTMM {
+		addOpts.SavePath = &it.SavePath
+	}
+	if it.DlLimit > 0 {
+		addOpts.DLLimit = &it.DlLimit
+	}
+	if it.UpLimit > 0 {
+		addOpts.UPLimit = &it.UpLimit
+	}
+
+	err = a.TorrentManagement.Add(ctx, addOpts)
+	if err != nil {
+		return
+	}
+
+	files, err := a.waitForFiles(ctx, it.Hash, opts.Timeout)
+	if err != nil {
+		return
+	}
+	priorities := map[int]TorrentManagementFilePriority{}
+	for _, f := range files {
+		if f.Index < len(it.FilePriorities) && f.Priority != it.FilePriorities[f.Index] {
+			priorities[f.Index] = it.FilePriorities[f.Index]
+		}
+	}
+	return a.TorrentManagement.SetFilePriorities(ctx, it.Hash, priorities)
+}
+
+// waitForFiles poll until the torrent is known to the server and its file list is available
+func (a *Api) waitForFiles(ctx context.Context, hash string, timeout time.Duration) (files []*TorrentManagementFile, err error) {
+	ctx, cancel := context.WithTimeout(ctx, timeout)
+	defer cancel()
+
+	ticker := time.NewTicker(500 * time.Millisecond)
+	defer ticker.Stop()
+	for {
+		files, err = a.TorrentManagement.Files(ctx, hash, nil)
+		if err == nil && len(files) > 0 {
+			return
+		}
+		var se *StatusError
+		if err != nil && !(errors.As(err, &se) && se.StatusCode == 404) {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			err = fmt.Errorf("torrent %s did not show up: %w", hash, ctx.Err())
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// VerifyBackup compare torrents on the server with the manifest, missing torrents are reported too
+func (a *Api) VerifyBackup(ctx context.Context, manifest *BackupManifest) (mismatches []RestoreMismatch, err error) {
+	var hashes []string
+	for _, it := range manifest.Torrents {
+		hashes = append(hashes, it.Hash)
+	}
+	if len(hashes) == 0 {
+		return
+	}
+	current, err := a.torrentsByHash(ctx, hashes)
+	if err != nil {
+		return
+	}
+
+	for _, expected := range manifest.Torrents {
+		info, ok := current[expected.Hash]
+		if !ok {
+			mismatches = append(mismatches, RestoreMismatch{Hash: expected.Hash, Name: expected.Name, Field: "torrent", Expected: "present", Actual: "missing"})
+			continue
+		}
+		var files []*TorrentManagementFile
+		files, err = a.TorrentManagement.Files(ctx, info.Hash, nil)
+		if err != nil {
+			return
+		}
+		mismatches = append(mismatches, compareTorrentBackup(expected, newTorrentBackup(info, files))...)
+	}
+	return
+}
+
+func compareTorrentBackup(expected, actual TorrentBackup) (mismatches []RestoreMismatch) {
+	add := func(field string, e, a any) {
+		if !reflect.DeepEqual(e, a) {
+			mismatches = append(mismatches, RestoreMismatch{Hash: expected.Hash, Name: expected.Name, Field: field, Expected: e, Actual: a})
+		}
+	}
+	sortedTags := func(tags []string) []string {
+		tags = append([]string{}, tags...)
+		sort.Strings(tags)
+		return tags
+	}
+
+	add("category", expected.Category, actual.Category)
+	add("tags", sortedTags(expected.Tags), sortedTags(actual.Tags))
+	add("savePath", filepath.Clean(expected.SavePath), filepath.Clean(actual.SavePath))
+	add("ratioLimit", expected.RatioLimit, actual.RatioLimit)
+	add("seedingTimeLimit", expected.SeedingTimeLimit, actual.SeedingTimeLimit)
+	add("dlLimit", expected.DlLimit, actual.DlLimit)
+	add("upLimit", expected.UpLimit, actual.UpLimit)
+	add("sequentialDownload", expected.SequentialDownload, actual.SequentialDownload)
+	add("firstLastPiecePrio", expected.FirstLastPiecePrio, actual.FirstLastPiecePrio)
+	add("filePriorities", expected.FilePriorities, actual.FilePriorities)
+	return
+}
@@ -0,0 +1,261 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/davecgh/go-spew/spew"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strconv"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeInstance keep just enough state for a backup and restore round trip
+type fakeInstance struct {
+	mu         sync.Mutex
+	torrents   map[string]*TorrentManagementInfo
+	files      map[string][]*TorrentManagementFile
+	content    map[string][]byte
+	categories CategoryResponse
+	tags       []string
+	// exportStatus is the status of every export when set
+	exportStatus int
+}
+
+func newFakeInstance() *fakeInstance {
+	return &fakeInstance{
+		torrents:   map[string]*TorrentManagementInfo{},
+		files:      map[string][]*TorrentManagementFile{},
+		content:    map[string][]byte{},
+		categories: CategoryResponse{},
+	}
+}
+
+func (fi *fakeInstance) ServeHTTP(w http.ResponseWriter, r *http.Request) {
+	fi.mu.Lock()
+	defer fi.mu.Unlock()
+
+	if strings.HasPrefix(r.Header.Get("Content-Type"), "multipart/") {
+		r.ParseMultipartForm(1 << 20)
+	} else {
+		r.ParseForm()
+	}
+	hash := r.Form.Get("hash")
+	switch r.URL.Path {
+	case "/api/v2/app/version":
+		w.Write([]byte("v4.6.0"))
+	case "/api/v2/app/preferences":
+		json.NewEncoder(w).Encode(Preferences{ListenPort: 6881, WebUIPort: 8080, ProxyType: ProxyDisabled, MaxRatio: -1})
+	case "/api/v2/rss/items", "/api/v2/rss/rules":
+		w.Write([]byte(`{}`))
+	case "/api/v2/torrents/categories":
+		json.NewEncoder(w).Encode(fi.categories)
+	case "/api/v2/torrents/createCategory":
+		fi.categories[r.Form.Get("category")] = Category{Name: r.Form.Get("category"), SavePath: r.Form.Get("savePath")}
+	case "/api/v2/torrents/tags":
+		json.NewEncoder(w).Encode(fi.tags)
+	case "/api/v2/torrents/createTags":
+		fi.tags = append(fi.tags, strings.Split(r.Form.Get("tags"), ",")...)
+	case "/api/v2/torrents/info":
+		var list []*TorrentManagementInfo
+		for h, it := range fi.torrents {
+			if hashes := r.Form.Get("hashes"); hashes == "" || strings.Contains(hashes, h) {
+				list = append(list, it)
+			}
+		}
+		json.NewEncoder(w).Encode(list)
+	case "/api/v2/torrents/files":
+		files, ok := fi.files[hash]
+		if !ok {
+			http.Error(w, "Not Found", http.StatusNotFound)
+			return
+		}
+		json.NewEncoder(w).Encode(files)
+	case "/api/v2/torrents/export":
+		if fi.exportStatus != 0 {
+			http.Error(w, "", fi.exportStatus)
+			return
+		}
+		content, ok := fi.content[hash]
+		if !ok {
+			http.Error(w, "Conflict", http.StatusConflict)
+			return
+		}
+		w.Write(content)
+	case "/api/v2/torrents/filePrio":
+		priority, _ := strconv.Atoi(r.Form.Get("priority"))
+		for _, id := range strings.Split(r.Form.Get("id"), "|") {
+			index, _ := strconv.Atoi(id)
+			fi.files[hash][index].Priority = TorrentManagementFilePriority(priority)
+		}
+	case "/api/v2/torrents/add":
+		for _, header := range r.MultipartForm.File["torrents"] {
+			f, _ := header.Open()
+			content, _ := io.ReadAll(f)
+			f.Close()
+			h := strings.TrimSuffix(header.Filename, ".torrent")
+			ratioLimit, _ := strconv.ParseFloat(r.Form.Get("ratioLimit"), 64)
+			seedingTimeLimit, _ := strconv.Atoi(r.Form.Get("seedingTimeLimit"))
+			upLimit, _ := strconv.Atoi(r.Form.Get("upLimit"))
+			fi.add(&TorrentManagementInfo{
+				Hash:             h,
+				Name:             h,
+				Category:         r.Form.Get("category"),
+				Tags:             strings.Join(strings.Split(r.Form.Get("tags"), "|"), ", "),
+				SavePath:         r.Form.Get("savepath"),
+				RatioLimit:       ratioLimit,
+				SeedingTimeLimit: seedingTimeLimit,
+				UpLimit:          upLimit,
+				SeqDl:            r.Form.Get("sequentialDownload") == "true",
+				State:            InfoStateStalledUP,
+			}, content)
+		}
+	default:
+		http.Error(w, "unexpected "+r.URL.Path, http.StatusBadRequest)
+	}
+}
+
+func (fi *fakeInstance) add(info *TorrentManagementInfo, content []byte) {
+	fi.torrents[info.Hash] = info
+	fi.content[info.Hash] = content
+	fi.files[info.Hash] = []*TorrentManagementFile{
+		{Index: 0, Name: "a.mkv", Priority: FilePriorityNormal},
+		{Index: 1, Name: "b.nfo", Priority: FilePriorityNormal},
+	}
+}
+
+func TestApi_BackupRestore(t *testing.T) {
+	source := newFakeInstance()
+	source.categories["movies"] = Category{Name: "movies", SavePath: "/data/movies"}
+	source.tags = []string{"keep", "hd"}
+	source.add(&TorrentManagementInfo{
+		Hash:             "aaaa",
+		Name:             "movie",
+		Category:         "movies",
+		Tags:             "hd, keep",
+		SavePath:         "/data/movies",
+		RatioLimit:       1.5,
+		SeedingTimeLimit: 600,
+		UpLimit:          1024,
+		SeqDl:            true,
+		State:            InfoStatePausedUP,
+	}, []byte("d4:infod4:name5:movieee"))
+	source.files["aaaa"][1].Priority = FilePriorityNotDownloaded
+	// a magnet still waiting for metadata cannot be exported
+	source.torrents["bbbb"] = &TorrentManagementInfo{Hash: "bbbb", Name: "magnet", State: InfoStateMetaDL}
+	source.files["bbbb"] = []*TorrentManagementFile{}
+
+	srv := httptest.NewServer(source)
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	archive := &bytes.Buffer{}
+	manifest, err := client.Backup(context.Background(), archive, BackupOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(manifest.Torrents) != 1 || !manifest.Torrents[0].Paused || manifest.AppVersion != "v4.6.0" {
+		t.Fatalf("unexpected manifest %+v", manifest)
+	}
+	if len(manifest.Skipped) != 1 || manifest.Skipped[0].Hash != "bbbb" {
+		t.Fatalf("unexpected skipped %+v", manifest.Skipped)
+	}
+
+	backup, err := ReadBackup(bytes.NewReader(archive.Bytes()))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if backup.Preferences == nil || backup.Rss == nil || len(backup.TorrentFiles) != 1 {
+		t.Fatalf("incomplete backup %+v", backup)
+	}
+
+	target := newFakeInstance()
+	targetSrv := httptest.NewServer(target)
+	defer targetSrv.Close()
+	targetClient, err := NewApi(targetSrv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	report, err := targetClient.Restore(context.Background(), bytes.NewReader(archive.Bytes()), RestoreOptions{SkipPreferences: true, SkipRss: true, Timeout: time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 1 || len(report.Failed) != 0 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+	if target.categories["movies"].SavePath != "/data/movies" {
+		t.Fatalf("category not restored %+v", target.categories)
+	}
+	sort.Strings(target.tags)
+	if strings.Join(target.tags, ",") != "hd,keep" {
+		t.Fatalf("tags not restored %v", target.tags)
+	}
+	if !bytes.Equal(target.content["aaaa"], source.content["aaaa"]) {
+		t.Fatal("torrent content differ")
+	}
+	if target.files["aaaa"][1].Priority != FilePriorityNotDownloaded {
+		t.Fatal("file priority not restored")
+	}
+	// the fake does not keep first/last piece priority or pause state, everything else must match
+	if len(report.Mismatches) != 0 {
+		t.Fatalf("unexpected mismatches %v", report.Mismatches)
+	}
+
+	// a second restore find the torrent already there
+	report, err = targetClient.Restore(context.Background(), bytes.NewReader(archive.Bytes()), RestoreOptions{SkipPreferences: true, SkipRss: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Added) != 0 || len(report.Existing) != 1 {
+		t.Fatalf("unexpected report %+v", report)
+	}
+}
+
+func TestApi_BackupStatus(t *testing.T) {
+	source := newFakeInstance()
+	source.add(&TorrentManagementInfo{Hash: "aaaa", Name: "movie"}, []byte("d4:infod4:name5:movieee"))
+	srv := httptest.NewServer(source)
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// an expired session or a server error fail the backup instead of skipping every torrent
+	for _, status := range []int{http.StatusForbidden, http.StatusInternalServerError} {
+		source.exportStatus = status
+		_, err = client.Backup(context.Background(), io.Discard, BackupOptions{})
+		if err == nil || !strings.Contains(err.Error(), strconv.Itoa(status)) {
+			t.Fatalf("status %d: unexpected error %v", status, err)
+		}
+	}
+}
+
+func TestCompareTorrentBackup(t *testing.T) {
+	expected := TorrentBackup{Hash: "aaaa", Name: "movie", Tags: []string{"b", "a"}, SavePath: "/data/", RatioLimit: 2}
+	actual := TorrentBackup{Hash: "aaaa", Name: "movie", Tags: []string{"a", "b"}, SavePath: "/data", RatioLimit: -2}
+	mismatches := compareTorrentBackup(expected, actual)
+	if len(mismatches) != 1 || mismatches[0].Field != "ratioLimit" {
+		t.Fatalf("unexpected mismatches %v", mismatches)
+	}
+}
+
+func TestApi_Backup(t *testing.T) {
+	archive := &bytes.Buffer{}
+	manifest, err := api.Backup(context.Background(), archive, BackupOptions{})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(manifest, archive.Len())
+}
@@ -0,0 +1,135 @@
+package main
+
+import (
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"net/http"
+	"net/url"
+	"os"
+	"path/filepath"
+)
+
+// Config is the content of the config file, every profile describe a server
+type Config struct {
+	Default  string             `yaml:"default"`
+	Profiles map[string]Profile `yaml:"profiles"`
+}
+
+type Profile struct {
+	URL      string `yaml:"url"`
+	Username string `yaml:"username"`
+	Password string `yaml:"password"`
+}
+
+func configDir() string {
+	dir, err := os.UserConfigDir()
+	if err != nil {
+		dir = "."
+	}
+	return filepath.Join(dir, "qbt")
+}
+
+func defaultConfigPath() string {
+	return filepath.Join(configDir(), "config.yaml")
+}
+
+// loadConfig read path, a missing file give an empty config
+func loadConfig(path string) (cfg *Config, err error) {
+	cfg = &Config{Profiles: map[string]Profile{}}
+	content, err := os.ReadFile(path)
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+		return
+	}
+	if err != nil {
+		return
+	}
+	err = yaml.Unmarshal(content, cfg)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+		return
+	}
+	if cfg.Profiles == nil {
+		cfg.Profiles = map[string]Profile{}
+	}
+	return
+}
+
+func saveConfig(path string, cfg *Config) (err error) {
+	content, err := yaml.Marshal(cfg)
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, content, 0o600)
+}
+
+// resolveProfile pick the named profile, the default one or "default",
+// QBT_URL, QBT_USERNAME and QBT_PASSWORD override its values
+func resolveProfile(cfg *Config, name string, getenv func(string) string) (resolved string, profile Profile) {
+	resolved = name
+	if resolved == "" {
+		resolved = cfg.Default
+	}
+	if resolved == "" {
+		resolved = "default"
+	}
+	profile = cfg.Profiles[resolved]
+
+	if v := getenv("QBT_URL"); v != "" {
+		profile.URL = v
+	}
+	if v := getenv("QBT_USERNAME"); v != "" {
+		profile.Username = v
+	}
+	if v := getenv("QBT_PASSWORD"); v != "" {
+		profile.Password = v
+	}
+	if profile.URL == "" {
+		profile.URL = "http://localhost:8080"
+	}
+	return
+}
+
+func sessionPath(profile string) string {
+	return filepath.Join(configDir(), "sessions", profile+".json")
+}
+
+// loadSession put cookies saved by a previous login back into the jar
+func loadSession(path string, jar http.CookieJar, address string) (ok bool) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return false
+	}
+	var cookies []*http.Cookie
+	if json.Unmarshal(content, &cookies) != nil || len(cookies) == 0 {
+		return false
+	}
+	u, err := url.Parse(address)
+	if err != nil {
+		return false
+	}
+	jar.SetCookies(u, cookies)
+	return true
+}
+
+func saveSession(path string, jar http.CookieJar, address string) (err error) {
+	u, err := url.Parse(address)
+	if err != nil {
+		return
+	}
+	content, err := json.Marshal(jar.Cookies(u))
+	if err != nil {
+		return
+	}
+	err = os.MkdirAll(filepath.Dir(path), 0o700)
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, content, 0o600)
+}
@@ -0,0 +1,55 @@
+package main
+
+import (
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func TestResolveProfile(t *testing.T) {
+	path := filepath.Join(t.TempDir(), "config.yaml")
+	err := os.WriteFile(path, []byte(`
+default: home
+profiles:
+  home:
+    url: http://home:8080
+    username: admin
+    password: home
+  seedbox:
+    url: https://seedbox.example
+    username: me
+`), 0o600)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := loadConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	env := map[string]string{}
+	getenv := func(key string) string { return env[key] }
+
+	name, profile := resolveProfile(cfg, "", getenv)
+	if name != "home" || profile.URL != "http://home:8080" || profile.Password != "home" {
+		t.Fatalf("unexpected default profile %s %+v", name, profile)
+	}
+
+	env["QBT_PASSWORD"] = "from-env"
+	name, profile = resolveProfile(cfg, "seedbox", getenv)
+	if name != "seedbox" || profile.URL != "https://seedbox.example" || profile.Username != "me" || profile.Password != "from-env" {
+		t.Fatalf("unexpected profile %s %+v", name, profile)
+	}
+
+	name, profile = resolveProfile(&Config{}, "", getenv)
+	if name != "default" || profile.URL != "http://localhost:8080" {
+		t.Fatalf("unexpected fallback %s %+v", name, profile)
+	}
+}
+
+func TestLoadConfig_Missing(t *testing.T) {
+	cfg, err := loadConfig(filepath.Join(t.TempDir(), "missing.yaml"))
+	if err != nil || cfg.Profiles == nil {
+		t.Fatalf("missing file should give an empty config, got %v", err)
+	}
+}
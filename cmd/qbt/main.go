@@ -0,0 +1,267 @@
+// Command qbt is a command line client for the qBittorrent WebUI
+//
+//	qbt [-config file] [-profile name] [-o table|json|csv] command [flags] [args]
+//
+// Run qbt help for the list of commands.
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	qbt "github.com/evrins/qbt-api"
+	"io"
+	"net/http"
+	"net/http/cookiejar"
+	"os"
+	"os/signal"
+	"sort"
+	"strings"
+	"time"
+)
+
+// cli hold the state shared by every command
+type cli struct {
+	api         *qbt.Api
+	jar         http.CookieJar
+	configPath  string
+	config      *Config
+	profileName string
+	profile     Profile
+	format      string
+	stdout      io.Writer
+	stderr      io.Writer
+}
+
+type command struct {
+	name  string
+	usage string
+	// public commands run without logging in first
+	public bool
+	run    func(ctx context.Context, c *cli, args []string) error
+}
+
+var commands []*command
+
+func init() {
+	commands = []*command{
+		{name: "login", usage: "login [-save] [-url url] [-username name] [-password password]", public: true, run: runLogin},
+		{name: "logout", usage: "logout", run: runLogout},
+		{name: "list", usage: "list [-filter f] [-category c] [-tag t] [-sort key] [-reverse] [-limit n] [-offset n] [hash...]", run: runList},
+		{name: "add", usage: "add [flags] file|magnet|url...", run: runAdd},
+		{name: "pause", usage: "pause all|hash...", run: runHashAction("pause")},
+		{name: "resume", usage: "resume all|hash...", run: runHashAction("resume")},
+		{name: "delete", usage: "delete [-files] all|hash...", run: runDelete},
+		{name: "recheck", usage: "recheck all|hash...", run: runHashAction("recheck")},
+		{name: "reannounce", usage: "reannounce all|hash...", run: runHashAction("reannounce")},
+		{name: "files", usage: "files hash", run: runFiles},
+		{name: "trackers", usage: "trackers hash", run: runTrackers},
+		{name: "peers", usage: "peers hash", run: runPeers},
+		{name: "limits", usage: "limits [-download bytes] [-upload bytes] [-ratio r] [-seeding-time minutes] [all|hash...]", run: runLimits},
+		{name: "policy", usage: "policy [-dry-run] [-audit file] policy.yaml", run: runPolicy},
+		{name: "top", usage: "top [-interval duration]", run: runTop},
+		{name: "rss", usage: "rss list|articles|add-feed|add-folder|remove|move|refresh|rules|matches|export|import ...", run: runRss},
+		{name: "search", usage: "search query|plugins|install|uninstall|enable|disable|update ...", run: runSearch},
+	}
+}
+
+func findCommand(name string) *command {
+	for _, it := range commands {
+		if it.name == name {
+			return it
+		}
+	}
+	return nil
+}
+
+func usage(w io.Writer) {
+	fmt.Fprintln(w, "usage: qbt [-config file] [-profile name] [-o table|json|csv] command [flags] [args]")
+	fmt.Fprintln(w, "\ncommands:")
+	for _, it := range commands {
+		fmt.Fprintln(w, "  "+it.usage)
+	}
+}
+
+func main() {
+	ctx, stop := signal.NotifyContext(context.Background(), os.Interrupt)
+	err := run(ctx, os.Args[1:], os.Stdout, os.Stderr)
+	stop()
+	if err != nil {
+		fmt.Fprintln(os.Stderr, "qbt:", err)
+		os.Exit(1)
+	}
+}
+
+func run(ctx context.Context, args []string, stdout, stderr io.Writer) (err error) {
+	c := &cli{stdout: stdout, stderr: stderr}
+	fs := flag.NewFlagSet("qbt", flag.ContinueOnError)
+	fs.SetOutput(stderr)
+	fs.StringVar(&c.configPath, "config", defaultConfigPath(), "config file")
+	fs.StringVar(&c.profileName, "profile", "", "server profile, QBT_PROFILE is used when empty")
+	fs.StringVar(&c.format, "o", FormatTable, "output format: table, json or csv")
+	fs.Usage = func() { usage(stderr) }
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() == 0 || fs.Arg(0) == "help" {
+		usage(stdout)
+		return
+	}
+	if c.profileName == "" {
+		c.profileName = os.Getenv("QBT_PROFILE")
+	}
+
+	cmd := findCommand(fs.Arg(0))
+	if cmd == nil {
+		return fmt.Errorf("unknown command %q, run qbt help", fs.Arg(0))
+	}
+
+	c.config, err = loadConfig(c.configPath)
+	if err != nil {
+		return
+	}
+	c.profileName, c.profile = resolveProfile(c.config, c.profileName, os.Getenv)
+	err = c.connect()
+	if err != nil {
+		return
+	}
+
+	if cmd.public {
+		return cmd.run(ctx, c, fs.Args()[1:])
+	}
+	err = c.ensureLogin(ctx)
+	if err != nil {
+		return
+	}
+	err = cmd.run(ctx, c, fs.Args()[1:])
+	// a saved session may have expired on the server, login again and retry once
+	if isForbidden(err) {
+		err = c.login(ctx)
+		if err != nil {
+			return
+		}
+		err = cmd.run(ctx, c, fs.Args()[1:])
+	}
+	return
+}
+
+func (c *cli) connect() (err error) {
+	jar, err := cookiejar.New(nil)
+	if err != nil {
+		return
+	}
+	c.jar = jar
+	c.api, err = qbt.NewApi(c.profile.URL, qbt.WithHTTPClient(&http.Client{Jar: jar, Timeout: 30 * time.Second}))
+	return
+}
+
+func (c *cli) ensureLogin(ctx context.Context) error {
+	if loadSession(sessionPath(c.profileName), c.jar, c.profile.URL) {
+		return nil
+	}
+	return c.login(ctx)
+}
+
+func (c *cli) login(ctx context.Context) (err error) {
+	respText, err := c.api.Auth.Login(ctx, c.profile.Username, c.profile.Password)
+	if err != nil {
+		return
+	}
+	// qBittorrent answer 200 with Fails. on bad credentials
+	if strings.TrimSpace(respText) != "Ok." {
+		return fmt.Errorf("login to %s failed: %s", c.profile.URL, strings.TrimSpace(respText))
+	}
+	return saveSession(sessionPath(c.profileName), c.jar, c.profile.URL)
+}
+
+func isForbidden(err error) bool {
+	var se *qbt.StatusError
+	return errors.As(err, &se) && se.StatusCode == http.StatusForbidden
+}
+
+func (c *cli) print(v any, t *table) error {
+	return printResult(c.stdout, c.format, v, t)
+}
+
+func newFlagSet(c *cli, cmd string) *flag.FlagSet {
+	fs := flag.NewFlagSet("qbt "+cmd, flag.ContinueOnError)
+	fs.SetOutput(c.stderr)
+	fs.Usage = func() {
+		if it := findCommand(cmd); it != nil {
+			fmt.Fprintln(c.stderr, "usage: qbt "+it.usage)
+		}
+		fs.PrintDefaults()
+	}
+	return fs
+}
+
+// hashArgs turn "all" into the all flag used by the torrent endpoints
+func hashArgs(args []string) (hashes []string, all bool, err error) {
+	if len(args) == 0 {
+		err = errors.New("no torrent given, pass hashes or all")
+		return
+	}
+	if len(args) == 1 && args[0] == "all" {
+		all = true
+		return
+	}
+	return args, false, nil
+}
+
+func runLogin(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "login")
+	save := fs.Bool("save", false, "store url and credentials in the profile")
+	fs.StringVar(&c.profile.URL, "url", c.profile.URL, "WebUI address")
+	fs.StringVar(&c.profile.Username, "username", c.profile.Username, "user name")
+	fs.StringVar(&c.profile.Password, "password", c.profile.Password, "password")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+
+	// the url may have changed
+	err = c.connect()
+	if err != nil {
+		return
+	}
+	err = c.login(ctx)
+	if err != nil {
+		return
+	}
+	version, err := c.api.App.Version(ctx)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(c.stdout, "logged in to %s (%s) as profile %s\n", c.profile.URL, version, c.profileName)
+
+	if *save {
+		c.config.Profiles[c.profileName] = c.profile
+		if c.config.Default == "" {
+			c.config.Default = c.profileName
+		}
+		err = saveConfig(c.configPath, c.config)
+	}
+	return
+}
+
+func runLogout(ctx context.Context, c *cli, args []string) (err error) {
+	_, err = c.api.Auth.Logout(ctx)
+	if err != nil {
+		return
+	}
+	err = os.Remove(sessionPath(c.profileName))
+	if errors.Is(err, os.ErrNotExist) {
+		err = nil
+	}
+	return
+}
+
+func sortedKeys[T any](m map[string]T) (keys []string) {
+	for key := range m {
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+	return
+}
@@ -0,0 +1,179 @@
+package main
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"testing"
+)
+
+func newTestServer(t *testing.T, logins *int) *httptest.Server {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path == "/api/v2/auth/login" {
+			r.ParseForm()
+			if r.Form.Get("password") != "secret" {
+				w.Write([]byte("Fails."))
+				return
+			}
+			*logins++
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+			w.Write([]byte("Ok."))
+			return
+		}
+		if cookie, err := r.Cookie("SID"); err != nil || cookie.Value != "session" {
+			http.Error(w, "Forbidden", http.StatusForbidden)
+			return
+		}
+		switch r.URL.Path {
+		case "/api/v2/app/version":
+			w.Write([]byte("v4.6.0"))
+		case "/api/v2/torrents/info":
+			if r.URL.Query().Get("filter") != "seeding" || r.URL.Query().Get("sort") != "ratio" {
+				t.Errorf("unexpected query %s", r.URL.RawQuery)
+			}
+			w.Write([]byte(`[{"hash":"aaaa","name":"debian.iso","size":1048576,"progress":1,"state":"uploading","ratio":2.5,"eta":8640000,"category":"linux","tags":"iso"}]`))
+		default:
+			http.Error(w, "unexpected "+r.URL.Path, http.StatusBadRequest)
+		}
+	}))
+	t.Cleanup(srv.Close)
+	return srv
+}
+
+func TestRun_LoginAndList(t *testing.T) {
+	var logins int
+	srv := newTestServer(t, &logins)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	config := filepath.Join(dir, "config.yaml")
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run(context.Background(), []string{"-config", config, "-profile", "test", "login", "-save", "-url", srv.URL, "-username", "admin", "-password", "secret"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err, stderr)
+	}
+	if !strings.Contains(stdout.String(), "v4.6.0") {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+
+	// the saved profile and session are reused
+	stdout.Reset()
+	err = run(context.Background(), []string{"-config", config, "-o", "csv", "list", "-filter", "seeding", "-sort", "ratio"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err, stderr)
+	}
+	expected := "hash,name,size,progress,state,down,up,ratio,eta,category,tags\n" +
+		"aaaa,debian.iso,1.0 MiB,100.0%,uploading,0 B/s,0 B/s,2.50,∞,linux,iso\n"
+	if stdout.String() != expected {
+		t.Fatalf("unexpected output %q", stdout)
+	}
+	if logins != 1 {
+		t.Fatalf("expected a single login, got %d", logins)
+	}
+
+	stdout.Reset()
+	err = run(context.Background(), []string{"-config", config, "-o", "json", "list", "-filter", "seeding", "-sort", "ratio"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var list []map[string]any
+	err = json.Unmarshal(stdout.Bytes(), &list)
+	if err != nil || len(list) != 1 || list[0]["hash"] != "aaaa" {
+		t.Fatalf("unexpected json %s", stdout)
+	}
+}
+
+func TestRun_ExpiredSession(t *testing.T) {
+	var logins int
+	srv := newTestServer(t, &logins)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("QBT_URL", srv.URL)
+	t.Setenv("QBT_PASSWORD", "secret")
+
+	path := sessionPath("default")
+	os.MkdirAll(filepath.Dir(path), 0o700)
+	os.WriteFile(path, []byte(`[{"Name":"SID","Value":"expired"}]`), 0o600)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run(context.Background(), []string{"-config", filepath.Join(dir, "none.yaml"), "list", "-filter", "seeding", "-sort", "ratio"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if logins != 1 || !strings.Contains(stdout.String(), "debian.iso") {
+		t.Fatalf("expected a login and a retry, got %d logins and %q", logins, stdout)
+	}
+}
+
+func TestRun_BadCredentials(t *testing.T) {
+	var logins int
+	srv := newTestServer(t, &logins)
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+
+	err := run(context.Background(), []string{"-config", filepath.Join(dir, "none.yaml"), "login", "-url", srv.URL, "-password", "wrong"}, &bytes.Buffer{}, &bytes.Buffer{})
+	if err == nil || !strings.Contains(err.Error(), "Fails.") {
+		t.Fatalf("expected login failure, got %v", err)
+	}
+}
+
+func TestHashArgs(t *testing.T) {
+	_, all, err := hashArgs([]string{"all"})
+	if err != nil || !all {
+		t.Fatal("all not recognized")
+	}
+	hashes, all, err := hashArgs([]string{"a", "b"})
+	if err != nil || all || len(hashes) != 2 {
+		t.Fatalf("unexpected %v %v %v", hashes, all, err)
+	}
+	_, _, err = hashArgs(nil)
+	if err == nil {
+		t.Fatal("expected error without hashes")
+	}
+}
+
+func TestRun_Limits(t *testing.T) {
+	var shareLimits []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		switch r.URL.Path {
+		case "/api/v2/auth/login":
+			http.SetCookie(w, &http.Cookie{Name: "SID", Value: "session", Path: "/"})
+			w.Write([]byte("Ok."))
+		case "/api/v2/torrents/info":
+			w.Write([]byte(`[{"hash":"bbbb","ratio_limit":-2,"seeding_time_limit":60},{"hash":"aaaa","ratio_limit":-2,"seeding_time_limit":-2},{"hash":"cccc","ratio_limit":1,"seeding_time_limit":60}]`))
+		case "/api/v2/torrents/setShareLimits":
+			shareLimits = append(shareLimits, r.Form.Get("hashes")+" "+r.Form.Get("ratioLimit")+" "+r.Form.Get("seedingTimeLimit"))
+		default:
+			http.Error(w, "unexpected "+r.URL.Path, http.StatusBadRequest)
+		}
+	}))
+	defer srv.Close()
+	dir := t.TempDir()
+	t.Setenv("XDG_CONFIG_HOME", dir)
+	t.Setenv("HOME", dir)
+	t.Setenv("QBT_URL", srv.URL)
+
+	stdout, stderr := &bytes.Buffer{}, &bytes.Buffer{}
+	err := run(context.Background(), []string{"-config", filepath.Join(dir, "none.yaml"), "-o", "json", "limits", "-ratio", "2", "all"}, stdout, stderr)
+	if err != nil {
+		t.Fatal(err, stderr)
+	}
+	// the seeding time limit of every torrent is kept
+	if strings.Join(shareLimits, ",") != "bbbb|cccc 2 60,aaaa 2 -2" {
+		t.Fatalf("unexpected share limits %v", shareLimits)
+	}
+	var limits []map[string]any
+	err = json.Unmarshal(stdout.Bytes(), &limits)
+	if err != nil || len(limits) != 3 || limits[0]["hash"] != "aaaa" || limits[2]["hash"] != "cccc" {
+		t.Fatalf("json output should be sorted %s", stdout)
+	}
+}
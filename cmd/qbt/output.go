@@ -0,0 +1,94 @@
+package main
+
+import (
+	"encoding/csv"
+	"encoding/json"
+	"fmt"
+	"io"
+	"strconv"
+	"strings"
+	"text/tabwriter"
+	"time"
+)
+
+const FormatTable = "table"
+const FormatJSON = "json"
+const FormatCSV = "csv"
+
+// table is the text form of a command result, json output use the original value instead
+type table struct {
+	headers []string
+	rows    [][]string
+}
+
+func (t *table) add(cells ...any) {
+	row := make([]string, len(cells))
+	for i, it := range cells {
+		row[i] = fmt.Sprint(it)
+	}
+	t.rows = append(t.rows, row)
+}
+
+// printResult write v as json, or t as an aligned table or csv
+func printResult(w io.Writer, format string, v any, t *table) (err error) {
+	switch format {
+	case FormatJSON:
+		enc := json.NewEncoder(w)
+		enc.SetIndent("", "  ")
+		return enc.Encode(v)
+	case FormatCSV:
+		cw := csv.NewWriter(w)
+		err = cw.Write(t.headers)
+		if err != nil {
+			return
+		}
+		err = cw.WriteAll(t.rows)
+		return
+	case FormatTable, "":
+		tw := tabwriter.NewWriter(w, 0, 0, 2, ' ', 0)
+		fmt.Fprintln(tw, strings.Join(t.headers, "\t"))
+		for _, row := range t.rows {
+			fmt.Fprintln(tw, strings.Join(row, "\t"))
+		}
+		return tw.Flush()
+	default:
+		return fmt.Errorf("unknown output format %q", format)
+	}
+}
+
+func humanBytes(n int64) string {
+	const unit = 1024
+	if n < unit {
+		return strconv.FormatInt(n, 10) + " B"
+	}
+	div, exp := int64(unit), 0
+	for m := n / unit; m >= unit; m /= unit {
+		div *= unit
+		exp++
+	}
+	return fmt.Sprintf("%.1f %ciB", float64(n)/float64(div), "KMGTPE"[exp])
+}
+
+func humanSpeed(n int64) string {
+	return humanBytes(n) + "/s"
+}
+
+func humanEta(seconds int) string {
+	// qBittorrent report 8640000 for an unknown eta
+	if seconds < 0 || seconds >= 8640000 {
+		return "∞"
+	}
+	return (time.Duration(seconds) * time.Second).String()
+}
+
+func percent(progress float64) string {
+	return strconv.FormatFloat(progress*100, 'f', 1, 64) + "%"
+}
+
+func truncate(s string, max int) string {
+	r := []rune(s)
+	if max <= 0 || len(r) <= max {
+		return s
+	}
+	return string(r[:max-1]) + "…"
+}
@@ -0,0 +1,56 @@
+package main
+
+import (
+	"bytes"
+	"testing"
+)
+
+func TestPrintResult(t *testing.T) {
+	tbl := &table{headers: []string{"name", "size"}}
+	tbl.add("a, b", 10)
+	tbl.add("long name", 2048)
+
+	buf := &bytes.Buffer{}
+	err := printResult(buf, FormatTable, nil, tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "name       size\na, b       10\nlong name  2048\n"
+	if buf.String() != expected {
+		t.Fatalf("unexpected table %q", buf)
+	}
+
+	buf.Reset()
+	err = printResult(buf, FormatCSV, nil, tbl)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if buf.String() != "name,size\n\"a, b\",10\nlong name,2048\n" {
+		t.Fatalf("unexpected csv %q", buf)
+	}
+
+	buf.Reset()
+	err = printResult(buf, FormatJSON, map[string]int{"a": 1}, tbl)
+	if err != nil || buf.String() != "{\n  \"a\": 1\n}\n" {
+		t.Fatalf("unexpected json %q %v", buf, err)
+	}
+
+	if printResult(buf, "xml", nil, tbl) == nil {
+		t.Fatal("expected unknown format error")
+	}
+}
+
+func TestHumanBytes(t *testing.T) {
+	cases := map[int64]string{
+		0:                 "0 B",
+		1023:              "1023 B",
+		1536:              "1.5 KiB",
+		1 << 30:           "1.0 GiB",
+		5 * (1 << 40) / 2: "2.5 TiB",
+	}
+	for n, expected := range cases {
+		if got := humanBytes(n); got != expected {
+			t.Errorf("humanBytes(%d) = %s, want %s", n, got, expected)
+		}
+	}
+}
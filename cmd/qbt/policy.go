@@ -0,0 +1,45 @@
+package main
+
+import (
+	"context"
+	"errors"
+	qbt "github.com/evrins/qbt-api"
+	"os"
+)
+
+func runPolicy(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "policy")
+	var opts qbt.SeedingPolicyOptions
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only print the decisions")
+	audit := fs.String("audit", "", "append a json line per decision to this file")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: qbt policy [-dry-run] [-audit file] policy.yaml")
+	}
+	policy, err := qbt.LoadSeedingPolicy(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	if *audit != "" {
+		var f *os.File
+		f, err = os.OpenFile(*audit, os.O_CREATE|os.O_APPEND|os.O_WRONLY, 0o644)
+		if err != nil {
+			return
+		}
+		defer f.Close()
+		opts.AuditLog = f
+	}
+
+	decisions, err := c.api.TorrentManagement.ApplySeedingPolicy(ctx, policy, opts)
+	t := &table{headers: []string{"hash", "name", "action", "rule", "reason"}}
+	for _, it := range decisions {
+		t.add(it.Hash, it.Name, it.Action, it.Rule, it.Reason)
+	}
+	if printErr := c.print(decisions, t); err == nil {
+		err = printErr
+	}
+	return
+}
@@ -0,0 +1,213 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	qbt "github.com/evrins/qbt-api"
+	"os"
+)
+
+func runRss(ctx context.Context, c *cli, args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("usage: qbt rss list|articles|add-feed|add-folder|remove|move|refresh|rules|matches|export|import ...")
+	}
+	rss := c.api.Rss
+	sub, args := args[0], args[1:]
+	switch sub {
+	case "list":
+		return c.rssList(ctx)
+	case "articles":
+		return c.rssArticles(ctx, args)
+	case "add-feed":
+		if len(args) < 1 || len(args) > 2 {
+			return errors.New("usage: qbt rss add-feed url [path]")
+		}
+		path := ""
+		if len(args) == 2 {
+			path = args[1]
+		}
+		return rss.AddFeed(ctx, args[0], path)
+	case "add-folder":
+		if len(args) != 1 {
+			return errors.New("usage: qbt rss add-folder path")
+		}
+		return rss.AddFolder(ctx, args[0])
+	case "remove":
+		if len(args) != 1 {
+			return errors.New("usage: qbt rss remove path")
+		}
+		return rss.RemoveItem(ctx, args[0])
+	case "move":
+		if len(args) != 2 {
+			return errors.New("usage: qbt rss move path dest")
+		}
+		return rss.MoveItem(ctx, args[0], args[1])
+	case "refresh":
+		if len(args) != 1 {
+			return errors.New("usage: qbt rss refresh path")
+		}
+		return rss.RefreshItem(ctx, args[0])
+	case "rules":
+		return c.rssRules(ctx)
+	case "matches":
+		if len(args) != 1 {
+			return errors.New("usage: qbt rss matches rule")
+		}
+		return c.rssMatches(ctx, args[0])
+	case "export":
+		return c.rssExport(ctx, args)
+	case "import":
+		return c.rssImport(ctx, args)
+	}
+	return fmt.Errorf("unknown rss command %q", sub)
+}
+
+func (c *cli) rssList(ctx context.Context) (err error) {
+	tree, err := c.api.Rss.Items(ctx, true)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"path", "type", "url", "unread", "error"}}
+	err = tree.Walk(func(node *qbt.RssNode) error {
+		if node.IsFolder() {
+			t.add(node.Path, "folder", "", node.UnreadCount(), false)
+		} else {
+			t.add(node.Path, "feed", node.Feed.URL, node.UnreadCount(), node.Feed.HasError)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	return c.print(tree, t)
+}
+
+func (c *cli) rssArticles(ctx context.Context, args []string) (err error) {
+	fs := newFlagSet(c, "rss")
+	unread := fs.Bool("unread", false, "only unread articles")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	tree, err := c.api.Rss.Items(ctx, true)
+	if err != nil {
+		return
+	}
+	root := tree.Root
+	if fs.NArg() > 0 {
+		root = tree.Find(fs.Arg(0))
+		if root == nil {
+			return fmt.Errorf("rss item %q not found", fs.Arg(0))
+		}
+	}
+
+	var articles []qbt.RssArticle
+	t := &table{headers: []string{"feed", "date", "title", "read", "torrent"}}
+	err = (&qbt.RssTree{Root: root}).Walk(func(node *qbt.RssNode) error {
+		if node.IsFolder() {
+			return nil
+		}
+		for _, it := range node.Feed.Articles {
+			if *unread && it.IsRead {
+				continue
+			}
+			articles = append(articles, it)
+			title := it.Title
+			if c.format == FormatTable {
+				title = truncate(title, 60)
+			}
+			t.add(node.Path, it.Date, title, it.IsRead, it.TorrentURL)
+		}
+		return nil
+	})
+	if err != nil {
+		return
+	}
+	return c.print(articles, t)
+}
+
+func (c *cli) rssRules(ctx context.Context) (err error) {
+	rules, err := c.api.Rss.Rules(ctx)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"name", "enabled", "must contain", "must not contain", "category", "feeds"}}
+	for _, name := range sortedKeys(rules) {
+		it := rules[name]
+		t.add(name, it.Enable, it.MustContain, it.MustNotContain, it.AssignedCategory, len(it.AffectedFeeds))
+	}
+	return c.print(rules, t)
+}
+
+func (c *cli) rssMatches(ctx context.Context, rule string) (err error) {
+	matches, err := c.api.Rss.MatchingArticles(ctx, rule)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"feed", "article"}}
+	for _, feed := range sortedKeys(matches) {
+		for _, it := range matches[feed] {
+			t.add(feed, it)
+		}
+	}
+	return c.print(matches, t)
+}
+
+// rssExport write the feed tree and rules to a file, or stdout as json
+func (c *cli) rssExport(ctx context.Context, args []string) (err error) {
+	fs := newFlagSet(c, "rss")
+	state := fs.Bool("state", false, "include rule state such as previously matched episodes")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	cfg, err := c.api.Rss.Export(ctx, qbt.RssExportOptions{IncludeState: *state})
+	if err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		data, err1 := qbt.MarshalRssConfig(cfg, qbt.RssConfigJSON)
+		if err1 != nil {
+			return err1
+		}
+		_, err = c.stdout.Write(data)
+		return
+	}
+	path := fs.Arg(0)
+	data, err := qbt.MarshalRssConfig(cfg, qbt.RssConfigFormatFromPath(path))
+	if err != nil {
+		return
+	}
+	return os.WriteFile(path, data, 0o644)
+}
+
+func (c *cli) rssImport(ctx context.Context, args []string) (err error) {
+	fs := newFlagSet(c, "rss")
+	var opts qbt.RssImportOptions
+	fs.BoolVar(&opts.Prune, "prune", false, "remove feeds, folders and rules missing from the file")
+	fs.BoolVar(&opts.DryRun, "dry-run", false, "only print the plan")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() != 1 {
+		return errors.New("usage: qbt rss import [-prune] [-dry-run] file")
+	}
+	data, err := os.ReadFile(fs.Arg(0))
+	if err != nil {
+		return
+	}
+	cfg, err := qbt.UnmarshalRssConfig(data, qbt.RssConfigFormatFromPath(fs.Arg(0)))
+	if err != nil {
+		return
+	}
+	actions, err := c.api.Rss.Import(ctx, cfg, opts)
+	if err != nil {
+		return
+	}
+	for _, it := range actions {
+		fmt.Fprintln(c.stdout, it)
+	}
+	return
+}
@@ -0,0 +1,139 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	qbt "github.com/evrins/qbt-api"
+	"regexp"
+	"strings"
+	"time"
+)
+
+func runSearch(ctx context.Context, c *cli, args []string) (err error) {
+	if len(args) == 0 {
+		return errors.New("usage: qbt search query|plugins|install|uninstall|enable|disable|update ...")
+	}
+	search := c.api.Search
+	sub, args := args[0], args[1:]
+	switch sub {
+	case "query":
+		return c.searchQuery(ctx, args)
+	case "plugins":
+		return c.searchPlugins(ctx)
+	case "install":
+		if len(args) == 0 {
+			return errors.New("usage: qbt search install url|path...")
+		}
+		return search.InstallPlugin(ctx, args)
+	case "uninstall":
+		if len(args) == 0 {
+			return errors.New("usage: qbt search uninstall name...")
+		}
+		return search.UninstallPlugin(ctx, args)
+	case "enable", "disable":
+		if len(args) == 0 {
+			return fmt.Errorf("usage: qbt search %s name...", sub)
+		}
+		return search.EnablePlugin(ctx, args, sub == "enable")
+	case "update":
+		return search.UpdatePlugins(ctx)
+	}
+	return fmt.Errorf("unknown search command %q", sub)
+}
+
+func (c *cli) searchQuery(ctx context.Context, args []string) (err error) {
+	fs := newFlagSet(c, "search")
+	var plugins, categories stringList
+	var filter qbt.SearchResultFilter
+	fs.Var(&plugins, "plugins", "comma separated plugins, all enabled plugins by default")
+	fs.Var(&categories, "category", "comma separated categories, all by default")
+	timeout := fs.Duration("timeout", 30*time.Second, "stop searching after this duration")
+	fs.Int64Var(&filter.MinSeeders, "min-seeders", 0, "drop results with fewer seeders")
+	fs.Int64Var(&filter.MinSize, "min-size", 0, "drop results smaller than this many bytes")
+	fs.Int64Var(&filter.MaxSize, "max-size", 0, "drop results larger than this many bytes")
+	include := fs.String("include", "", "regular expression the name must match")
+	exclude := fs.String("exclude", "", "regular expression the name must not match")
+	limit := fs.Int("limit", 20, "number of results shown, 0 for all")
+	add := fs.Int("add", 0, "add the result with this rank")
+	var addOpts qbt.TorrentManagementAddOptions
+	var addTags stringList
+	fs.Var(optionalString{&addOpts.Category}, "add-category", "category of the added torrent")
+	fs.Var(&addTags, "add-tags", "comma separated tags of the added torrent")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		return errors.New("usage: qbt search query [flags] pattern")
+	}
+	if *include != "" {
+		filter.Include, err = regexp.Compile("(?i)" + *include)
+		if err != nil {
+			return
+		}
+	}
+	if *exclude != "" {
+		filter.Exclude, err = regexp.Compile("(?i)" + *exclude)
+		if err != nil {
+			return
+		}
+	}
+
+	opts := &qbt.SearchOptions{
+		Pattern:           strings.Join(fs.Args(), " "),
+		Plugins:           plugins,
+		UseEnabledPlugins: len(plugins) == 0,
+		Category:          categories,
+		UseAllCategory:    len(categories) == 0,
+	}
+	session, err := c.api.Search.NewManager(1).Start(ctx, opts, qbt.SearchSessionOptions{Timeout: *timeout})
+	if err != nil {
+		return
+	}
+	var results []qbt.Result
+	for it := range session.Results() {
+		results = append(results, it)
+	}
+	// a timeout only end the search, the results found so far are still shown
+	err = session.Wait()
+	if err != nil {
+		return
+	}
+
+	ranked := qbt.ProcessResults(results, filter, qbt.DefaultSearchDedupOptions, qbt.DefaultSearchRanking)
+	if *add > 0 {
+		if *add > len(ranked) {
+			return fmt.Errorf("only %d results found", len(ranked))
+		}
+		result := ranked[*add-1]
+		fmt.Fprintf(c.stderr, "adding %s\n", result.FileName)
+		addOpts.Tags = addTags
+		return c.api.TorrentManagement.AddSearchResult(ctx, result.Result, addOpts)
+	}
+	if *limit > 0 && len(ranked) > *limit {
+		ranked = ranked[:*limit]
+	}
+
+	t := &table{headers: []string{"rank", "name", "size", "seeders", "leechers", "sites", "url"}}
+	for i, it := range ranked {
+		name := it.FileName
+		if c.format == FormatTable {
+			name = truncate(name, 60)
+		}
+		t.add(i+1, name, humanBytes(it.FileSize), it.NbSeeders, it.NbLeechers, strings.Join(it.SiteUrls(), " "), it.FileUrl)
+	}
+	return c.print(ranked, t)
+}
+
+func (c *cli) searchPlugins(ctx context.Context) (err error) {
+	plugins, err := c.api.Search.Plugins(ctx)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"name", "version", "enabled", "url"}}
+	for _, it := range plugins {
+		t.add(it.Name, it.Version, it.Enabled, it.Url)
+	}
+	return c.print(plugins, t)
+}
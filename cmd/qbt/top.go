@@ -0,0 +1,582 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	qbt "github.com/evrins/qbt-api"
+	"golang.org/x/term"
+	"io"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+// topColumn is a sortable column of the torrent list
+type topColumn struct {
+	title string
+	width int
+	value func(t qbt.Torrent) string
+	less  func(a, b qbt.Torrent) bool
+}
+
+var topColumns = []topColumn{
+	{"NAME", 0, func(t qbt.Torrent) string { return t.Name },
+		func(a, b qbt.Torrent) bool { return strings.ToLower(a.Name) < strings.ToLower(b.Name) }},
+	{"SIZE", 10, func(t qbt.Torrent) string { return humanBytes(t.Size) },
+		func(a, b qbt.Torrent) bool { return a.Size < b.Size }},
+	{"DONE", 7, func(t qbt.Torrent) string { return percent(t.Progress) },
+		func(a, b qbt.Torrent) bool { return a.Progress < b.Progress }},
+	{"STATE", 12, func(t qbt.Torrent) string { return t.State },
+		func(a, b qbt.Torrent) bool { return a.State < b.State }},
+	{"DOWN", 12, func(t qbt.Torrent) string { return humanSpeed(int64(t.Dlspeed)) },
+		func(a, b qbt.Torrent) bool { return a.Dlspeed < b.Dlspeed }},
+	{"UP", 12, func(t qbt.Torrent) string { return humanSpeed(int64(t.Upspeed)) },
+		func(a, b qbt.Torrent) bool { return a.Upspeed < b.Upspeed }},
+	{"RATIO", 6, func(t qbt.Torrent) string { return fmt.Sprintf("%.2f", t.Ratio) },
+		func(a, b qbt.Torrent) bool { return a.Ratio < b.Ratio }},
+	{"ETA", 10, func(t qbt.Torrent) string { return humanEta(t.Eta) },
+		func(a, b qbt.Torrent) bool { return a.Eta < b.Eta }},
+}
+
+type topRow struct {
+	hash    string
+	torrent qbt.Torrent
+}
+
+// topDetail is what the detail pane shows for the selected torrent
+type topDetail struct {
+	hash       string
+	properties *qbt.TorrentManagementProperties
+	trackers   []*qbt.TorrentManagementTracker
+	files      []*qbt.TorrentManagementFile
+	peers      map[string]qbt.Peer
+	err        error
+}
+
+// dashboard is the state of qbt top, it knows nothing about the terminal so it can be rendered to a string
+type dashboard struct {
+	rows     []topRow
+	state    qbt.ServerState
+	online   bool
+	lastErr  error
+	sortBy   int
+	reverse  bool
+	cursor   int
+	selected string
+	detail   *topDetail
+	// confirm hold the pending action waiting for y
+	confirm string
+	message string
+	width   int
+	height  int
+}
+
+func newDashboard() *dashboard {
+	// fastest downloads first
+	return &dashboard{sortBy: 4, reverse: true, width: 80, height: 24}
+}
+
+func (d *dashboard) setTorrents(torrents map[string]qbt.Torrent) {
+	d.rows = d.rows[:0]
+	for hash, it := range torrents {
+		d.rows = append(d.rows, topRow{hash, it})
+	}
+	d.sortRows()
+}
+
+func (d *dashboard) sortRows() {
+	less := topColumns[d.sortBy].less
+	sort.SliceStable(d.rows, func(i, j int) bool {
+		a, b := d.rows[i].torrent, d.rows[j].torrent
+		if less(a, b) == less(b, a) {
+			// keep a stable order between refreshes
+			return d.rows[i].hash < d.rows[j].hash
+		}
+		if d.reverse {
+			return less(b, a)
+		}
+		return less(a, b)
+	})
+
+	// keep the cursor on the selected torrent when the order changes
+	d.cursor = 0
+	for i, it := range d.rows {
+		if it.hash == d.selected {
+			d.cursor = i
+			break
+		}
+	}
+	d.selectCursor()
+}
+
+func (d *dashboard) selectCursor() {
+	if d.cursor >= len(d.rows) {
+		d.cursor = len(d.rows) - 1
+	}
+	if d.cursor < 0 {
+		d.cursor = 0
+	}
+	d.selected = ""
+	if len(d.rows) > 0 {
+		d.selected = d.rows[d.cursor].hash
+	}
+}
+
+func (d *dashboard) move(delta int) {
+	d.cursor += delta
+	d.selectCursor()
+}
+
+// topAction is a request from a key press the terminal loop has to carry out
+type topAction string
+
+const topNone topAction = ""
+const topQuit topAction = "quit"
+const topPause topAction = "pause"
+const topResume topAction = "resume"
+const topDelete topAction = "delete"
+const topDeleteFiles topAction = "delete files"
+const topForceStart topAction = "force start"
+const topIncreasePriority topAction = "increase priority"
+const topDecreasePriority topAction = "decrease priority"
+const topOpenDetail topAction = "open detail"
+const topCloseDetail topAction = "close detail"
+
+const keyUp = "up"
+const keyDown = "down"
+const keyEnter = "enter"
+const keyEscape = "esc"
+
+func (d *dashboard) handleKey(key string) topAction {
+	if d.confirm != "" {
+		action := topAction(d.confirm)
+		d.confirm = ""
+		d.message = ""
+		if key == "y" {
+			return action
+		}
+		return topNone
+	}
+
+	d.message = ""
+	switch key {
+	case "q", "\x03":
+		return topQuit
+	case keyUp, "k":
+		d.move(-1)
+	case keyDown, "j":
+		d.move(1)
+	case "s", ">":
+		d.sortBy = (d.sortBy + 1) % len(topColumns)
+		d.sortRows()
+	case "<":
+		d.sortBy = (d.sortBy + len(topColumns) - 1) % len(topColumns)
+		d.sortRows()
+	case "r":
+		d.reverse = !d.reverse
+		d.sortRows()
+	case "p":
+		return topPause
+	case "u":
+		return topResume
+	case "f":
+		return topForceStart
+	case "+":
+		return topIncreasePriority
+	case "-":
+		return topDecreasePriority
+	case "d", "D":
+		if d.selected == "" {
+			return topNone
+		}
+		d.confirm = string(topDelete)
+		if key == "D" {
+			d.confirm = string(topDeleteFiles)
+		}
+		d.message = fmt.Sprintf("%s %s? y/n", d.confirm, d.rows[d.cursor].torrent.Name)
+	case keyEnter:
+		if d.detail != nil {
+			return topCloseDetail
+		}
+		return topOpenDetail
+	case keyEscape:
+		if d.detail != nil {
+			return topCloseDetail
+		}
+	default:
+		if len(key) == 1 && key[0] >= '1' && key[0] < '1'+byte(len(topColumns)) {
+			column := int(key[0] - '1')
+			if column == d.sortBy {
+				d.reverse = !d.reverse
+			}
+			d.sortBy = column
+			d.sortRows()
+		}
+	}
+	return topNone
+}
+
+func fit(s string, width int) string {
+	s = truncate(s, width)
+	if n := len([]rune(s)); n < width {
+		s += strings.Repeat(" ", width-n)
+	}
+	return s
+}
+
+// render draw a full frame, lines are exactly d.width wide
+func (d *dashboard) render() string {
+	var lines []string
+	add := func(s string) {
+		lines = append(lines, fit(s, d.width))
+	}
+
+	status := d.state.ConnectionStatus
+	if !d.online {
+		status = "offline"
+		if d.lastErr != nil {
+			status += ": " + d.lastErr.Error()
+		}
+	}
+	add(fmt.Sprintf("qbt top - %s - %d torrents - dht %d - peers %d", status, len(d.rows), d.state.DhtNodes, d.state.TotalPeerConnections))
+	add(fmt.Sprintf("down %s (%s total)  up %s (%s total)  ratio %s  free %s",
+		humanSpeed(int64(d.state.DlInfoSpeed)), humanBytes(int64(d.state.DlInfoData)),
+		humanSpeed(int64(d.state.UpInfoSpeed)), humanBytes(int64(d.state.UpInfoData)),
+		d.state.GlobalRatio, humanBytes(d.state.FreeSpaceOnDisk)))
+
+	nameWidth := d.width
+	for _, it := range topColumns[1:] {
+		nameWidth -= it.width + 1
+	}
+	if nameWidth < 10 {
+		nameWidth = 10
+	}
+	widthOf := func(i int) int {
+		if i == 0 {
+			return nameWidth
+		}
+		return topColumns[i].width
+	}
+
+	var header []string
+	for i, it := range topColumns {
+		title := it.title
+		if i == d.sortBy {
+			if d.reverse {
+				title += "▼"
+			} else {
+				title += "▲"
+			}
+		}
+		header = append(header, fit(title, widthOf(i)))
+	}
+	add(strings.Join(header, " "))
+
+	listHeight := d.height - len(lines) - 1
+	var detail []string
+	if d.detail != nil {
+		detail = d.renderDetail()
+		listHeight -= len(detail)
+		if listHeight < 3 {
+			listHeight = 3
+		}
+	}
+
+	// scroll so the cursor stays visible
+	start := 0
+	if d.cursor >= listHeight {
+		start = d.cursor - listHeight + 1
+	}
+	for i := start; i < len(d.rows) && i < start+listHeight; i++ {
+		var cells []string
+		for c, column := range topColumns {
+			cells = append(cells, fit(column.value(d.rows[i].torrent), widthOf(c)))
+		}
+		line := fit(strings.Join(cells, " "), d.width)
+		if i == d.cursor {
+			line = "\x1b[7m" + line + "\x1b[0m"
+		}
+		lines = append(lines, line)
+	}
+	for len(lines) < d.height-1-len(detail) {
+		add("")
+	}
+
+	for _, it := range detail {
+		add(it)
+	}
+
+	footer := "q quit  ↑↓ move  1-8/s sort  r reverse  p pause  u resume  f force  +/- priority  d/D delete  enter detail"
+	if d.message != "" {
+		footer = d.message
+	}
+	add(footer)
+	if len(lines) > d.height {
+		lines = lines[:d.height]
+	}
+	return strings.Join(lines, "\r\n")
+}
+
+func (d *dashboard) renderDetail() (lines []string) {
+	detail := d.detail
+	lines = append(lines, strings.Repeat("─", d.width))
+	if detail.err != nil {
+		return append(lines, "error: "+detail.err.Error())
+	}
+	if p := detail.properties; p != nil {
+		lines = append(lines,
+			fmt.Sprintf("save path %s  pieces %d x %s  added %s", p.SavePath, p.PiecesNum, humanBytes(int64(p.PieceSize)),
+				time.Unix(int64(p.AdditionDate), 0).Format(time.DateTime)),
+			fmt.Sprintf("seeds %d (%d)  peers %d (%d)  wasted %s  comment %s", p.Seeds, p.SeedsTotal, p.Peers, p.PeersTotal,
+				humanBytes(int64(p.TotalWasted)), p.Comment))
+	} else {
+		lines = append(lines, "loading...")
+	}
+
+	for i, it := range detail.trackers {
+		if i == 3 {
+			lines = append(lines, fmt.Sprintf("  ... %d more trackers", len(detail.trackers)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("tracker %s  status %d  seeds %d  %s", it.URL, it.Status, it.NumSeeds, it.Msg))
+	}
+	for i, it := range detail.files {
+		if i == 3 {
+			lines = append(lines, fmt.Sprintf("  ... %d more files", len(detail.files)-i))
+			break
+		}
+		lines = append(lines, fmt.Sprintf("file %s  %s  %s  priority %d", it.Name, humanBytes(it.Size), percent(it.Progress), it.Priority))
+	}
+
+	keys := sortedKeys(detail.peers)
+	sort.SliceStable(keys, func(i, j int) bool {
+		return detail.peers[keys[i]].DlSpeed+detail.peers[keys[i]].UpSpeed > detail.peers[keys[j]].DlSpeed+detail.peers[keys[j]].UpSpeed
+	})
+	lines = append(lines, fmt.Sprintf("%d peers", len(keys)))
+	for i, key := range keys {
+		if i == 5 {
+			break
+		}
+		it := detail.peers[key]
+		lines = append(lines, fmt.Sprintf("  %-22s %-20s %-3s %7s  down %s  up %s", key, truncate(it.Client, 20), it.CountryCode,
+			percent(it.Progress), humanSpeed(int64(it.DlSpeed)), humanSpeed(int64(it.UpSpeed))))
+	}
+	return
+}
+
+// parseKeys split raw terminal input into key names, arrows and escape are translated
+func parseKeys(input []byte) (keys []string) {
+	for len(input) > 0 {
+		switch {
+		case len(input) >= 3 && input[0] == 0x1b && input[1] == '[':
+			switch input[2] {
+			case 'A':
+				keys = append(keys, keyUp)
+			case 'B':
+				keys = append(keys, keyDown)
+			}
+			input = input[3:]
+		case input[0] == 0x1b:
+			keys = append(keys, keyEscape)
+			input = input[1:]
+		case input[0] == '\r' || input[0] == '\n':
+			keys = append(keys, keyEnter)
+			input = input[1:]
+		default:
+			keys = append(keys, string(input[0]))
+			input = input[1:]
+		}
+	}
+	return
+}
+
+func runTop(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "top")
+	interval := fs.Duration("interval", 2*time.Second, "refresh interval")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+
+	fd := int(os.Stdin.Fd())
+	if !term.IsTerminal(fd) {
+		return errors.New("top needs a terminal")
+	}
+	oldState, err := term.MakeRaw(fd)
+	if err != nil {
+		return
+	}
+	defer term.Restore(fd, oldState)
+	// alternate screen and hidden cursor
+	fmt.Fprint(c.stdout, "\x1b[?1049h\x1b[?25l")
+	defer fmt.Fprint(c.stdout, "\x1b[?25h\x1b[?1049l")
+
+	ctx, cancel := context.WithCancel(ctx)
+	defer cancel()
+	return c.topLoop(ctx, os.Stdin, fd, *interval)
+}
+
+func (c *cli) topLoop(ctx context.Context, input io.Reader, fd int, interval time.Duration) (err error) {
+	keys := make(chan string)
+	go func() {
+		buf := make([]byte, 64)
+		for {
+			n, err := input.Read(buf)
+			if err != nil {
+				close(keys)
+				return
+			}
+			for _, it := range parseKeys(buf[:n]) {
+				select {
+				case keys <- it:
+				case <-ctx.Done():
+					return
+				}
+			}
+		}
+	}()
+
+	mt := c.api.Sync.NewMainDataTracker(interval)
+	updates := make(chan error, 1)
+	go func() {
+		ticker := time.NewTicker(interval)
+		defer ticker.Stop()
+		for {
+			err := mt.Update(ctx)
+			select {
+			case updates <- err:
+			case <-ctx.Done():
+				return
+			}
+			select {
+			case <-ticker.C:
+			case <-ctx.Done():
+				return
+			}
+		}
+	}()
+
+	details := make(chan *topDetail, 1)
+	peers := make(chan *qbt.PeerTracker, 1)
+	var stopPeers context.CancelFunc = func() {}
+	defer func() { stopPeers() }()
+
+	d := newDashboard()
+	draw := func() {
+		if w, h, err := term.GetSize(fd); err == nil {
+			d.width, d.height = w, h
+		}
+		fmt.Fprint(c.stdout, "\x1b[H"+d.render())
+	}
+	draw()
+
+	for {
+		select {
+		case <-ctx.Done():
+			return nil
+		case err := <-updates:
+			d.online = err == nil
+			d.lastErr = err
+			if isForbidden(err) {
+				d.lastErr = c.login(ctx)
+			}
+			if err == nil {
+				d.state = mt.ServerState()
+				d.setTorrents(mt.Torrents())
+			}
+		case detail := <-details:
+			if d.detail != nil && d.detail.hash == detail.hash {
+				detail.peers = d.detail.peers
+				d.detail = detail
+			}
+		case pt := <-peers:
+			if d.detail != nil && d.detail.hash == pt.Hash() {
+				d.detail.peers = pt.Peers()
+			}
+		case key, ok := <-keys:
+			if !ok {
+				return nil
+			}
+			action := d.handleKey(key)
+			switch action {
+			case topQuit:
+				return nil
+			case topOpenDetail:
+				if d.selected == "" {
+					break
+				}
+				d.detail = &topDetail{hash: d.selected}
+				go c.loadDetail(ctx, d.selected, details)
+				stopPeers()
+				peersCtx, cancelPeers := context.WithCancel(ctx)
+				stopPeers = cancelPeers
+				go c.api.Sync.NewPeerTracker(d.selected, interval).Run(peersCtx, func(pt *qbt.PeerTracker) {
+					select {
+					case peers <- pt:
+					default:
+					}
+				})
+			case topCloseDetail:
+				stopPeers()
+				d.detail = nil
+			case topNone:
+			default:
+				if d.selected != "" {
+					err := c.topAction(ctx, action, d.selected)
+					d.message = string(action)
+					if err != nil {
+						d.message += ": " + err.Error()
+					}
+				}
+			}
+		}
+		draw()
+	}
+}
+
+func (c *cli) loadDetail(ctx context.Context, hash string, details chan<- *topDetail) {
+	detail := &topDetail{hash: hash}
+	tm := c.api.TorrentManagement
+	detail.properties, detail.err = tm.Properties(ctx, hash)
+	if detail.err == nil {
+		detail.trackers, detail.err = tm.Trackers(ctx, hash)
+	}
+	if detail.err == nil {
+		detail.files, detail.err = tm.Files(ctx, hash, nil)
+	}
+	select {
+	case details <- detail:
+	case <-ctx.Done():
+	}
+}
+
+func (c *cli) topAction(ctx context.Context, action topAction, hash string) error {
+	tm := c.api.TorrentManagement
+	hashes := []string{hash}
+	switch action {
+	case topPause:
+		return tm.Pause(ctx, hashes, false)
+	case topResume:
+		return tm.Resume(ctx, hashes, false)
+	case topDelete:
+		return tm.Delete(ctx, hashes, false, false)
+	case topDeleteFiles:
+		return tm.Delete(ctx, hashes, false, true)
+	case topForceStart:
+		info, err := tm.Info(ctx, qbt.TorrentManagementInfoOptions{Filter: qbt.FilterAll, Hashes: hashes})
+		if err != nil {
+			return err
+		}
+		if len(info) == 0 {
+			return qbt.ErrTorrentRemoved
+		}
+		return tm.SetForceStart(ctx, hashes, false, !info[0].ForceStart)
+	case topIncreasePriority:
+		return tm.IncreasePriority(ctx, hashes, false)
+	case topDecreasePriority:
+		return tm.DecreasePriority(ctx, hashes, false)
+	}
+	return fmt.Errorf("unknown action %q", action)
+}
@@ -0,0 +1,115 @@
+package main
+
+import (
+	qbt "github.com/evrins/qbt-api"
+	"strings"
+	"testing"
+)
+
+func testDashboard() *dashboard {
+	d := newDashboard()
+	d.online = true
+	d.state = qbt.ServerState{ConnectionStatus: "connected", DlInfoSpeed: 2048, GlobalRatio: "1.20"}
+	d.setTorrents(map[string]qbt.Torrent{
+		"aaaa": {Name: "debian.iso", Dlspeed: 100, Ratio: 0.5, State: "downloading"},
+		"bbbb": {Name: "arch.iso", Dlspeed: 300, Ratio: 2, State: "downloading"},
+		"cccc": {Name: "fedora.iso", Dlspeed: 0, Ratio: 1, State: "uploading"},
+	})
+	return d
+}
+
+func names(d *dashboard) (list []string) {
+	for _, it := range d.rows {
+		list = append(list, it.torrent.Name)
+	}
+	return
+}
+
+func TestDashboard_Sort(t *testing.T) {
+	d := testDashboard()
+	if strings.Join(names(d), ",") != "arch.iso,debian.iso,fedora.iso" || d.selected != "bbbb" {
+		t.Fatalf("unexpected default order %v selected %s", names(d), d.selected)
+	}
+
+	// the selection follow the torrent when the order changes
+	d.handleKey(keyDown)
+	if d.selected != "aaaa" {
+		t.Fatalf("unexpected selection %s", d.selected)
+	}
+	d.handleKey("7")
+	if strings.Join(names(d), ",") != "arch.iso,fedora.iso,debian.iso" || d.cursor != 2 || d.selected != "aaaa" {
+		t.Fatalf("unexpected ratio order %v cursor %d", names(d), d.cursor)
+	}
+	// pressing the sort column again flip the direction
+	d.handleKey("7")
+	if strings.Join(names(d), ",") != "debian.iso,fedora.iso,arch.iso" || d.cursor != 0 {
+		t.Fatalf("unexpected reversed order %v cursor %d", names(d), d.cursor)
+	}
+
+	// updates keep the selection
+	d.setTorrents(map[string]qbt.Torrent{
+		"aaaa": {Name: "debian.iso", Ratio: 3},
+		"bbbb": {Name: "arch.iso", Ratio: 2},
+	})
+	if d.selected != "aaaa" || d.cursor != 1 {
+		t.Fatalf("selection lost %s %d", d.selected, d.cursor)
+	}
+}
+
+func TestDashboard_Keys(t *testing.T) {
+	d := testDashboard()
+	if d.handleKey("p") != topPause || d.handleKey("q") != topQuit || d.handleKey(keyEnter) != topOpenDetail {
+		t.Fatal("unexpected actions")
+	}
+
+	if d.handleKey("D") != topNone || !strings.Contains(d.message, "delete files arch.iso") {
+		t.Fatalf("delete must ask first, message %q", d.message)
+	}
+	if d.handleKey("y") != topDeleteFiles {
+		t.Fatal("confirmed delete not returned")
+	}
+	d.handleKey("d")
+	if d.handleKey("n") != topNone || d.confirm != "" {
+		t.Fatal("cancelled delete still pending")
+	}
+
+	d.detail = &topDetail{hash: "bbbb"}
+	if d.handleKey(keyEscape) != topCloseDetail {
+		t.Fatal("escape must close the detail pane")
+	}
+}
+
+func TestDashboard_Render(t *testing.T) {
+	d := testDashboard()
+	d.width, d.height = 100, 12
+	d.detail = &topDetail{hash: "bbbb", peers: map[string]qbt.Peer{"1.1.1.1:6881": {Client: "qBittorrent", DlSpeed: 10}}}
+
+	lines := strings.Split(d.render(), "\r\n")
+	if len(lines) != d.height {
+		t.Fatalf("expected %d lines, got %d", d.height, len(lines))
+	}
+	if !strings.Contains(lines[0], "connected") || !strings.Contains(lines[1], "2.0 KiB/s") {
+		t.Fatalf("unexpected header %q", lines[:2])
+	}
+	if !strings.Contains(lines[2], "DOWN▼") {
+		t.Fatalf("sort column not marked %q", lines[2])
+	}
+	if !strings.HasPrefix(lines[3], "\x1b[7march.iso") {
+		t.Fatalf("selected row not highlighted %q", lines[3])
+	}
+	if !strings.Contains(d.render(), "1.1.1.1:6881") {
+		t.Fatal("peers missing from detail pane")
+	}
+
+	d.online = false
+	if !strings.Contains(d.render(), "offline") {
+		t.Fatal("offline state not shown")
+	}
+}
+
+func TestParseKeys(t *testing.T) {
+	keys := parseKeys([]byte("j\x1b[A\x1b[Bq\r\x1b"))
+	if strings.Join(keys, ",") != "j,up,down,q,enter,esc" {
+		t.Fatalf("unexpected keys %v", keys)
+	}
+}
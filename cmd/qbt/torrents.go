@@ -0,0 +1,386 @@
+package main
+
+import (
+	"context"
+	"errors"
+	"flag"
+	"fmt"
+	qbt "github.com/evrins/qbt-api"
+	"os"
+	"sort"
+	"strings"
+)
+
+// optionalString only set the target when the flag is given on the command line
+type optionalString struct {
+	target **string
+}
+
+func (o optionalString) String() string {
+	if o.target == nil || *o.target == nil {
+		return ""
+	}
+	return **o.target
+}
+
+func (o optionalString) Set(v string) error {
+	*o.target = &v
+	return nil
+}
+
+type stringList []string
+
+func (sl *stringList) String() string {
+	return strings.Join(*sl, ",")
+}
+
+func (sl *stringList) Set(v string) error {
+	for _, it := range strings.Split(v, ",") {
+		if it = strings.TrimSpace(it); it != "" {
+			*sl = append(*sl, it)
+		}
+	}
+	return nil
+}
+
+// flagWasSet report whether name was given explicitly
+func flagWasSet(fs *flag.FlagSet, name string) (set bool) {
+	fs.Visit(func(f *flag.Flag) {
+		if f.Name == name {
+			set = true
+		}
+	})
+	return
+}
+
+func runList(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "list")
+	var opts qbt.TorrentManagementInfoOptions
+	filter := fs.String("filter", string(qbt.FilterAll), "all, downloading, seeding, completed, paused, active, inactive, resumed, stalled, stalled_uploading, stalled_downloading or errored")
+	fs.Var(optionalString{&opts.Category}, "category", "only torrents in category, empty string for uncategorized")
+	fs.Var(optionalString{&opts.Tag}, "tag", "only torrents with tag")
+	fs.StringVar(&opts.Sort, "sort", "", "sort by a torrent field such as name, size, ratio or added_on")
+	fs.BoolVar(&opts.Reverse, "reverse", false, "reverse the sort order")
+	fs.Int64Var(&opts.Limit, "limit", 0, "limit the number of torrents")
+	fs.Int64Var(&opts.Offset, "offset", 0, "skip torrents, negative counts from the end")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	opts.Filter = qbt.TorrentManagementInfoFilter(*filter)
+	opts.Hashes = fs.Args()
+
+	infoList, err := c.api.TorrentManagement.Info(ctx, opts)
+	if err != nil {
+		return
+	}
+
+	t := &table{headers: []string{"hash", "name", "size", "progress", "state", "down", "up", "ratio", "eta", "category", "tags"}}
+	for _, it := range infoList {
+		name := it.Name
+		if c.format == FormatTable {
+			name = truncate(name, 50)
+		}
+		t.add(it.Hash, name, humanBytes(it.Size), percent(it.Progress), it.State,
+			humanSpeed(int64(it.DlSpeed)), humanSpeed(int64(it.UpSpeed)), fmt.Sprintf("%.2f", it.Ratio),
+			humanEta(it.Eta), it.Category, it.Tags)
+	}
+	return c.print(infoList, t)
+}
+
+func runAdd(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "add")
+	var opts qbt.TorrentManagementAddOptions
+	var tags stringList
+	var upLimit, dlLimit, seedingTimeLimit int64
+	var ratioLimit float64
+	fs.Var(optionalString{&opts.SavePath}, "save-path", "download folder")
+	fs.Var(optionalString{&opts.Cookie}, "cookie", "cookie sent to download urls")
+	fs.Var(optionalString{&opts.Category}, "category", "category")
+	fs.Var(&tags, "tags", "comma separated tags")
+	fs.BoolVar(&opts.SkipChecking, "skip-checking", false, "skip hash checking")
+	fs.BoolVar(&opts.Paused, "paused", false, "add in paused state")
+	fs.BoolVar(&opts.RootFolder, "root-folder", false, "create the root folder")
+	fs.Var(optionalString{&opts.Rename}, "rename", "rename the torrent")
+	fs.Int64Var(&upLimit, "up-limit", 0, "upload limit in bytes/second")
+	fs.Int64Var(&dlLimit, "dl-limit", 0, "download limit in bytes/second")
+	fs.Float64Var(&ratioLimit, "ratio-limit", 0, "share ratio limit")
+	fs.Int64Var(&seedingTimeLimit, "seeding-time-limit", 0, "seeding time limit in minutes")
+	fs.BoolVar(&opts.AutoTMM, "auto-tmm", false, "use automatic torrent management")
+	fs.BoolVar(&opts.SequentialDownload, "sequential", false, "download in sequential order")
+	fs.BoolVar(&opts.FirstLastPiecePrio, "first-last-piece", false, "prioritize first and last pieces")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		return errors.New("nothing to add, pass .torrent files, magnets or urls")
+	}
+
+	opts.Tags = tags
+	if flagWasSet(fs, "up-limit") {
+		opts.UPLimit = &upLimit
+	}
+	if flagWasSet(fs, "dl-limit") {
+		opts.DLLimit = &dlLimit
+	}
+	if flagWasSet(fs, "ratio-limit") {
+		opts.RatioLimit = &ratioLimit
+	}
+	if flagWasSet(fs, "seeding-time-limit") {
+		opts.SeedingTimeLimit = &seedingTimeLimit
+	}
+	opts.Urls, opts.Torrents, err = splitSources(fs.Args())
+	if err != nil {
+		return
+	}
+
+	err = c.api.TorrentManagement.Add(ctx, opts)
+	if err != nil {
+		return
+	}
+	fmt.Fprintf(c.stderr, "added %d torrent(s)\n", fs.NArg())
+	return
+}
+
+// splitSources separate magnets and urls from local .torrent files
+func splitSources(args []string) (urls, files []string, err error) {
+	for _, it := range args {
+		lower := strings.ToLower(it)
+		if strings.HasPrefix(lower, "magnet:") || strings.HasPrefix(lower, "http://") ||
+			strings.HasPrefix(lower, "https://") || strings.HasPrefix(lower, "bc://bt/") {
+			urls = append(urls, it)
+			continue
+		}
+		if _, err = os.Stat(it); err != nil {
+			return
+		}
+		files = append(files, it)
+	}
+	return
+}
+
+func runHashAction(action string) func(ctx context.Context, c *cli, args []string) error {
+	return func(ctx context.Context, c *cli, args []string) (err error) {
+		hashes, all, err := hashArgs(args)
+		if err != nil {
+			return
+		}
+		tm := c.api.TorrentManagement
+		switch action {
+		case "pause":
+			return tm.Pause(ctx, hashes, all)
+		case "resume":
+			return tm.Resume(ctx, hashes, all)
+		case "recheck":
+			return tm.Recheck(ctx, hashes, all)
+		case "reannounce":
+			return tm.Reannounce(ctx, hashes, all)
+		}
+		return fmt.Errorf("unknown action %q", action)
+	}
+}
+
+func runDelete(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "delete")
+	deleteFiles := fs.Bool("files", false, "delete downloaded data too")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	hashes, all, err := hashArgs(fs.Args())
+	if err != nil {
+		return
+	}
+	return c.api.TorrentManagement.Delete(ctx, hashes, all, *deleteFiles)
+}
+
+func singleHash(args []string) (string, error) {
+	if len(args) != 1 {
+		return "", errors.New("expected exactly one torrent hash")
+	}
+	return args[0], nil
+}
+
+func runFiles(ctx context.Context, c *cli, args []string) (err error) {
+	hash, err := singleHash(args)
+	if err != nil {
+		return
+	}
+	files, err := c.api.TorrentManagement.Files(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"index", "name", "size", "progress", "priority", "availability"}}
+	for _, it := range files {
+		t.add(it.Index, it.Name, humanBytes(it.Size), percent(it.Progress), it.Priority, fmt.Sprintf("%.2f", it.Availability))
+	}
+	return c.print(files, t)
+}
+
+func runTrackers(ctx context.Context, c *cli, args []string) (err error) {
+	hash, err := singleHash(args)
+	if err != nil {
+		return
+	}
+	trackers, err := c.api.TorrentManagement.Trackers(ctx, hash)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"tier", "url", "status", "seeds", "peers", "leeches", "downloaded", "message"}}
+	for _, it := range trackers {
+		t.add(it.Tier, it.URL, it.Status, it.NumSeeds, it.NumPeers, it.NumLeeches, it.NumDownloaded, it.Msg)
+	}
+	return c.print(trackers, t)
+}
+
+func runPeers(ctx context.Context, c *cli, args []string) (err error) {
+	hash, err := singleHash(args)
+	if err != nil {
+		return
+	}
+	resp, err := c.api.Sync.TorrentPeers(ctx, hash, 0)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"address", "client", "country", "connection", "progress", "down", "up", "flags"}}
+	for _, key := range sortedKeys(resp.Peers) {
+		it := resp.Peers[key]
+		t.add(key, it.Client, it.CountryCode, it.Connection, percent(it.Progress),
+			humanSpeed(int64(it.DlSpeed)), humanSpeed(int64(it.UpSpeed)), it.Flags)
+	}
+	return c.print(resp.Peers, t)
+}
+
+type torrentLimits struct {
+	Hash             string  `json:"hash"`
+	DownloadLimit    int     `json:"downloadLimit"`
+	UploadLimit      int     `json:"uploadLimit"`
+	RatioLimit       float64 `json:"ratioLimit"`
+	SeedingTimeLimit int     `json:"seedingTimeLimit"`
+}
+
+type globalLimits struct {
+	DownloadLimit int64 `json:"downloadLimit"`
+	UploadLimit   int64 `json:"uploadLimit"`
+}
+
+// runLimits show or set limits, global limits when no torrent is given
+func runLimits(ctx context.Context, c *cli, args []string) (err error) {
+	fs := newFlagSet(c, "limits")
+	download := fs.Int64("download", 0, "download limit in bytes/second, 0 for unlimited")
+	upload := fs.Int64("upload", 0, "upload limit in bytes/second, 0 for unlimited")
+	ratio := fs.Float64("ratio", -2, "share ratio limit, -2 use the global limit and -1 means no limit")
+	seedingTime := fs.Int64("seeding-time", -2, "seeding time limit in minutes, -2 use the global limit and -1 means no limit")
+	err = fs.Parse(args)
+	if err != nil {
+		return
+	}
+	if fs.NArg() == 0 {
+		return c.globalLimits(ctx, fs, *download, *upload)
+	}
+
+	hashes, all, err := hashArgs(fs.Args())
+	if err != nil {
+		return
+	}
+	tm := c.api.TorrentManagement
+	if flagWasSet(fs, "download") {
+		err = tm.SetDownloadLimit(ctx, hashes, all, int(*download))
+		if err != nil {
+			return
+		}
+	}
+	if flagWasSet(fs, "upload") {
+		err = tm.SetUploadLimit(ctx, hashes, all, *upload)
+		if err != nil {
+			return
+		}
+	}
+	if flagWasSet(fs, "ratio") || flagWasSet(fs, "seeding-time") {
+		err = c.setShareLimits(ctx, fs, hashes, all, *ratio, *seedingTime)
+		if err != nil {
+			return
+		}
+	}
+
+	infoList, err := tm.Info(ctx, qbt.TorrentManagementInfoOptions{Filter: qbt.FilterAll, Hashes: hashes})
+	if err != nil {
+		return
+	}
+	sort.Slice(infoList, func(i, j int) bool { return infoList[i].Hash < infoList[j].Hash })
+	var limits []torrentLimits
+	t := &table{headers: []string{"hash", "down", "up", "ratio", "seeding time"}}
+	for _, it := range infoList {
+		limits = append(limits, torrentLimits{it.Hash, it.DlLimit, it.UpLimit, it.RatioLimit, it.SeedingTimeLimit})
+		t.add(it.Hash, humanSpeed(int64(it.DlLimit)), humanSpeed(int64(it.UpLimit)), it.RatioLimit, it.SeedingTimeLimit)
+	}
+	return c.print(limits, t)
+}
+
+// setShareLimits send both share limits, setShareLimits has no way to leave one unchanged
+// so the current value of the limit whose flag was not set is sent back, grouping torrents by it
+func (c *cli) setShareLimits(ctx context.Context, fs *flag.FlagSet, hashes []string, all bool, ratio float64, seedingTime int64) (err error) {
+	tm := c.api.TorrentManagement
+	if flagWasSet(fs, "ratio") && flagWasSet(fs, "seeding-time") {
+		return tm.SetShareLimits(ctx, hashes, all, ratio, seedingTime)
+	}
+	infoList, err := tm.Info(ctx, qbt.TorrentManagementInfoOptions{Filter: qbt.FilterAll, Hashes: hashes})
+	if err != nil {
+		return
+	}
+	type limits struct {
+		ratio       float64
+		seedingTime int64
+	}
+	groups := map[limits][]string{}
+	var order []limits
+	for _, it := range infoList {
+		key := limits{ratio, seedingTime}
+		if flagWasSet(fs, "ratio") {
+			key.seedingTime = int64(it.SeedingTimeLimit)
+		} else {
+			key.ratio = it.RatioLimit
+		}
+		if _, ok := groups[key]; !ok {
+			order = append(order, key)
+		}
+		groups[key] = append(groups[key], it.Hash)
+	}
+	for _, key := range order {
+		err = tm.SetShareLimits(ctx, groups[key], false, key.ratio, key.seedingTime)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func (c *cli) globalLimits(ctx context.Context, fs *flag.FlagSet, download, upload int64) (err error) {
+	ti := c.api.TransferInfo
+	if flagWasSet(fs, "download") {
+		err = ti.SetDownloadLimit(ctx, download)
+		if err != nil {
+			return
+		}
+	}
+	if flagWasSet(fs, "upload") {
+		err = ti.SetUploadLimit(ctx, upload)
+		if err != nil {
+			return
+		}
+	}
+
+	var limits globalLimits
+	limits.DownloadLimit, err = ti.DownloadLimit(ctx)
+	if err != nil {
+		return
+	}
+	limits.UploadLimit, err = ti.UploadLimit(ctx)
+	if err != nil {
+		return
+	}
+	t := &table{headers: []string{"down", "up"}}
+	t.add(humanSpeed(limits.DownloadLimit), humanSpeed(limits.UploadLimit))
+	return c.print(limits, t)
+}
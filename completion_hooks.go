@@ -0,0 +1,382 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"text/template"
+	"time"
+)
+
+const DefaultCompletionHooksInterval = 5 * time.Second
+
+// CompletionPayload describe a finished torrent, it is the data of command templates and the webhook body
+type CompletionPayload struct {
+	Hash         string   `json:"hash"`
+	Name         string   `json:"name"`
+	ContentPath  string   `json:"contentPath"`
+	SavePath     string   `json:"savePath"`
+	Category     string   `json:"category"`
+	Tags         []string `json:"tags"`
+	Size         int64    `json:"size"`
+	CompletionOn int      `json:"completionOn"`
+}
+
+func newCompletionPayload(hash string, torrent Torrent) CompletionPayload {
+	return CompletionPayload{
+		Hash:         hash,
+		Name:         torrent.Name,
+		ContentPath:  torrent.ContentPath,
+		SavePath:     torrent.SavePath,
+		Category:     torrent.Category,
+		Tags:         SplitTags(torrent.Tags),
+		Size:         torrent.Size,
+		CompletionOn: torrent.CompletionOn,
+	}
+}
+
+// CompletionHandler process a finished torrent, an error means the hook is tried again on the next check
+type CompletionHandler interface {
+	Handle(ctx context.Context, payload CompletionPayload) error
+}
+
+type CompletionHandlerFunc func(ctx context.Context, payload CompletionPayload) error
+
+func (f CompletionHandlerFunc) Handle(ctx context.Context, payload CompletionPayload) error {
+	return f(ctx, payload)
+}
+
+// CommandHandler run a local program, every argument is a text/template executed with the CompletionPayload,
+// join is available to format the tags: {{join .Tags ","}}
+type CommandHandler struct {
+	Path string
+	Args []string
+	Dir  string
+	// Env is added to the environment of the current process
+	Env     []string
+	Timeout time.Duration
+}
+
+var completionTemplateFuncs = template.FuncMap{"join": strings.Join}
+
+func (ch *CommandHandler) args(payload CompletionPayload) (args []string, err error) {
+	for _, it := range ch.Args {
+		var tmpl *template.Template
+		tmpl, err = template.New("arg").Funcs(completionTemplateFuncs).Option("missingkey=error").Parse(it)
+		if err != nil {
+			return
+		}
+		buf := &strings.Builder{}
+		err = tmpl.Execute(buf, payload)
+		if err != nil {
+			return
+		}
+		args = append(args, buf.String())
+	}
+	return
+}
+
+func (ch *CommandHandler) Handle(ctx context.Context, payload CompletionPayload) (err error) {
+	args, err := ch.args(payload)
+	if err != nil {
+		return
+	}
+	if ch.Timeout > 0 {
+		var cancel context.CancelFunc
+		ctx, cancel = context.WithTimeout(ctx, ch.Timeout)
+		defer cancel()
+	}
+	cmd := exec.CommandContext(ctx, ch.Path, args...)
+	cmd.Dir = ch.Dir
+	if len(ch.Env) > 0 {
+		cmd.Env = append(os.Environ(), ch.Env...)
+	}
+	output, err := cmd.CombinedOutput()
+	if err != nil {
+		return fmt.Errorf("%s: %w: %s", ch.Path, err, bytes.TrimSpace(output))
+	}
+	return
+}
+
+// WebhookHandler POST the CompletionPayload as json, any status outside 2xx is an error
+type WebhookHandler struct {
+	URL    string
+	Header http.Header
+	// Client default to http.DefaultClient
+	Client *http.Client
+}
+
+func (wh *WebhookHandler) Handle(ctx context.Context, payload CompletionPayload) (err error) {
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, wh.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	for k, v := range wh.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	client := wh.Client
+	if client == nil {
+		client = http.DefaultClient
+	}
+	resp, err := client.Do(req)
+	if err != nil {
+		return
+	}
+	defer resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		return fmt.Errorf("webhook %s: %s", wh.URL, resp.Status)
+	}
+	return
+}
+
+type CompletionHook struct {
+	Name    string
+	Handler CompletionHandler
+}
+
+type CompletionHooksOptions struct {
+	Hooks []CompletionHook
+	// StatePath persist the hooks already handled for each torrent, empty keeps them in memory.
+	// A hook missing from the previous state, or every hook without one, does not handle the torrents
+	// already complete at the first check
+	StatePath string
+	// Interval default to DefaultCompletionHooksInterval
+	Interval time.Duration
+}
+
+type CompletionResult struct {
+	Hash string
+	Name string
+	Hook string
+	Err  error
+}
+
+// CompletionHooks run every hook once per finished torrent. A hook is marked handled only when it succeeded
+// and the state is saved right away, so a hook may run again after a crash but is never skipped
+type CompletionHooks struct {
+	opts    CompletionHooksOptions
+	tracker *MainDataTracker
+
+	mu sync.Mutex
+	// handled map torrent hashes to the names of the hooks that succeeded
+	handled map[string]map[string]bool
+	// baseline hold the hooks new to the state, marked handled for complete torrents at the next check
+	baseline map[string]bool
+}
+
+// completionState is the file format of StatePath, older files only have the handled map
+type completionState struct {
+	Hooks   []string            `json:"hooks"`
+	Handled map[string][]string `json:"handled"`
+}
+
+func (a *Api) NewCompletionHooks(opts CompletionHooksOptions) (hooks *CompletionHooks, err error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultCompletionHooksInterval
+	}
+	hooks = &CompletionHooks{
+		opts:     opts,
+		tracker:  a.Sync.NewMainDataTracker(opts.Interval),
+		handled:  map[string]map[string]bool{},
+		baseline: map[string]bool{},
+	}
+	// handled state is keyed by hook name
+	for i, it := range opts.Hooks {
+		if it.Name == "" {
+			return nil, fmt.Errorf("completion hook %d has no name", i+1)
+		}
+		if hooks.baseline[it.Name] {
+			return nil, fmt.Errorf("completion hook %q is declared twice", it.Name)
+		}
+		hooks.baseline[it.Name] = true
+	}
+	if opts.StatePath == "" {
+		return
+	}
+	data, err := os.ReadFile(opts.StatePath)
+	if os.IsNotExist(err) {
+		return hooks, nil
+	}
+	if err != nil {
+		return
+	}
+	var state completionState
+	err = json.Unmarshal(data, &state)
+	if err == nil && state.Hooks == nil && state.Handled == nil {
+		err = json.Unmarshal(data, &state.Handled)
+	}
+	if err != nil {
+		return nil, fmt.Errorf("completion state %s: %w", opts.StatePath, err)
+	}
+	for hash, names := range state.Handled {
+		hooks.handled[hash] = map[string]bool{}
+		for _, name := range names {
+			hooks.handled[hash][name] = true
+			// older files only know the hooks that handled a torrent
+			delete(hooks.baseline, name)
+		}
+	}
+	for _, name := range state.Hooks {
+		delete(hooks.baseline, name)
+	}
+	return
+}
+
+// isCompleteTorrent report whether the download finished and the files are in their final place
+func isCompleteTorrent(torrent Torrent) bool {
+	switch TorrentManagementInfoState(torrent.State) {
+	case InfoStateUploading, InfoStateStalledUP, InfoStateQueuedUP, InfoStateForcedUP, InfoStatePausedUP:
+		return true
+	case InfoStateMoving, InfoStateCheckingUP, InfoStateCheckingDL, InfoStateCheckingResumeData, InfoStateAllocating:
+		return false
+	}
+	return torrent.Progress >= 1
+}
+
+func (ch *CompletionHooks) save() error {
+	if ch.opts.StatePath == "" {
+		return nil
+	}
+	state := completionState{Hooks: []string{}, Handled: map[string][]string{}}
+	for _, it := range ch.opts.Hooks {
+		state.Hooks = append(state.Hooks, it.Name)
+	}
+	sort.Strings(state.Hooks)
+	for hash, names := range ch.handled {
+		for name := range names {
+			state.Handled[hash] = append(state.Handled[hash], name)
+		}
+		sort.Strings(state.Handled[hash])
+	}
+	data, err := json.MarshalIndent(state, "", "  ")
+	if err != nil {
+		return err
+	}
+	tmp, err := os.CreateTemp(filepath.Dir(ch.opts.StatePath), filepath.Base(ch.opts.StatePath)+".*")
+	if err != nil {
+		return err
+	}
+	_, err = tmp.Write(data)
+	if closeErr := tmp.Close(); err == nil {
+		err = closeErr
+	}
+	if err == nil {
+		err = os.Rename(tmp.Name(), ch.opts.StatePath)
+	}
+	if err != nil {
+		os.Remove(tmp.Name())
+	}
+	return err
+}
+
+// Check update torrents and run the pending hooks of every finished torrent
+func (ch *CompletionHooks) Check(ctx context.Context) (results []CompletionResult, err error) {
+	err = ch.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	torrents := ch.tracker.Torrents()
+
+	ch.mu.Lock()
+	defer ch.mu.Unlock()
+
+	changed := false
+	for hash := range ch.handled {
+		if _, ok := torrents[hash]; !ok {
+			delete(ch.handled, hash)
+			changed = true
+		}
+	}
+
+	var hashes []string
+	for hash, torrent := range torrents {
+		if isCompleteTorrent(torrent) {
+			hashes = append(hashes, hash)
+		}
+	}
+	sort.Strings(hashes)
+
+	if len(ch.baseline) > 0 {
+		// hooks new to the state, what is already complete finished before they existed
+		for _, hash := range hashes {
+			if ch.handled[hash] == nil {
+				ch.handled[hash] = map[string]bool{}
+			}
+			for name := range ch.baseline {
+				ch.handled[hash][name] = true
+			}
+		}
+		ch.baseline = map[string]bool{}
+		changed = true
+	}
+
+	for _, hash := range hashes {
+		torrent := torrents[hash]
+		payload := newCompletionPayload(hash, torrent)
+		for _, hook := range ch.opts.Hooks {
+			if ch.handled[hash][hook.Name] {
+				continue
+			}
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			result := CompletionResult{Hash: hash, Name: torrent.Name, Hook: hook.Name}
+			result.Err = hook.Handler.Handle(ctx, payload)
+			results = append(results, result)
+			if result.Err != nil {
+				continue
+			}
+			if ch.handled[hash] == nil {
+				ch.handled[hash] = map[string]bool{}
+			}
+			ch.handled[hash][hook.Name] = true
+			err = ch.save()
+			if err != nil {
+				return
+			}
+			changed = false
+		}
+	}
+	if changed {
+		err = ch.save()
+	}
+	return
+}
+
+// Run check every Interval until ctx is done or a check fails, onResult may be nil
+func (ch *CompletionHooks) Run(ctx context.Context, onResult func(result CompletionResult)) (err error) {
+	ticker := time.NewTicker(ch.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		var results []CompletionResult
+		results, err = ch.Check(ctx)
+		if err != nil {
+			return
+		}
+		if onResult != nil {
+			for _, it := range results {
+				onResult(it)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
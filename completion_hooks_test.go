@@ -0,0 +1,162 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"os/exec"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestCommandHandler_Args(t *testing.T) {
+	ch := &CommandHandler{Args: []string{"--name={{.Name}}", "{{.ContentPath}}", "{{join .Tags \",\"}}", "{{.Hash}}"}}
+	args, err := ch.args(newCompletionPayload("abc", Torrent{Name: "a b", ContentPath: "/data/a b", Tags: "x, y"}))
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(args, "|") != "--name=a b|/data/a b|x,y|abc" {
+		t.Fatalf("unexpected args %q", args)
+	}
+	ch.Args = []string{"{{.Missing}}"}
+	_, err = ch.args(CompletionPayload{})
+	if err == nil {
+		t.Fatal("expected an error for an unknown field")
+	}
+}
+
+func TestCompletionHooks_Check(t *testing.T) {
+	sh, err := exec.LookPath("sh")
+	if err != nil {
+		t.Skip("sh not available")
+	}
+
+	var mu sync.Mutex
+	bState, bProgress := "downloading", 0.5
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		fmt.Fprintf(w, `{"rid":1,"full_update":true,"torrents":{
+			"a":{"name":"old","progress":1,"state":"stalledUP"},
+			"b":{"name":"new","progress":%v,"state":"%s","content_path":"/data/new","tags":"tv, hd"}}}`, bProgress, bState)
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var received []CompletionPayload
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		var payload CompletionPayload
+		json.NewDecoder(r.Body).Decode(&payload)
+		received = append(received, payload)
+	}))
+	defer receiver.Close()
+
+	dir := t.TempDir()
+	out := filepath.Join(dir, "out")
+	failures := 1
+	hooks := []CompletionHook{
+		{Name: "func", Handler: CompletionHandlerFunc(func(ctx context.Context, payload CompletionPayload) error {
+			if failures > 0 {
+				failures--
+				return errors.New("not yet")
+			}
+			return nil
+		})},
+		{Name: "command", Handler: &CommandHandler{Path: sh, Args: []string{"-c", `printf '%s\n' "$1" >> "$2"`, "sh", `{{.Name}} {{.ContentPath}} {{join .Tags ","}}`, out}}},
+		{Name: "webhook", Handler: &WebhookHandler{URL: receiver.URL}},
+	}
+	state := filepath.Join(dir, "state.json")
+	ch, err := client.NewCompletionHooks(CompletionHooksOptions{Hooks: hooks, StatePath: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	// a was complete before the first check
+	results, err := ch.Check(context.Background())
+	if err != nil || len(results) != 0 {
+		t.Fatalf("unexpected baseline %v %v", results, err)
+	}
+
+	mu.Lock()
+	bState, bProgress = "uploading", 1
+	mu.Unlock()
+	results, err = ch.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(results) != 3 || results[0].Err == nil || results[1].Err != nil || results[2].Err != nil {
+		t.Fatalf("unexpected results %+v", results)
+	}
+	output, _ := os.ReadFile(out)
+	if string(output) != "new /data/new tv,hd\n" {
+		t.Fatalf("unexpected command output %q", output)
+	}
+	if len(received) != 1 || received[0].Hash != "b" || received[0].ContentPath != "/data/new" {
+		t.Fatalf("unexpected webhook %+v", received)
+	}
+
+	// only the failed hook runs again, and nothing is left once the state is reloaded
+	results, err = ch.Check(context.Background())
+	if err != nil || len(results) != 1 || results[0].Hook != "func" || results[0].Err != nil {
+		t.Fatalf("unexpected retry %+v %v", results, err)
+	}
+	ch, err = client.NewCompletionHooks(CompletionHooksOptions{Hooks: hooks, StatePath: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = ch.Check(context.Background())
+	if err != nil || len(results) != 0 {
+		t.Fatalf("unexpected results after reload %+v %v", results, err)
+	}
+
+	// a hook added later does not run for the torrents already complete
+	extra := CompletionHook{Name: "extra", Handler: CompletionHandlerFunc(func(ctx context.Context, payload CompletionPayload) error { return nil })}
+	ch, err = client.NewCompletionHooks(CompletionHooksOptions{Hooks: append(hooks, extra), StatePath: state})
+	if err != nil {
+		t.Fatal(err)
+	}
+	results, err = ch.Check(context.Background())
+	if err != nil || len(results) != 0 || !ch.handled["a"]["extra"] || !ch.handled["b"]["extra"] {
+		t.Fatalf("unexpected results for a new hook %+v %v", results, err)
+	}
+
+	// older state files only hold the handled map
+	os.WriteFile(state, []byte(`{"a":["func","command","webhook"],"b":["func","command","webhook"]}`), 0o644)
+	ch, err = client.NewCompletionHooks(CompletionHooksOptions{Hooks: append(hooks, extra), StatePath: state})
+	if err != nil || len(ch.baseline) != 1 || !ch.baseline["extra"] {
+		t.Fatalf("unexpected baseline from an old state %v %v", ch, err)
+	}
+
+	for _, it := range [][]CompletionHook{{{Handler: extra.Handler}}, {extra, extra}} {
+		_, err = client.NewCompletionHooks(CompletionHooksOptions{Hooks: it})
+		if err == nil {
+			t.Errorf("expected an error for hooks %v", it)
+		}
+	}
+}
+
+func TestCompletionHooks_Baseline(t *testing.T) {
+	ch, err := api.NewCompletionHooks(CompletionHooksOptions{Hooks: []CompletionHook{{Name: "dump", Handler: CompletionHandlerFunc(func(ctx context.Context, payload CompletionPayload) error {
+		spew.Dump(payload)
+		return nil
+	})}}})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	_, err = ch.Check(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(ch.handled)
+}
@@ -0,0 +1,274 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultDiskGuardInterval = 30 * time.Second
+
+type DiskGuardOptions struct {
+	// MinFree is the free space in bytes that must remain once every active download completes
+	MinFree int64
+	// ResumeFree is the projected free space needed before a paused torrent is resumed,
+	// default to MinFree plus 10% so torrents do not flap between paused and resumed
+	ResumeFree int64
+	// Interval default to DefaultDiskGuardInterval
+	Interval time.Duration
+	// DryRun compute the report without pausing or resuming
+	DryRun bool
+	// Mounts group torrents by the longest mount point containing their save path,
+	// torrents outside every mount point use ServerState.FreeSpaceOnDisk
+	Mounts []string
+	// FreeSpace return the free bytes of a mount point, default to LocalFreeSpace
+	// which only makes sense when the guard runs on the qBittorrent host
+	FreeSpace func(mount string) (int64, error)
+}
+
+// DiskGuardGroup is the space accounting of a mount point, the default group has an empty Mount
+type DiskGuardGroup struct {
+	Mount string
+	Free  int64
+	// Needed is the amount left of active downloads after the guard acted
+	Needed    int64
+	Projected int64
+	Paused    []string
+	Resumed   []string
+}
+
+type DiskGuardReport struct {
+	Time   time.Time
+	Groups []*DiskGuardGroup
+}
+
+func (r *DiskGuardReport) String() string {
+	var lines []string
+	for _, it := range r.Groups {
+		mount := it.Mount
+		if mount == "" {
+			mount = "default"
+		}
+		lines = append(lines, fmt.Sprintf("%s free %d needed %d projected %d paused %d resumed %d",
+			mount, it.Free, it.Needed, it.Projected, len(it.Paused), len(it.Resumed)))
+	}
+	return strings.Join(lines, "\n")
+}
+
+// DiskGuard pause downloads when the space they still need would push free space below MinFree,
+// and resume the torrents it paused itself once space recovers
+type DiskGuard struct {
+	api     *Api
+	opts    DiskGuardOptions
+	tracker *MainDataTracker
+
+	mu     sync.Mutex
+	paused map[string]bool
+}
+
+func (a *Api) NewDiskGuard(opts DiskGuardOptions) *DiskGuard {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultDiskGuardInterval
+	}
+	if opts.ResumeFree <= 0 {
+		opts.ResumeFree = opts.MinFree + opts.MinFree/10
+	}
+	if opts.FreeSpace == nil {
+		opts.FreeSpace = LocalFreeSpace
+	}
+	return &DiskGuard{
+		api:     a,
+		opts:    opts,
+		tracker: a.Sync.NewMainDataTracker(opts.Interval),
+		paused:  map[string]bool{},
+	}
+}
+
+// Paused list the torrents currently held by the guard
+func (g *DiskGuard) Paused() (hashes []string) {
+	g.mu.Lock()
+	defer g.mu.Unlock()
+	for hash := range g.paused {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	return
+}
+
+func isDownloadingState(state TorrentManagementInfoState) bool {
+	switch state {
+	case InfoStateDownloading, InfoStateStalledDL, InfoStateMetaDL, InfoStateQueuedDL, InfoStateForcedDL, InfoStateAllocating:
+		return true
+	}
+	return false
+}
+
+// mountOf return the longest mount containing path, or an empty string
+func mountOf(path string, mounts []string) (found string) {
+	path = filepath.Clean(path)
+	for _, it := range mounts {
+		mount := filepath.Clean(it)
+		if (path == mount || strings.HasPrefix(path, strings.TrimSuffix(mount, string(filepath.Separator))+string(filepath.Separator))) &&
+			len(mount) > len(found) {
+			found = mount
+		}
+	}
+	return
+}
+
+type guardTorrent struct {
+	hash    string
+	torrent Torrent
+}
+
+// queueLess order torrents from the front of the queue, position 0 means queueing is disabled and sort last
+func queueLess(a, b guardTorrent) bool {
+	pa, pb := a.torrent.Priority, b.torrent.Priority
+	if pa <= 0 {
+		pa = int(^uint(0) >> 1)
+	}
+	if pb <= 0 {
+		pb = int(^uint(0) >> 1)
+	}
+	if pa != pb {
+		return pa < pb
+	}
+	return a.hash < b.hash
+}
+
+// planGroup decide what to pause and resume in one group, active downloads at the back of the queue
+// are paused first and held torrents at the front are resumed first
+func planGroup(group *DiskGuardGroup, active, held []guardTorrent, minFree, resumeFree int64) {
+	for _, it := range active {
+		group.Needed += it.torrent.AmountLeft
+	}
+
+	sort.Slice(active, func(i, j int) bool { return queueLess(active[j], active[i]) })
+	for _, it := range active {
+		if group.Free-group.Needed >= minFree {
+			break
+		}
+		group.Paused = append(group.Paused, it.hash)
+		group.Needed -= it.torrent.AmountLeft
+	}
+
+	if len(group.Paused) == 0 {
+		sort.Slice(held, func(i, j int) bool { return queueLess(held[i], held[j]) })
+		for _, it := range held {
+			if group.Free-group.Needed-it.torrent.AmountLeft < resumeFree {
+				break
+			}
+			group.Resumed = append(group.Resumed, it.hash)
+			group.Needed += it.torrent.AmountLeft
+		}
+	}
+	group.Projected = group.Free - group.Needed
+}
+
+// Check update torrent state, pause or resume what is needed and report every group
+func (g *DiskGuard) Check(ctx context.Context) (report *DiskGuardReport, err error) {
+	err = g.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	torrents := g.tracker.Torrents()
+	serverState := g.tracker.ServerState()
+
+	g.mu.Lock()
+	defer g.mu.Unlock()
+
+	groups := map[string]bool{}
+	active := map[string][]guardTorrent{}
+	held := map[string][]guardTorrent{}
+	for hash, it := range torrents {
+		mount := mountOf(it.SavePath, g.opts.Mounts)
+		state := TorrentManagementInfoState(it.State)
+		switch {
+		case g.paused[hash] && state == InfoStatePausedDL:
+			held[mount] = append(held[mount], guardTorrent{hash, it})
+		case isDownloadingState(state):
+			// resumed by someone else or finished, the guard no longer hold it
+			delete(g.paused, hash)
+			active[mount] = append(active[mount], guardTorrent{hash, it})
+		default:
+			delete(g.paused, hash)
+			continue
+		}
+		groups[mount] = true
+	}
+	for hash := range g.paused {
+		if _, ok := torrents[hash]; !ok {
+			delete(g.paused, hash)
+		}
+	}
+
+	report = &DiskGuardReport{Time: time.Now()}
+	var mounts []string
+	for mount := range groups {
+		mounts = append(mounts, mount)
+	}
+	sort.Strings(mounts)
+
+	for _, mount := range mounts {
+		group := &DiskGuardGroup{Mount: mount, Free: serverState.FreeSpaceOnDisk}
+		if mount != "" {
+			group.Free, err = g.opts.FreeSpace(mount)
+			if err != nil {
+				err = fmt.Errorf("free space of %s: %w", mount, err)
+				return
+			}
+		}
+		planGroup(group, active[mount], held[mount], g.opts.MinFree, g.opts.ResumeFree)
+		report.Groups = append(report.Groups, group)
+
+		if g.opts.DryRun {
+			continue
+		}
+		if len(group.Paused) > 0 {
+			err = g.api.TorrentManagement.Pause(ctx, group.Paused, false)
+			if err != nil {
+				return
+			}
+			for _, hash := range group.Paused {
+				g.paused[hash] = true
+			}
+		}
+		if len(group.Resumed) > 0 {
+			err = g.api.TorrentManagement.Resume(ctx, group.Resumed, false)
+			if err != nil {
+				return
+			}
+			for _, hash := range group.Resumed {
+				delete(g.paused, hash)
+			}
+		}
+	}
+	return
+}
+
+// Run check every Interval until ctx is done or a check fails, onCheck may be nil
+func (g *DiskGuard) Run(ctx context.Context, onCheck func(report *DiskGuardReport)) (err error) {
+	ticker := time.NewTicker(g.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		var report *DiskGuardReport
+		report, err = g.Check(ctx)
+		if err != nil {
+			return
+		}
+		if onCheck != nil {
+			onCheck(report)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
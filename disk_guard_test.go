@@ -0,0 +1,134 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const gib int64 = 1 << 30
+
+func TestPlanGroup(t *testing.T) {
+	active := []guardTorrent{
+		{"first", Torrent{Priority: 1, AmountLeft: 4 * gib}},
+		{"second", Torrent{Priority: 2, AmountLeft: 3 * gib}},
+		{"last", Torrent{Priority: 3, AmountLeft: 2 * gib}},
+	}
+	group := &DiskGuardGroup{Free: 10 * gib}
+	planGroup(group, active, nil, 3*gib, 4*gib)
+	if strings.Join(group.Paused, ",") != "last" || group.Needed != 7*gib || group.Projected != 3*gib {
+		t.Fatalf("unexpected plan %+v", group)
+	}
+
+	// space recovered, the front of the queue comes back first and the hysteresis stops the rest
+	held := []guardTorrent{
+		{"last", Torrent{Priority: 3, AmountLeft: 2 * gib}},
+		{"second", Torrent{Priority: 2, AmountLeft: 3 * gib}},
+	}
+	group = &DiskGuardGroup{Free: 12 * gib}
+	planGroup(group, []guardTorrent{{"first", Torrent{Priority: 1, AmountLeft: 4 * gib}}}, held, 3*gib, 4*gib)
+	if strings.Join(group.Resumed, ",") != "second" || len(group.Paused) != 0 || group.Projected != 5*gib {
+		t.Fatalf("unexpected plan %+v", group)
+	}
+}
+
+func TestMountOf(t *testing.T) {
+	mounts := []string{"/data", "/data/media", "/mnt/usb/"}
+	cases := map[string]string{
+		"/data/downloads":    "/data",
+		"/data/media/movies": "/data/media",
+		"/database":          "",
+		"/mnt/usb":           "/mnt/usb",
+		"/home/user":         "",
+	}
+	for path, expected := range cases {
+		if got := mountOf(path, mounts); got != expected {
+			t.Errorf("mountOf(%s) = %q, want %q", path, got, expected)
+		}
+	}
+}
+
+func TestDiskGuard_Check(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	var paused = map[string]bool{}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/sync/maindata":
+			state := func(hash string) string {
+				if paused[hash] {
+					return "pausedDL"
+				}
+				return "downloading"
+			}
+			fmt.Fprintf(w, `{"rid":1,"full_update":true,"server_state":{"free_space_on_disk":%d},"torrents":{
+				"a":{"save_path":"/downloads","state":"%s","priority":1,"amount_left":%d},
+				"b":{"save_path":"/downloads","state":"%s","priority":2,"amount_left":%d},
+				"c":{"save_path":"/mnt/usb/tv","state":"%s","priority":3,"amount_left":%d},
+				"d":{"save_path":"/downloads","state":"uploading","priority":0,"amount_left":0}}}`,
+				10*gib, state("a"), 4*gib, state("b"), 4*gib, state("c"), 1*gib)
+		case "/api/v2/torrents/pause", "/api/v2/torrents/resume":
+			for _, it := range strings.Split(r.Form.Get("hashes"), "|") {
+				paused[it] = r.URL.Path == "/api/v2/torrents/pause"
+			}
+			calls = append(calls, r.URL.Path[len("/api/v2/torrents/"):]+" "+r.Form.Get("hashes"))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	usbFree := int64(2 * gib)
+	guard := client.NewDiskGuard(DiskGuardOptions{
+		MinFree: 3 * gib,
+		Mounts:  []string{"/mnt/usb"},
+		FreeSpace: func(mount string) (int64, error) {
+			if mount != "/mnt/usb" {
+				t.Errorf("unexpected mount %s", mount)
+			}
+			return usbFree, nil
+		},
+	})
+
+	report, err := guard.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(report.Groups) != 2 || report.Groups[0].Mount != "" || report.Groups[1].Mount != "/mnt/usb" {
+		t.Fatalf("unexpected groups %s", report)
+	}
+	if strings.Join(calls, ";") != "pause b;pause c" || strings.Join(guard.Paused(), ",") != "b,c" {
+		t.Fatalf("unexpected calls %v held %v", calls, guard.Paused())
+	}
+
+	// the usb disk got cleaned up, only c has room to resume
+	calls = nil
+	usbFree = 10 * gib
+	_, err = guard.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if strings.Join(calls, ";") != "resume c" || strings.Join(guard.Paused(), ",") != "b" {
+		t.Fatalf("unexpected calls %v held %v", calls, guard.Paused())
+	}
+}
+
+func TestDiskGuard_DryRun(t *testing.T) {
+	guard := api.NewDiskGuard(DiskGuardOptions{MinFree: 10 * gib, DryRun: true})
+	report, err := guard.Check(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(report)
+}
@@ -0,0 +1,13 @@
+//go:build !linux && !darwin && !freebsd
+
+package qbt_api
+
+import (
+	"errors"
+	"runtime"
+)
+
+// LocalFreeSpace is not implemented on this platform, pass DiskGuardOptions.FreeSpace instead
+func LocalFreeSpace(path string) (free int64, err error) {
+	return 0, errors.New("free space lookup is not supported on " + runtime.GOOS)
+}
@@ -0,0 +1,16 @@
+//go:build linux || darwin || freebsd
+
+package qbt_api
+
+import "syscall"
+
+// LocalFreeSpace return the bytes available to unprivileged users on the file system holding path
+func LocalFreeSpace(path string) (free int64, err error) {
+	var st syscall.Statfs_t
+	err = syscall.Statfs(path, &st)
+	if err != nil {
+		return
+	}
+	free = int64(st.Bavail) * int64(st.Bsize)
+	return
+}
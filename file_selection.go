@@ -0,0 +1,239 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strings"
+	"sync"
+	"time"
+)
+
+const DefaultFileSelectionInterval = 5 * time.Second
+
+// FileRule set Priority on the files matching every condition set
+type FileRule struct {
+	// Glob match the file path with path.Match syntax, case insensitive, against the full path
+	// and every trailing part of it so *.exe and sample/* match in any folder
+	Glob string
+	// Regexp match the full file path
+	Regexp string
+	// MinSize and MaxSize bound the file size in bytes, zero means no bound
+	MinSize int64
+	MaxSize int64
+
+	Priority TorrentManagementFilePriority
+
+	re *regexp.Regexp
+}
+
+func (fr *FileRule) match(file *TorrentManagementFile) bool {
+	if fr.MinSize > 0 && file.Size < fr.MinSize {
+		return false
+	}
+	if fr.MaxSize > 0 && file.Size > fr.MaxSize {
+		return false
+	}
+	if fr.re != nil && !fr.re.MatchString(file.Name) {
+		return false
+	}
+	if fr.Glob != "" {
+		glob := strings.ToLower(fr.Glob)
+		parts := strings.Split(strings.ToLower(file.Name), "/")
+		for i := range parts {
+			if ok, _ := path.Match(glob, strings.Join(parts[i:], "/")); ok {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// FileSelection pick file priorities by rules, the first matching rule wins
+// and files matching no rule keep their priority, build it with NewFileSelection to compile the rules
+type FileSelection struct {
+	Rules []FileRule
+}
+
+func NewFileSelection(rules ...FileRule) (selection *FileSelection, err error) {
+	selection = &FileSelection{}
+	var errs []error
+	for i, it := range rules {
+		if it.Glob != "" {
+			_, globErr := path.Match(it.Glob, "")
+			if globErr != nil {
+				errs = append(errs, fmt.Errorf("rule %d: glob %q: %w", i+1, it.Glob, globErr))
+			}
+		}
+		if it.Regexp != "" {
+			var reErr error
+			it.re, reErr = regexp.Compile(it.Regexp)
+			if reErr != nil {
+				errs = append(errs, fmt.Errorf("rule %d: %w", i+1, reErr))
+			}
+		}
+		selection.Rules = append(selection.Rules, it)
+	}
+	err = errors.Join(errs...)
+	if err != nil {
+		return nil, err
+	}
+	return
+}
+
+// Plan return the new priority of every file whose priority changes
+func (fs *FileSelection) Plan(files []*TorrentManagementFile) (priorities map[int]TorrentManagementFilePriority) {
+	priorities = map[int]TorrentManagementFilePriority{}
+	for _, file := range files {
+		for i := range fs.Rules {
+			if !fs.Rules[i].match(file) {
+				continue
+			}
+			if file.Priority != fs.Rules[i].Priority {
+				priorities[file.Index] = fs.Rules[i].Priority
+			}
+			break
+		}
+	}
+	return
+}
+
+// ApplyFileSelection set file priorities of every torrent, with one filePrio call per priority and torrent,
+// changes map torrent hashes to the priorities set
+func (tm *TorrentManagement) ApplyFileSelection(ctx context.Context, hashes []string, selection *FileSelection, dryRun bool) (changes map[string]map[int]TorrentManagementFilePriority, err error) {
+	changes = map[string]map[int]TorrentManagementFilePriority{}
+	for _, hash := range hashes {
+		var files []*TorrentManagementFile
+		files, err = tm.Files(ctx, hash, nil)
+		if err != nil {
+			return
+		}
+		priorities := selection.Plan(files)
+		if len(priorities) == 0 {
+			continue
+		}
+		changes[hash] = priorities
+		if dryRun {
+			continue
+		}
+		err = tm.SetFilePriorities(ctx, hash, priorities)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// FileSelectionWatcher apply a selection to torrents added after its first check, as soon as their metadata arrived
+type FileSelectionWatcher struct {
+	api       *Api
+	selection *FileSelection
+	tracker   *MainDataTracker
+	interval  time.Duration
+
+	mu      sync.Mutex
+	started bool
+	// pending hold the new torrents still waiting for metadata
+	pending map[string]bool
+	known   map[string]bool
+}
+
+// NewFileSelectionWatcher interval below or equal zero means DefaultFileSelectionInterval
+func (a *Api) NewFileSelectionWatcher(selection *FileSelection, interval time.Duration) *FileSelectionWatcher {
+	if interval <= 0 {
+		interval = DefaultFileSelectionInterval
+	}
+	return &FileSelectionWatcher{
+		api:       a,
+		selection: selection,
+		tracker:   a.Sync.NewMainDataTracker(interval),
+		interval:  interval,
+		pending:   map[string]bool{},
+		known:     map[string]bool{},
+	}
+}
+
+// Check apply the selection to the new torrents whose metadata arrived and return the changes
+func (fw *FileSelectionWatcher) Check(ctx context.Context) (changes map[string]map[int]TorrentManagementFilePriority, err error) {
+	err = fw.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	torrents := fw.tracker.Torrents()
+
+	fw.mu.Lock()
+	defer fw.mu.Unlock()
+
+	for hash := range torrents {
+		if !fw.known[hash] {
+			fw.known[hash] = true
+			if fw.started {
+				fw.pending[hash] = true
+			}
+		}
+	}
+	for hash := range fw.known {
+		if _, ok := torrents[hash]; !ok {
+			delete(fw.known, hash)
+			delete(fw.pending, hash)
+		}
+	}
+	fw.started = true
+
+	var ready []string
+	for hash := range fw.pending {
+		if TorrentManagementInfoState(torrents[hash].State) != InfoStateMetaDL {
+			ready = append(ready, hash)
+		}
+	}
+	sort.Strings(ready)
+
+	changes = map[string]map[int]TorrentManagementFilePriority{}
+	for _, hash := range ready {
+		var files []*TorrentManagementFile
+		files, err = fw.api.TorrentManagement.Files(ctx, hash, nil)
+		if err != nil {
+			return
+		}
+		if len(files) == 0 {
+			continue
+		}
+		priorities := fw.selection.Plan(files)
+		if len(priorities) > 0 {
+			err = fw.api.TorrentManagement.SetFilePriorities(ctx, hash, priorities)
+			if err != nil {
+				return
+			}
+			changes[hash] = priorities
+		}
+		delete(fw.pending, hash)
+	}
+	return
+}
+
+// Run check every interval until ctx is done or a check fails, onCheck may be nil
+func (fw *FileSelectionWatcher) Run(ctx context.Context, onCheck func(changes map[string]map[int]TorrentManagementFilePriority)) (err error) {
+	ticker := time.NewTicker(fw.interval)
+	defer ticker.Stop()
+
+	for {
+		var changes map[string]map[int]TorrentManagementFilePriority
+		changes, err = fw.Check(ctx)
+		if err != nil {
+			return
+		}
+		if onCheck != nil && len(changes) > 0 {
+			onCheck(changes)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,132 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const mib = 1 << 20
+
+var testFiles = []*TorrentManagementFile{
+	{Index: 0, Name: "Movie/Movie.mkv", Size: 4000 * mib, Priority: FilePriorityNormal},
+	{Index: 1, Name: "Movie/Sample/movie-sample.mkv", Size: 30 * mib, Priority: FilePriorityNormal},
+	{Index: 2, Name: "Movie/Movie.nfo", Size: 1024, Priority: FilePriorityNormal},
+	{Index: 3, Name: "Movie/Setup.EXE", Size: 80 * mib, Priority: FilePriorityNormal},
+	{Index: 4, Name: "Movie/Subs/English.srt", Size: 100 * 1024, Priority: FilePriorityNormal},
+	{Index: 5, Name: "Movie/Subs/French.srt", Size: 100 * 1024, Priority: FilePriorityNormal},
+	{Index: 6, Name: "Movie/Extras/Interview.mkv", Size: 700 * mib, Priority: FilePriorityHigh},
+}
+
+func testFileSelection(t *testing.T) *FileSelection {
+	selection, err := NewFileSelection(
+		FileRule{Glob: "*.exe", Priority: FilePriorityNotDownloaded},
+		FileRule{Glob: "sample/*", Priority: FilePriorityNotDownloaded},
+		FileRule{Regexp: `(?i)subs/english\.srt$`, Priority: FilePriorityNormal},
+		FileRule{Glob: "*.srt", Priority: FilePriorityNotDownloaded},
+		FileRule{Glob: "*.mkv", MinSize: 50 * mib, Priority: FilePriorityHigh},
+		FileRule{MaxSize: 50 * mib, Priority: FilePriorityNotDownloaded},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return selection
+}
+
+func TestFileSelection_Plan(t *testing.T) {
+	priorities := testFileSelection(t).Plan(testFiles)
+	expected := map[int]TorrentManagementFilePriority{0: FilePriorityHigh, 1: FilePriorityNotDownloaded, 2: FilePriorityNotDownloaded, 3: FilePriorityNotDownloaded, 5: FilePriorityNotDownloaded}
+	if fmt.Sprint(priorities) != fmt.Sprint(expected) {
+		t.Fatalf("unexpected priorities %v", priorities)
+	}
+
+	_, err := NewFileSelection(FileRule{Glob: "[a"}, FileRule{Regexp: "("})
+	if err == nil || !strings.Contains(err.Error(), "rule 1") || !strings.Contains(err.Error(), "rule 2") {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestFileSelectionWatcher_Check(t *testing.T) {
+	var mu sync.Mutex
+	state := map[string]string{"old": "downloading"}
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/sync/maindata":
+			var items []string
+			for hash, it := range state {
+				items = append(items, fmt.Sprintf(`"%s":{"state":"%s"}`, hash, it))
+			}
+			fmt.Fprintf(w, `{"rid":1,"full_update":true,"torrents":{%s}}`, strings.Join(items, ","))
+		case "/api/v2/torrents/files":
+			if state[r.Form.Get("hash")] == "metaDL" {
+				w.Write([]byte(`[]`))
+				return
+			}
+			w.Write([]byte(`[{"index":0,"name":"a/a.mkv","size":104857600,"priority":1},{"index":1,"name":"a/a.nfo","size":10,"priority":1},{"index":2,"name":"a/b.txt","size":10,"priority":1}]`))
+		case "/api/v2/torrents/filePrio":
+			calls = append(calls, r.Form.Get("hash")+" "+r.Form.Get("id")+"="+r.Form.Get("priority"))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	fw := client.NewFileSelectionWatcher(testFileSelection(t), 0)
+	check := func() map[string]map[int]TorrentManagementFilePriority {
+		changes, err := fw.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		return changes
+	}
+	// torrents present before the first check are left alone
+	if changes := check(); len(changes) != 0 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	mu.Lock()
+	state["new"] = "metaDL"
+	mu.Unlock()
+	if changes := check(); len(changes) != 0 {
+		t.Fatalf("changes before metadata %v", changes)
+	}
+	mu.Lock()
+	state["new"] = "stalledDL"
+	mu.Unlock()
+	if changes := check(); len(changes["new"]) != 3 {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+	if changes := check(); len(changes) != 0 {
+		t.Fatalf("selection applied twice %v", changes)
+	}
+	if strings.Join(calls, ",") != "new 1|2=0,new 0=6" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestTorrentManagement_ApplyFileSelection(t *testing.T) {
+	infoList, err := api.TorrentManagement.Info(context.Background(), TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	var hashes []string
+	for _, it := range infoList {
+		hashes = append(hashes, it.Hash)
+	}
+	changes, err := api.TorrentManagement.ApplyFileSelection(context.Background(), hashes, testFileSelection(t), true)
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(changes)
+}
@@ -3,3 +3,10 @@ module github.com/evrins/qbt-api
 go 1.20
 
 require github.com/davecgh/go-spew v1.1.1
+
+require (
+	golang.org/x/term v0.15.0
+	gopkg.in/yaml.v3 v3.0.1
+)
+
+require golang.org/x/sys v0.15.0 // indirect
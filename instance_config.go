@@ -0,0 +1,389 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"os"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+// InstanceConfig describe the managed parts of a qBittorrent instance, nil sections are left untouched
+type InstanceConfig struct {
+	// Preferences is a subset of preferences keyed by their json name such as listen_port
+	Preferences   map[string]any            `json:"preferences,omitempty" yaml:"preferences,omitempty"`
+	Categories    map[string]CategoryConfig `json:"categories,omitempty" yaml:"categories,omitempty"`
+	Tags          []string                  `json:"tags,omitempty" yaml:"tags,omitempty"`
+	Rss           *RssConfig                `json:"rss,omitempty" yaml:"rss,omitempty"`
+	SearchPlugins []PluginSpec              `json:"searchPlugins,omitempty" yaml:"searchPlugins,omitempty"`
+	SpeedLimits   *SpeedLimitsConfig        `json:"speedLimits,omitempty" yaml:"speedLimits,omitempty"`
+}
+
+type CategoryConfig struct {
+	SavePath string `json:"savePath" yaml:"savePath"`
+}
+
+// SpeedLimitsConfig hold global limits in bytes/second, zero means no limit and nil means unmanaged
+type SpeedLimitsConfig struct {
+	Download *int64 `json:"download,omitempty" yaml:"download,omitempty"`
+	Upload   *int64 `json:"upload,omitempty" yaml:"upload,omitempty"`
+}
+
+// LoadInstanceConfig read a yaml or json file
+func LoadInstanceConfig(path string) (cfg *InstanceConfig, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	cfg = &InstanceConfig{}
+	err = yaml.Unmarshal(content, cfg)
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+// InstancePlan is the minimal set of calls turning an instance into its InstanceConfig
+type InstancePlan struct {
+	Preferences      []PreferenceChange
+	CreateCategories []Category
+	EditCategories   []Category
+	RemoveCategories []string
+	CreateTags       []string
+	DeleteTags       []string
+	DownloadLimit    *int64
+	UploadLimit      *int64
+	Rss              []RssAction
+	Plugins          *PluginPlan
+}
+
+func (ip *InstancePlan) Empty() bool {
+	return len(ip.Preferences) == 0 && len(ip.CreateCategories) == 0 && len(ip.EditCategories) == 0 &&
+		len(ip.RemoveCategories) == 0 && len(ip.CreateTags) == 0 && len(ip.DeleteTags) == 0 &&
+		ip.DownloadLimit == nil && ip.UploadLimit == nil && len(ip.Rss) == 0 && (ip.Plugins == nil || ip.Plugins.Empty())
+}
+
+func (ip *InstancePlan) String() string {
+	var lines []string
+	for _, it := range ip.Preferences {
+		lines = append(lines, "set preference "+it.String())
+	}
+	for _, it := range ip.CreateCategories {
+		lines = append(lines, fmt.Sprintf("create category %s save path %q", it.Name, it.SavePath))
+	}
+	for _, it := range ip.EditCategories {
+		lines = append(lines, fmt.Sprintf("edit category %s save path %q", it.Name, it.SavePath))
+	}
+	for _, it := range ip.RemoveCategories {
+		lines = append(lines, "remove category "+it)
+	}
+	for _, it := range ip.CreateTags {
+		lines = append(lines, "create tag "+it)
+	}
+	for _, it := range ip.DeleteTags {
+		lines = append(lines, "delete tag "+it)
+	}
+	if ip.DownloadLimit != nil {
+		lines = append(lines, fmt.Sprintf("set download limit %d", *ip.DownloadLimit))
+	}
+	if ip.UploadLimit != nil {
+		lines = append(lines, fmt.Sprintf("set upload limit %d", *ip.UploadLimit))
+	}
+	for _, it := range ip.Rss {
+		lines = append(lines, "rss "+it.String())
+	}
+	if ip.Plugins != nil && !ip.Plugins.Empty() {
+		for _, it := range strings.Split(ip.Plugins.String(), "\n") {
+			lines = append(lines, "search plugin "+it)
+		}
+	}
+	if len(lines) == 0 {
+		return "nothing to do"
+	}
+	return strings.Join(lines, "\n")
+}
+
+type ReconcileOptions struct {
+	// Prune remove categories, tags, rss items, rules and search plugins missing from managed sections
+	Prune bool
+	// DryRun only compute the plan
+	DryRun bool
+}
+
+// Reconcile read the current state of every managed section, compute a plan and apply it unless DryRun
+func (a *Api) Reconcile(ctx context.Context, cfg *InstanceConfig, opts ReconcileOptions) (plan *InstancePlan, err error) {
+	plan, err = a.PlanInstance(ctx, cfg, opts.Prune)
+	if err != nil || opts.DryRun {
+		return
+	}
+	err = a.ApplyInstancePlan(ctx, plan)
+	return
+}
+
+func (a *Api) PlanInstance(ctx context.Context, cfg *InstanceConfig, prune bool) (plan *InstancePlan, err error) {
+	plan = &InstancePlan{}
+
+	if len(cfg.Preferences) > 0 {
+		var current *Preferences
+		current, err = a.App.Preferences(ctx)
+		if err != nil {
+			return
+		}
+		plan.Preferences, err = planPreferences(current, cfg.Preferences)
+		if err != nil {
+			return
+		}
+	}
+
+	if cfg.Categories != nil {
+		var current CategoryResponse
+		current, err = a.TorrentManagement.Categories(ctx)
+		if err != nil {
+			return
+		}
+		planCategories(plan, current, cfg.Categories, prune)
+	}
+
+	if cfg.Tags != nil {
+		var current []string
+		current, err = a.TorrentManagement.Tags(ctx)
+		if err != nil {
+			return
+		}
+		plan.CreateTags, plan.DeleteTags = planTags(current, cfg.Tags, prune)
+	}
+
+	if cfg.SpeedLimits != nil {
+		err = a.planSpeedLimits(ctx, plan, cfg.SpeedLimits)
+		if err != nil {
+			return
+		}
+	}
+
+	if cfg.Rss != nil {
+		var tree *RssTree
+		tree, err = a.Rss.Items(ctx, false)
+		if err != nil {
+			return
+		}
+		var rules RulesResponse
+		rules, err = a.Rss.Rules(ctx)
+		if err != nil {
+			return
+		}
+		plan.Rss = PlanRssImport(tree, rules, cfg.Rss, prune)
+	}
+
+	if cfg.SearchPlugins != nil {
+		var installed PluginsResponse
+		installed, err = a.Search.Plugins(ctx)
+		if err != nil {
+			return
+		}
+		plan.Plugins = PlanPlugins(installed, cfg.SearchPlugins, prune)
+	}
+	return
+}
+
+// planPreferences overlay desired keys on current preferences, validate the desired keys against the result
+// and keep the keys that change, invalid values already on the server for other keys are left alone
+func planPreferences(current *Preferences, desired map[string]any) (changes []PreferenceChange, err error) {
+	fields, err := preferencesFields(current)
+	if err != nil {
+		return
+	}
+
+	var keys []string
+	for key := range desired {
+		if _, ok := fields[key]; !ok {
+			err = fmt.Errorf("unknown preference %q", key)
+			return
+		}
+		keys = append(keys, key)
+	}
+	sort.Strings(keys)
+
+	merged := map[string]json.RawMessage{}
+	for key, value := range fields {
+		merged[key] = value
+	}
+	for _, key := range keys {
+		var value json.RawMessage
+		value, err = json.Marshal(desired[key])
+		if err != nil {
+			return
+		}
+		if !equalJSON(fields[key], value) {
+			changes = append(changes, PreferenceChange{Key: key, Old: fields[key], New: value})
+		}
+		merged[key] = value
+	}
+
+	content, err := json.Marshal(merged)
+	if err != nil {
+		return
+	}
+	var pref Preferences
+	err = json.Unmarshal(content, &pref)
+	if err != nil {
+		return
+	}
+	validated := make(map[string]bool, len(keys))
+	for _, key := range keys {
+		validated[key] = true
+	}
+	err = validatePreferenceKeys(&pref, validated)
+	return
+}
+
+func equalJSON(a, b json.RawMessage) bool {
+	var x, y any
+	if json.Unmarshal(a, &x) != nil || json.Unmarshal(b, &y) != nil {
+		return false
+	}
+	return reflect.DeepEqual(x, y)
+}
+
+func planCategories(plan *InstancePlan, current CategoryResponse, desired map[string]CategoryConfig, prune bool) {
+	var names []string
+	for name := range desired {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		category := Category{Name: name, SavePath: desired[name].SavePath}
+		existing, ok := current[name]
+		if !ok {
+			plan.CreateCategories = append(plan.CreateCategories, category)
+		} else if existing.SavePath != category.SavePath {
+			plan.EditCategories = append(plan.EditCategories, category)
+		}
+	}
+
+	if !prune {
+		return
+	}
+	for name := range current {
+		if _, ok := desired[name]; !ok {
+			plan.RemoveCategories = append(plan.RemoveCategories, name)
+		}
+	}
+	sort.Strings(plan.RemoveCategories)
+}
+
+func planTags(current, desired []string, prune bool) (create, remove []string) {
+	existing := map[string]bool{}
+	for _, it := range current {
+		existing[it] = true
+	}
+	wanted := map[string]bool{}
+	for _, it := range desired {
+		wanted[it] = true
+		if !existing[it] {
+			create = append(create, it)
+		}
+	}
+	if prune {
+		for _, it := range current {
+			if !wanted[it] {
+				remove = append(remove, it)
+			}
+		}
+	}
+	return
+}
+
+func (a *Api) planSpeedLimits(ctx context.Context, plan *InstancePlan, desired *SpeedLimitsConfig) (err error) {
+	if desired.Download != nil {
+		var limit int64
+		limit, err = a.TransferInfo.DownloadLimit(ctx)
+		if err != nil {
+			return
+		}
+		if limit != *desired.Download {
+			plan.DownloadLimit = desired.Download
+		}
+	}
+	if desired.Upload != nil {
+		var limit int64
+		limit, err = a.TransferInfo.UploadLimit(ctx)
+		if err != nil {
+			return
+		}
+		if limit != *desired.Upload {
+			plan.UploadLimit = desired.Upload
+		}
+	}
+	return
+}
+
+func (a *Api) ApplyInstancePlan(ctx context.Context, plan *InstancePlan) (err error) {
+	if len(plan.Preferences) > 0 {
+		values := map[string]any{}
+		for _, it := range plan.Preferences {
+			values[it.Key] = it.New
+		}
+		err = a.App.SetPreferenceValues(ctx, values)
+		if err != nil {
+			return
+		}
+	}
+
+	for i := range plan.CreateCategories {
+		err = a.TorrentManagement.CreateCategory(ctx, &plan.CreateCategories[i])
+		if err != nil {
+			return
+		}
+	}
+	for i := range plan.EditCategories {
+		err = a.TorrentManagement.EditCategory(ctx, &plan.EditCategories[i])
+		if err != nil {
+			return
+		}
+	}
+	if len(plan.RemoveCategories) > 0 {
+		err = a.TorrentManagement.RemoveCategories(ctx, plan.RemoveCategories)
+		if err != nil {
+			return
+		}
+	}
+
+	if len(plan.CreateTags) > 0 {
+		err = a.TorrentManagement.CreateTags(ctx, plan.CreateTags)
+		if err != nil {
+			return
+		}
+	}
+	if len(plan.DeleteTags) > 0 {
+		err = a.TorrentManagement.DeleteTags(ctx, plan.DeleteTags)
+		if err != nil {
+			return
+		}
+	}
+
+	if plan.DownloadLimit != nil {
+		err = a.TransferInfo.SetDownloadLimit(ctx, *plan.DownloadLimit)
+		if err != nil {
+			return
+		}
+	}
+	if plan.UploadLimit != nil {
+		err = a.TransferInfo.SetUploadLimit(ctx, *plan.UploadLimit)
+		if err != nil {
+			return
+		}
+	}
+
+	err = a.Rss.ApplyActions(ctx, plan.Rss)
+	if err != nil {
+		return
+	}
+
+	if plan.Plugins != nil && !plan.Plugins.Empty() {
+		err = a.Search.ApplyPluginPlan(ctx, plan.Plugins)
+	}
+	return
+}
@@ -0,0 +1,130 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const instanceConfigYAML = `
+preferences:
+  listen_port: 51413
+  save_path: /downloads
+categories:
+  movies:
+    savePath: /downloads/movies
+  tv:
+    savePath: /downloads/tv
+tags: [keep, private]
+speedLimits:
+  download: 0
+  upload: 1048576
+`
+
+func TestApi_Reconcile(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/app/preferences":
+			json.NewEncoder(w).Encode(Preferences{ListenPort: 6881, SavePath: "/downloads", WebUIPort: 8080, ProxyType: ProxyDisabled})
+		case "/api/v2/torrents/categories":
+			w.Write([]byte(`{"movies":{"name":"movies","savePath":"/data/movies"},"old":{"name":"old","savePath":""}}`))
+		case "/api/v2/torrents/tags":
+			w.Write([]byte(`["keep","stale"]`))
+		case "/api/v2/transfer/downloadLimit":
+			w.Write([]byte(`0`))
+		case "/api/v2/transfer/uploadLimit":
+			w.Write([]byte(`0`))
+		default:
+			calls = append(calls, r.URL.Path[len("/api/v2/"):]+" "+r.Form.Encode())
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	path := filepath.Join(t.TempDir(), "instance.yaml")
+	err = os.WriteFile(path, []byte(instanceConfigYAML), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg, err := LoadInstanceConfig(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	plan, err := client.Reconcile(context.Background(), cfg, ReconcileOptions{Prune: true, DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(calls) != 0 {
+		t.Fatalf("dry run made calls %v", calls)
+	}
+	expected := strings.Join([]string{
+		`set preference listen_port: 6881 -> 51413`,
+		`create category tv save path "/downloads/tv"`,
+		`edit category movies save path "/downloads/movies"`,
+		`remove category old`,
+		`create tag private`,
+		`delete tag stale`,
+		`set upload limit 1048576`,
+	}, "\n")
+	if plan.String() != expected {
+		t.Fatalf("unexpected plan\n%s", plan)
+	}
+
+	_, err = client.Reconcile(context.Background(), cfg, ReconcileOptions{Prune: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(calls)
+	if len(calls) != 7 || calls[0] != "app/setPreferences json=%7B%22listen_port%22%3A51413%7D" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestPlanPreferences_Invalid(t *testing.T) {
+	_, err := planPreferences(&Preferences{WebUIPort: 8080, ProxyType: ProxyDisabled}, map[string]any{"encryption": 7})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	_, err = planPreferences(&Preferences{}, map[string]any{"no_such_key": 1})
+	if err == nil {
+		t.Fatal("expected unknown key error")
+	}
+	// web_ui_port 0 is invalid but already on the server, it must not block an unrelated key
+	changes, err := planPreferences(&Preferences{WebUIPort: 0, Encryption: 0}, map[string]any{"encryption": 1})
+	if err != nil || len(changes) != 1 {
+		t.Fatalf("unexpected plan %v %v", changes, err)
+	}
+	_, err = planPreferences(&Preferences{OutgoingPortsMin: 100, OutgoingPortsMax: 200}, map[string]any{"outgoing_ports_max": 50})
+	if err == nil {
+		t.Fatal("expected a range error involving the desired key")
+	}
+}
+
+func TestApi_PlanInstance(t *testing.T) {
+	var limit int64 = 0
+	plan, err := api.PlanInstance(context.Background(), &InstanceConfig{
+		Preferences: map[string]any{"listen_port": 6881},
+		Tags:        []string{"111"},
+		SpeedLimits: &SpeedLimitsConfig{Download: &limit},
+	}, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(plan)
+}
@@ -0,0 +1,229 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+const DefaultMainDataTrackerInterval = 2 * time.Second
+
+type mainDataDiff struct {
+	Rid               int64                      `json:"rid"`
+	FullUpdate        bool                       `json:"full_update"`
+	Torrents          map[string]json.RawMessage `json:"torrents"`
+	TorrentsRemoved   []string                   `json:"torrents_removed"`
+	Categories        map[string]json.RawMessage `json:"categories"`
+	CategoriesRemoved []string                   `json:"categories_removed"`
+	Tags              []string                   `json:"tags"`
+	TagsRemoved       []string                   `json:"tags_removed"`
+	ServerState       json.RawMessage            `json:"server_state"`
+	Trackers          map[string][]string        `json:"trackers"`
+	TrackersRemoved   []string                   `json:"trackers_removed"`
+}
+
+// MainDataTracker keeps a full copy of sync/maindata by polling with the last rid
+// and merging the partial updates, only changed fields are sent by the server
+type MainDataTracker struct {
+	api      *Api
+	interval time.Duration
+
+	mu          sync.RWMutex
+	rid         int64
+	torrents    map[string]Torrent
+	categories  map[string]Category
+	tags        map[string]bool
+	serverState ServerState
+	trackers    map[string][]string
+}
+
+// NewMainDataTracker interval below or equal zero means DefaultMainDataTrackerInterval
+func (s *Sync) NewMainDataTracker(interval time.Duration) *MainDataTracker {
+	if interval <= 0 {
+		interval = DefaultMainDataTrackerInterval
+	}
+	return &MainDataTracker{
+		api:        s.api,
+		interval:   interval,
+		torrents:   map[string]Torrent{},
+		categories: map[string]Category{},
+		tags:       map[string]bool{},
+		trackers:   map[string][]string{},
+	}
+}
+
+func (s *Sync) mainDataDiff(ctx context.Context, rid int64) (diff *mainDataDiff, err error) {
+	path := "/api/v2/sync/maindata"
+	query := url.Values{}
+	query.Set("rid", strconv.FormatInt(rid, 10))
+
+	err = s.api.doRequest(ctx, http.MethodGet, path, query, nil, &diff)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// Update fetch changes since last update and merge them
+func (mt *MainDataTracker) Update(ctx context.Context) (err error) {
+	mt.mu.RLock()
+	rid := mt.rid
+	mt.mu.RUnlock()
+
+	diff, err := mt.api.Sync.mainDataDiff(ctx, rid)
+	if err != nil {
+		return
+	}
+	return mt.apply(diff)
+}
+
+func (mt *MainDataTracker) apply(diff *mainDataDiff) (err error) {
+	mt.mu.Lock()
+	defer mt.mu.Unlock()
+
+	if diff.FullUpdate {
+		mt.torrents = map[string]Torrent{}
+		mt.categories = map[string]Category{}
+		mt.tags = map[string]bool{}
+		mt.serverState = ServerState{}
+		mt.trackers = map[string][]string{}
+	}
+
+	for hash, raw := range diff.Torrents {
+		torrent := mt.torrents[hash]
+		err = json.Unmarshal(raw, &torrent)
+		if err != nil {
+			return
+		}
+		mt.torrents[hash] = torrent
+	}
+	for _, hash := range diff.TorrentsRemoved {
+		delete(mt.torrents, hash)
+	}
+
+	for name, raw := range diff.Categories {
+		category := mt.categories[name]
+		err = json.Unmarshal(raw, &category)
+		if err != nil {
+			return
+		}
+		mt.categories[name] = category
+	}
+	for _, name := range diff.CategoriesRemoved {
+		delete(mt.categories, name)
+	}
+
+	for _, tag := range diff.Tags {
+		mt.tags[tag] = true
+	}
+	for _, tag := range diff.TagsRemoved {
+		delete(mt.tags, tag)
+	}
+
+	if len(diff.ServerState) > 0 {
+		err = json.Unmarshal(diff.ServerState, &mt.serverState)
+		if err != nil {
+			return
+		}
+	}
+
+	for tracker, hashes := range diff.Trackers {
+		mt.trackers[tracker] = hashes
+	}
+	for _, tracker := range diff.TrackersRemoved {
+		delete(mt.trackers, tracker)
+	}
+
+	mt.rid = diff.Rid
+	return
+}
+
+// Run poll until ctx is done or a request fails, onUpdate is called after each successful merge and may be nil
+func (mt *MainDataTracker) Run(ctx context.Context, onUpdate func(mt *MainDataTracker)) (err error) {
+	ticker := time.NewTicker(mt.interval)
+	defer ticker.Stop()
+
+	for {
+		err = mt.Update(ctx)
+		if err != nil {
+			return
+		}
+		if onUpdate != nil {
+			onUpdate(mt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (mt *MainDataTracker) Rid() int64 {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	return mt.rid
+}
+
+// Torrents return a copy of current torrents keyed by hash
+func (mt *MainDataTracker) Torrents() map[string]Torrent {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	torrents := make(map[string]Torrent, len(mt.torrents))
+	for k, v := range mt.torrents {
+		torrents[k] = v
+	}
+	return torrents
+}
+
+func (mt *MainDataTracker) Torrent(hash string) (torrent Torrent, ok bool) {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	torrent, ok = mt.torrents[hash]
+	return
+}
+
+func (mt *MainDataTracker) Categories() map[string]Category {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	categories := make(map[string]Category, len(mt.categories))
+	for k, v := range mt.categories {
+		categories[k] = v
+	}
+	return categories
+}
+
+func (mt *MainDataTracker) Tags() (tags []string) {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	for tag := range mt.tags {
+		tags = append(tags, tag)
+	}
+	return
+}
+
+func (mt *MainDataTracker) ServerState() ServerState {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+	return mt.serverState
+}
+
+// Trackers return tracker urls mapped to the hashes of torrents using them
+func (mt *MainDataTracker) Trackers() map[string][]string {
+	mt.mu.RLock()
+	defer mt.mu.RUnlock()
+
+	trackers := make(map[string][]string, len(mt.trackers))
+	for k, v := range mt.trackers {
+		trackers[k] = append([]string{}, v...)
+	}
+	return trackers
+}
@@ -0,0 +1,94 @@
+package qbt_api
+
+import (
+	"context"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestMainDataTracker_Merge(t *testing.T) {
+	responses := []string{
+		`{"rid":1,"full_update":true,
+			"torrents":{
+				"aaaa":{"name":"debian.iso","state":"downloading","dlspeed":100,"progress":0.25,"category":"linux"},
+				"bbbb":{"name":"arch.iso","state":"uploading","ratio":1.5}},
+			"categories":{"linux":{"name":"linux","savePath":"/data/linux"}},
+			"tags":["iso","keep"],
+			"server_state":{"connection_status":"connected","dl_info_speed":100,"dht_nodes":300},
+			"trackers":{"http://tracker/announce":["aaaa","bbbb"]}}`,
+		`{"rid":2,
+			"torrents":{"aaaa":{"dlspeed":500,"progress":0.5}},
+			"torrents_removed":["bbbb"],
+			"tags_removed":["keep"],
+			"server_state":{"dl_info_speed":500},
+			"trackers":{"http://tracker/announce":["aaaa"]}}`,
+	}
+	var call = 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Query().Get("rid") != []string{"0", "1"}[call] {
+			t.Errorf("unexpected rid %s", r.URL.Query().Get("rid"))
+		}
+		w.Write([]byte(responses[call]))
+		call += 1
+	}))
+	defer srv.Close()
+
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	mt := client.Sync.NewMainDataTracker(time.Millisecond)
+	for range responses {
+		err = mt.Update(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+	}
+
+	if mt.Rid() != 2 {
+		t.Fatalf("unexpected rid %d", mt.Rid())
+	}
+	torrents := mt.Torrents()
+	torrent, ok := torrents["aaaa"]
+	if len(torrents) != 1 || !ok {
+		t.Fatalf("unexpected torrents %v", torrents)
+	}
+	if torrent.Dlspeed != 500 || torrent.Progress != 0.5 || torrent.Name != "debian.iso" || torrent.Category != "linux" {
+		t.Fatalf("partial update not merged %+v", torrent)
+	}
+
+	state := mt.ServerState()
+	if state.DlInfoSpeed != 500 || state.ConnectionStatus != "connected" || state.DhtNodes != 300 {
+		t.Fatalf("server state not merged %+v", state)
+	}
+	tags := mt.Tags()
+	sort.Strings(tags)
+	if strings.Join(tags, ",") != "iso" {
+		t.Fatalf("unexpected tags %v", tags)
+	}
+	if mt.Categories()["linux"].SavePath != "/data/linux" {
+		t.Fatalf("unexpected categories %v", mt.Categories())
+	}
+	if hashes := mt.Trackers()["http://tracker/announce"]; len(hashes) != 1 {
+		t.Fatalf("unexpected trackers %v", mt.Trackers())
+	}
+}
+
+func TestMainDataTracker_Update(t *testing.T) {
+	mt := api.Sync.NewMainDataTracker(0)
+	err := mt.Update(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	err = mt.Update(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(mt.Rid(), mt.ServerState(), len(mt.Torrents()))
+}
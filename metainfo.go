@@ -0,0 +1,227 @@
+package qbt_api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"net/url"
+	"os"
+	"strconv"
+	"strings"
+)
+
+// Metainfo is the part of a .torrent file needed before adding it
+type Metainfo struct {
+	Name     string
+	InfoHash string
+	// Announce list the announce url followed by the announce-list tiers, without duplicates
+	Announce []string
+	Private  bool
+}
+
+// TrackerHosts return the distinct hosts of the announce urls
+func (m *Metainfo) TrackerHosts() (hosts []string) {
+	return trackerHosts(m.Announce)
+}
+
+func trackerHosts(urls []string) (hosts []string) {
+	seen := map[string]bool{}
+	for _, it := range urls {
+		host := TrackerHost(it)
+		if host != "" && !seen[host] {
+			seen[host] = true
+			hosts = append(hosts, host)
+		}
+	}
+	return
+}
+
+func ReadMetainfo(path string) (m *Metainfo, err error) {
+	data, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	return ParseMetainfo(data)
+}
+
+// ParseMetainfo decode a bencoded .torrent file, InfoHash is the v1 sha1 of the info dictionary
+func ParseMetainfo(data []byte) (m *Metainfo, err error) {
+	d := &bdecoder{data: data}
+	v, err := d.value()
+	if err != nil {
+		return
+	}
+	if d.pos != len(data) {
+		return nil, fmt.Errorf("bencode: trailing data at %d", d.pos)
+	}
+	root, ok := v.(map[string]any)
+	if !ok {
+		return nil, errors.New("metainfo: not a dictionary")
+	}
+	info, ok := root["info"].(map[string]any)
+	if !ok {
+		return nil, errors.New("metainfo: missing info dictionary")
+	}
+	m = &Metainfo{}
+	m.Name, _ = info["name"].(string)
+	m.Private = info["private"] == int64(1)
+	sum := sha1.Sum(data[d.info[0]:d.info[1]])
+	m.InfoHash = hex.EncodeToString(sum[:])
+
+	seen := map[string]bool{}
+	add := func(v any) {
+		if s, ok := v.(string); ok && s != "" && !seen[s] {
+			seen[s] = true
+			m.Announce = append(m.Announce, s)
+		}
+	}
+	add(root["announce"])
+	tiers, _ := root["announce-list"].([]any)
+	for _, tier := range tiers {
+		list, _ := tier.([]any)
+		for _, it := range list {
+			add(it)
+		}
+	}
+	return
+}
+
+// Magnet is the part of a magnet link needed before adding it
+type Magnet struct {
+	URI      string
+	Name     string
+	InfoHash string
+	Trackers []string
+}
+
+func (m *Magnet) TrackerHosts() (hosts []string) {
+	return trackerHosts(m.Trackers)
+}
+
+func ParseMagnet(uri string) (m *Magnet, err error) {
+	uri = strings.TrimSpace(uri)
+	u, err := url.Parse(uri)
+	if err != nil {
+		return
+	}
+	if u.Scheme != "magnet" {
+		return nil, fmt.Errorf("magnet: unexpected scheme %q", u.Scheme)
+	}
+	query := u.Query()
+	m = &Magnet{URI: uri, Name: query.Get("dn"), Trackers: query["tr"]}
+	// hex or base32 btih both turn into the hex hash qBittorrent reports
+	m.InfoHash = MagnetInfohash("magnet:?" + u.RawQuery)
+	if m.InfoHash == "" {
+		return nil, errors.New("magnet: missing or invalid urn:btih")
+	}
+	return
+}
+
+// bencodeMaxDepth bound the nesting of lists and dicts, real metainfo nest a few levels
+const bencodeMaxDepth = 64
+
+// bdecoder decode bencode into int64, string, []any and map[string]any,
+// and remember where the top level info value starts and ends
+type bdecoder struct {
+	data  []byte
+	pos   int
+	depth int
+	info  [2]int
+}
+
+func (d *bdecoder) value() (v any, err error) {
+	if d.pos >= len(d.data) {
+		return nil, errors.New("bencode: unexpected end of data")
+	}
+	switch c := d.data[d.pos]; {
+	case c == 'i':
+		end := d.find('e', d.pos+1)
+		if end < 0 {
+			return nil, errors.New("bencode: unterminated integer")
+		}
+		v, err = strconv.ParseInt(string(d.data[d.pos+1:end]), 10, 64)
+		d.pos = end + 1
+		return
+	case c >= '0' && c <= '9':
+		return d.string()
+	case c == 'l':
+		if d.depth >= bencodeMaxDepth {
+			return nil, fmt.Errorf("bencode: nested deeper than %d at %d", bencodeMaxDepth, d.pos)
+		}
+		d.pos++
+		d.depth++
+		list := []any{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			var it any
+			it, err = d.value()
+			if err != nil {
+				return
+			}
+			list = append(list, it)
+		}
+		d.depth--
+		return list, d.end()
+	case c == 'd':
+		if d.depth >= bencodeMaxDepth {
+			return nil, fmt.Errorf("bencode: nested deeper than %d at %d", bencodeMaxDepth, d.pos)
+		}
+		d.pos++
+		d.depth++
+		dict := map[string]any{}
+		for d.pos < len(d.data) && d.data[d.pos] != 'e' {
+			var key string
+			key, err = d.string()
+			if err != nil {
+				return
+			}
+			start := d.pos
+			dict[key], err = d.value()
+			if err != nil {
+				return
+			}
+			if d.depth == 1 && key == "info" {
+				d.info = [2]int{start, d.pos}
+			}
+		}
+		d.depth--
+		return dict, d.end()
+	default:
+		return nil, fmt.Errorf("bencode: unexpected %q at %d", c, d.pos)
+	}
+}
+
+func (d *bdecoder) string() (s string, err error) {
+	colon := d.find(':', d.pos)
+	if colon < 0 {
+		return "", errors.New("bencode: invalid string length")
+	}
+	n, err := strconv.Atoi(string(d.data[d.pos:colon]))
+	if err != nil {
+		return
+	}
+	// compare against what is left so a huge length can not overflow
+	if n < 0 || n > len(d.data)-colon-1 {
+		return "", fmt.Errorf("bencode: string of %d bytes out of range at %d", n, d.pos)
+	}
+	s = string(d.data[colon+1 : colon+1+n])
+	d.pos = colon + 1 + n
+	return
+}
+
+func (d *bdecoder) end() error {
+	if d.pos >= len(d.data) {
+		return errors.New("bencode: unexpected end of data")
+	}
+	d.pos++
+	return nil
+}
+
+func (d *bdecoder) find(c byte, from int) int {
+	for i := from; i < len(d.data); i++ {
+		if d.data[i] == c {
+			return i
+		}
+	}
+	return -1
+}
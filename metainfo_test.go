@@ -0,0 +1,88 @@
+package qbt_api
+
+import (
+	"crypto/sha1"
+	"encoding/hex"
+	"strconv"
+	"strings"
+	"testing"
+)
+
+const testInfo = "d6:lengthi1024e4:name8:test.iso12:piece lengthi16384e6:pieces20:aaaaaaaaaaaaaaaaaaaa7:privatei1ee"
+
+func testTorrent(announce string) []byte {
+	return []byte("d8:announce" + bencodeString(announce) +
+		"13:announce-listll" + bencodeString(announce) + "el" + bencodeString("udp://backup.example:6969/announce") + "ee" +
+		"4:info" + testInfo + "e")
+}
+
+func bencodeString(s string) string {
+	return strconv.Itoa(len(s)) + ":" + s
+}
+
+func TestParseMetainfo(t *testing.T) {
+	m, err := ParseMetainfo(testTorrent("https://tracker.private.example/announce"))
+	if err != nil {
+		t.Fatal(err)
+	}
+	sum := sha1.Sum([]byte(testInfo))
+	if m.Name != "test.iso" || !m.Private || m.InfoHash != hex.EncodeToString(sum[:]) {
+		t.Fatalf("unexpected metainfo %+v", m)
+	}
+	if strings.Join(m.TrackerHosts(), ",") != "tracker.private.example,backup.example" {
+		t.Fatalf("unexpected hosts %v", m.TrackerHosts())
+	}
+
+	for _, it := range []string{"", "i1e", "d4:infoi1ee", "d4:info" + testInfo, "l1:ae2:ab"} {
+		_, err = ParseMetainfo([]byte(it))
+		if err == nil {
+			t.Errorf("expected an error for %q", it)
+		}
+	}
+}
+
+func TestParseMetainfo_Malformed(t *testing.T) {
+	malformed := []string{
+		"d4:info9223372036854775807:xe",
+		"d4:info9223372036854775808:xe",
+		"d4:info-1:xe",
+		strings.Repeat("l", 100000),
+		"d4:info" + strings.Repeat("l", bencodeMaxDepth) + strings.Repeat("e", bencodeMaxDepth) + "e",
+	}
+	for _, it := range malformed {
+		_, err := ParseMetainfo([]byte(it))
+		if err == nil {
+			t.Errorf("expected an error for %.40q", it)
+		}
+	}
+}
+
+func FuzzParseMetainfo(f *testing.F) {
+	f.Add(testTorrent("https://tracker.example/announce"))
+	f.Add([]byte("d4:info9223372036854775807:xe"))
+	f.Add([]byte("d4:infod4:name1:aee"))
+	f.Fuzz(func(t *testing.T, data []byte) {
+		// only errors are expected, never a panic
+		ParseMetainfo(data)
+	})
+}
+
+func TestParseMagnet(t *testing.T) {
+	m, err := ParseMagnet("magnet:?xt=urn:btih:0123456789ABCDEF0123456789ABCDEF01234567&dn=debian.iso&tr=udp%3A%2F%2Ftracker.example%3A1337&tr=https%3A%2F%2Fother.example%2Fannounce\n")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if m.Name != "debian.iso" || m.InfoHash != "0123456789abcdef0123456789abcdef01234567" || strings.Join(m.TrackerHosts(), ",") != "tracker.example,other.example" {
+		t.Fatalf("unexpected magnet %+v", m)
+	}
+	// base32 with an upper case prefix is the same hash
+	m, err = ParseMagnet("magnet:?xt=URN:BTIH:AERUKZ4JVPG66AJDIVTYTK6N54ASGRLH")
+	if err != nil || m.InfoHash != "0123456789abcdef0123456789abcdef01234567" {
+		t.Fatalf("unexpected base32 magnet %+v %v", m, err)
+	}
+	for _, it := range []string{"https://example.com/a.torrent", "magnet:?xt=urn:btih:abcdef", "magnet:?dn=name"} {
+		if _, err = ParseMagnet(it); err == nil {
+			t.Fatalf("expected an error for %s", it)
+		}
+	}
+}
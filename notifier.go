@@ -0,0 +1,386 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"strings"
+	"text/template"
+	"time"
+)
+
+const DefaultNotifierInterval = 5 * time.Second
+const DefaultNotifierStalledAfter = time.Hour
+const DefaultNotifierMaxBatch = 50
+const DefaultNotifierRetries = 3
+const DefaultNotifierRetryDelay = time.Second
+
+// NotifierSignatureHeader hold sha256=<hex hmac of the body> when the webhook has a secret
+const NotifierSignatureHeader = "X-Qbt-Signature"
+
+type NotifyEventKind string
+
+const NotifyTorrentAdded NotifyEventKind = "torrent_added"
+const NotifyTorrentCompleted NotifyEventKind = "torrent_completed"
+const NotifyTorrentErrored NotifyEventKind = "torrent_errored"
+const NotifyTorrentMissingFiles NotifyEventKind = "torrent_missing_files"
+const NotifyTorrentStalled NotifyEventKind = "torrent_stalled"
+const NotifyConnectionStatus NotifyEventKind = "connection_status"
+const NotifyFreeSpaceLow NotifyEventKind = "free_space_low"
+
+var defaultNotifyTemplates = map[NotifyEventKind]string{
+	NotifyTorrentAdded:        "added {{.Name}}",
+	NotifyTorrentCompleted:    "completed {{.Name}}",
+	NotifyTorrentErrored:      "{{.Name}} errored",
+	NotifyTorrentMissingFiles: "{{.Name}} has missing files",
+	NotifyTorrentStalled:      "{{.Name}} stalled for {{.Stalled}}",
+	NotifyConnectionStatus:    "connection status is {{.ConnectionStatus}}",
+	NotifyFreeSpaceLow:        "free space is low: {{.FreeSpace}} bytes left",
+}
+
+type NotifyEvent struct {
+	Kind             NotifyEventKind `json:"kind"`
+	Time             time.Time       `json:"time"`
+	Hash             string          `json:"hash,omitempty"`
+	Name             string          `json:"name,omitempty"`
+	State            string          `json:"state,omitempty"`
+	Category         string          `json:"category,omitempty"`
+	Stalled          time.Duration   `json:"stalled,omitempty"`
+	ConnectionStatus string          `json:"connectionStatus,omitempty"`
+	FreeSpace        int64           `json:"freeSpace,omitempty"`
+	// Message is rendered per webhook
+	Message string `json:"message"`
+}
+
+type Webhook struct {
+	URL string
+	// Events filter the kinds sent, empty means every kind
+	Events []NotifyEventKind
+	// Templates override the text/template rendering the message of a kind, executed with the NotifyEvent
+	Templates map[NotifyEventKind]string
+	// Secret sign the body with HMAC-SHA256 in NotifierSignatureHeader
+	Secret string
+	Header http.Header
+}
+
+type NotifierOptions struct {
+	Webhooks []Webhook
+	// Interval default to DefaultNotifierInterval
+	Interval time.Duration
+	// StalledAfter is how long a torrent stays stalledDL before it is reported, default to DefaultNotifierStalledAfter
+	StalledAfter time.Duration
+	// LowFreeSpace report when free space drops below this many bytes, zero disables the event
+	LowFreeSpace int64
+	// MaxBatch is the maximum number of events per request, default to DefaultNotifierMaxBatch
+	MaxBatch int
+	// Retries on network errors, 429 and 5xx, default to DefaultNotifierRetries and negative disables them,
+	// RetryDelay doubles after each attempt
+	Retries    int
+	RetryDelay time.Duration
+	// Client default to http.DefaultClient
+	Client *http.Client
+}
+
+// NotifyPayload is the json body POSTed to webhooks, Text join the messages for chat systems
+type NotifyPayload struct {
+	Text   string        `json:"text"`
+	Events []NotifyEvent `json:"events"`
+}
+
+type webhookTarget struct {
+	Webhook
+	kinds     map[NotifyEventKind]bool
+	templates map[NotifyEventKind]*template.Template
+}
+
+// Notifier detect torrent and server events from sync/maindata and push them to webhooks,
+// the first update only records the current state
+type Notifier struct {
+	opts    NotifierOptions
+	tracker *MainDataTracker
+	targets []*webhookTarget
+	now     func() time.Time
+
+	started      bool
+	torrents     map[string]Torrent
+	serverState  ServerState
+	stalledSince map[string]time.Time
+	stalledSent  map[string]bool
+	// completed stay set while a complete torrent is rechecked or moved, so it is reported once
+	completed map[string]bool
+}
+
+func (a *Api) NewNotifier(opts NotifierOptions) (n *Notifier, err error) {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultNotifierInterval
+	}
+	if opts.StalledAfter <= 0 {
+		opts.StalledAfter = DefaultNotifierStalledAfter
+	}
+	if opts.MaxBatch <= 0 {
+		opts.MaxBatch = DefaultNotifierMaxBatch
+	}
+	if opts.Retries < 0 {
+		opts.Retries = 0
+	} else if opts.Retries == 0 {
+		opts.Retries = DefaultNotifierRetries
+	}
+	if opts.RetryDelay <= 0 {
+		opts.RetryDelay = DefaultNotifierRetryDelay
+	}
+	if opts.Client == nil {
+		opts.Client = http.DefaultClient
+	}
+	n = &Notifier{
+		opts:         opts,
+		tracker:      a.Sync.NewMainDataTracker(opts.Interval),
+		now:          time.Now,
+		torrents:     map[string]Torrent{},
+		stalledSince: map[string]time.Time{},
+		stalledSent:  map[string]bool{},
+		completed:    map[string]bool{},
+	}
+	for _, it := range opts.Webhooks {
+		target := &webhookTarget{Webhook: it, kinds: map[NotifyEventKind]bool{}, templates: map[NotifyEventKind]*template.Template{}}
+		for _, kind := range it.Events {
+			target.kinds[kind] = true
+		}
+		for kind, text := range defaultNotifyTemplates {
+			if custom, ok := it.Templates[kind]; ok {
+				text = custom
+			}
+			target.templates[kind], err = template.New(string(kind)).Parse(text)
+			if err != nil {
+				return nil, fmt.Errorf("webhook %s template %s: %w", it.URL, kind, err)
+			}
+		}
+		n.targets = append(n.targets, target)
+	}
+	return
+}
+
+// detect compare torrents and server state with the previous call
+func (n *Notifier) detect(torrents map[string]Torrent, state ServerState) (events []NotifyEvent) {
+	now := n.now()
+	defer func() {
+		n.started = true
+		n.torrents = torrents
+		n.serverState = state
+	}()
+
+	for hash, torrent := range torrents {
+		if TorrentManagementInfoState(torrent.State) == InfoStateStalledDL {
+			if _, ok := n.stalledSince[hash]; !ok {
+				n.stalledSince[hash] = now
+			}
+		} else {
+			delete(n.stalledSince, hash)
+			delete(n.stalledSent, hash)
+		}
+	}
+	for hash := range n.stalledSince {
+		if _, ok := torrents[hash]; !ok {
+			delete(n.stalledSince, hash)
+			delete(n.stalledSent, hash)
+		}
+	}
+
+	newlyCompleted := map[string]bool{}
+	for hash, torrent := range torrents {
+		switch TorrentManagementInfoState(torrent.State) {
+		case InfoStateDownloading, InfoStateMetaDL, InfoStatePausedDL, InfoStateQueuedDL, InfoStateStalledDL, InfoStateForcedDL:
+			// downloading again after a recheck found missing pieces, the next completion is reported
+			delete(n.completed, hash)
+			continue
+		}
+		// a torrent checking or moving at the first update is already complete when its progress says so
+		if !n.completed[hash] && (isCompleteTorrent(torrent) || (!n.started && torrent.Progress >= 1)) {
+			n.completed[hash] = true
+			newlyCompleted[hash] = true
+		}
+	}
+	for hash := range n.completed {
+		if _, ok := torrents[hash]; !ok {
+			delete(n.completed, hash)
+		}
+	}
+	if !n.started {
+		return
+	}
+
+	var hashes []string
+	for hash := range torrents {
+		hashes = append(hashes, hash)
+	}
+	sort.Strings(hashes)
+	for _, hash := range hashes {
+		torrent := torrents[hash]
+		event := func(kind NotifyEventKind) NotifyEvent {
+			return NotifyEvent{Kind: kind, Time: now, Hash: hash, Name: torrent.Name, State: torrent.State, Category: torrent.Category}
+		}
+		previous, existed := n.torrents[hash]
+		if !existed {
+			events = append(events, event(NotifyTorrentAdded))
+		}
+		if existed && newlyCompleted[hash] {
+			events = append(events, event(NotifyTorrentCompleted))
+		}
+		if torrent.State != previous.State {
+			switch TorrentManagementInfoState(torrent.State) {
+			case InfoStateError:
+				events = append(events, event(NotifyTorrentErrored))
+			case InfoStateMissingFiles:
+				events = append(events, event(NotifyTorrentMissingFiles))
+			}
+		}
+		if since, ok := n.stalledSince[hash]; ok && !n.stalledSent[hash] && now.Sub(since) >= n.opts.StalledAfter {
+			n.stalledSent[hash] = true
+			it := event(NotifyTorrentStalled)
+			it.Stalled = now.Sub(since).Truncate(time.Second)
+			events = append(events, it)
+		}
+	}
+
+	if state.ConnectionStatus != n.serverState.ConnectionStatus && (state.ConnectionStatus == "firewalled" || state.ConnectionStatus == "disconnected") {
+		events = append(events, NotifyEvent{Kind: NotifyConnectionStatus, Time: now, ConnectionStatus: state.ConnectionStatus})
+	}
+	if n.opts.LowFreeSpace > 0 && state.FreeSpaceOnDisk < n.opts.LowFreeSpace && n.serverState.FreeSpaceOnDisk >= n.opts.LowFreeSpace {
+		events = append(events, NotifyEvent{Kind: NotifyFreeSpaceLow, Time: now, FreeSpace: state.FreeSpaceOnDisk})
+	}
+	return
+}
+
+// Send deliver events to every webhook interested in them, in batches of MaxBatch
+func (n *Notifier) Send(ctx context.Context, events []NotifyEvent) error {
+	var errs []error
+	for _, target := range n.targets {
+		var selected []NotifyEvent
+		for _, it := range events {
+			if len(target.kinds) > 0 && !target.kinds[it.Kind] {
+				continue
+			}
+			buf := &strings.Builder{}
+			err := target.templates[it.Kind].Execute(buf, it)
+			if err != nil {
+				errs = append(errs, fmt.Errorf("webhook %s template %s: %w", target.URL, it.Kind, err))
+				continue
+			}
+			it.Message = buf.String()
+			selected = append(selected, it)
+		}
+		for start := 0; start < len(selected); start += n.opts.MaxBatch {
+			end := start + n.opts.MaxBatch
+			if end > len(selected) {
+				end = len(selected)
+			}
+			err := n.post(ctx, target, selected[start:end])
+			if err != nil {
+				errs = append(errs, fmt.Errorf("webhook %s: %w", target.URL, err))
+			}
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (n *Notifier) post(ctx context.Context, target *webhookTarget, events []NotifyEvent) (err error) {
+	payload := NotifyPayload{Events: events}
+	messages := make([]string, len(events))
+	for i, it := range events {
+		messages[i] = it.Message
+	}
+	payload.Text = strings.Join(messages, "\n")
+	body, err := json.Marshal(payload)
+	if err != nil {
+		return
+	}
+
+	delay := n.opts.RetryDelay
+	for attempt := 0; ; attempt++ {
+		var retry bool
+		retry, err = n.postOnce(ctx, target, body)
+		if err == nil || !retry || attempt >= n.opts.Retries {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-time.After(delay):
+		}
+		delay *= 2
+	}
+}
+
+func (n *Notifier) postOnce(ctx context.Context, target *webhookTarget, body []byte) (retry bool, err error) {
+	req, err := http.NewRequestWithContext(ctx, http.MethodPost, target.URL, bytes.NewReader(body))
+	if err != nil {
+		return
+	}
+	for k, v := range target.Header {
+		req.Header[k] = v
+	}
+	req.Header.Set("Content-Type", "application/json")
+	if target.Secret != "" {
+		mac := hmac.New(sha256.New, []byte(target.Secret))
+		mac.Write(body)
+		req.Header.Set(NotifierSignatureHeader, "sha256="+hex.EncodeToString(mac.Sum(nil)))
+	}
+	resp, err := n.opts.Client.Do(req)
+	if err != nil {
+		return ctx.Err() == nil, err
+	}
+	resp.Body.Close()
+	if resp.StatusCode < 200 || resp.StatusCode > 299 {
+		retry = resp.StatusCode == http.StatusTooManyRequests || resp.StatusCode >= 500
+		return retry, errors.New(resp.Status)
+	}
+	return
+}
+
+// Check update torrents and send the events detected since the previous check,
+// events are returned even when the delivery failed
+func (n *Notifier) Check(ctx context.Context) (events []NotifyEvent, err error) {
+	err = n.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	events = n.detect(n.tracker.Torrents(), n.tracker.ServerState())
+	if len(events) > 0 {
+		err = n.Send(ctx, events)
+	}
+	return
+}
+
+// Run check every Interval until ctx is done or updating fails, delivery errors are passed to onCheck
+// which may be nil
+func (n *Notifier) Run(ctx context.Context, onCheck func(events []NotifyEvent, err error)) (err error) {
+	ticker := time.NewTicker(n.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		err = n.tracker.Update(ctx)
+		if err != nil {
+			return
+		}
+		events := n.detect(n.tracker.Torrents(), n.tracker.ServerState())
+		var sendErr error
+		if len(events) > 0 {
+			sendErr = n.Send(ctx, events)
+		}
+		if onCheck != nil {
+			onCheck(events, sendErr)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,159 @@
+package qbt_api
+
+import (
+	"context"
+	"crypto/hmac"
+	"crypto/sha256"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"io"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestNotifier_Detect(t *testing.T) {
+	client, _ := NewApi("http://localhost")
+	n, err := client.NewNotifier(NotifierOptions{LowFreeSpace: 100, StalledAfter: time.Hour})
+	if err != nil {
+		t.Fatal(err)
+	}
+	now := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	n.now = func() time.Time { return now }
+
+	events := n.detect(map[string]Torrent{
+		"a": {Name: "a", State: "downloading", Progress: 0.5},
+		"b": {Name: "b", State: "stalledDL"},
+		"c": {Name: "c", State: "uploading", Progress: 1},
+	}, ServerState{ConnectionStatus: "connected", FreeSpaceOnDisk: 1000})
+	if len(events) != 0 {
+		t.Fatalf("the first update must only record the state %+v", events)
+	}
+
+	now = now.Add(2 * time.Hour)
+	events = n.detect(map[string]Torrent{
+		"a": {Name: "a", State: "uploading", Progress: 1},
+		"b": {Name: "b", State: "stalledDL"},
+		"c": {Name: "c", State: "missingFiles", Progress: 1},
+		"d": {Name: "d", State: "error"},
+	}, ServerState{ConnectionStatus: "firewalled", FreeSpaceOnDisk: 10})
+	var got []string
+	for _, it := range events {
+		got = append(got, string(it.Kind)+" "+it.Name)
+	}
+	expected := "torrent_completed a,torrent_stalled b,torrent_missing_files c,torrent_added d,torrent_errored d,connection_status ,free_space_low "
+	if strings.Join(got, ",") != expected {
+		t.Fatalf("unexpected events %s", strings.Join(got, ","))
+	}
+	if events[1].Stalled != 2*time.Hour {
+		t.Fatalf("unexpected stall duration %s", events[1].Stalled)
+	}
+
+	// nothing changed, the stall and low space are not reported twice
+	now = now.Add(time.Hour)
+	events = n.detect(n.torrents, n.serverState)
+	if len(events) != 0 {
+		t.Fatalf("unexpected repeated events %+v", events)
+	}
+
+	// a recheck of a seeding torrent does not complete it again
+	for _, state := range []string{"checkingUP", "uploading", "moving", "stalledUP"} {
+		events = n.detect(map[string]Torrent{"a": {Name: "a", State: state, Progress: 1}}, n.serverState)
+		if len(events) != 0 {
+			t.Fatalf("%s: unexpected events %+v", state, events)
+		}
+	}
+	// unless the recheck found missing pieces and the torrent downloaded them again
+	n.detect(map[string]Torrent{"a": {Name: "a", State: "downloading", Progress: 0.9}}, n.serverState)
+	events = n.detect(map[string]Torrent{"a": {Name: "a", State: "uploading", Progress: 1}}, n.serverState)
+	if len(events) != 1 || events[0].Kind != NotifyTorrentCompleted {
+		t.Fatalf("unexpected events %+v", events)
+	}
+}
+
+func TestNotifier_Send(t *testing.T) {
+	var mu sync.Mutex
+	var payloads []NotifyPayload
+	attempts := 0
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		mu.Lock()
+		defer mu.Unlock()
+		attempts++
+		if attempts == 1 {
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		body, _ := io.ReadAll(r.Body)
+		mac := hmac.New(sha256.New, []byte("secret"))
+		mac.Write(body)
+		if r.Header.Get(NotifierSignatureHeader) != "sha256="+hex.EncodeToString(mac.Sum(nil)) {
+			w.WriteHeader(http.StatusUnauthorized)
+			return
+		}
+		var payload NotifyPayload
+		json.Unmarshal(body, &payload)
+		payloads = append(payloads, payload)
+	}))
+	defer receiver.Close()
+	rejecting := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		w.WriteHeader(http.StatusBadRequest)
+	}))
+	defer rejecting.Close()
+
+	client, _ := NewApi("http://localhost")
+	n, err := client.NewNotifier(NotifierOptions{
+		MaxBatch:   2,
+		RetryDelay: time.Millisecond,
+		Webhooks: []Webhook{
+			{URL: receiver.URL, Secret: "secret", Events: []NotifyEventKind{NotifyTorrentAdded, NotifyTorrentCompleted},
+				Templates: map[NotifyEventKind]string{NotifyTorrentCompleted: "done: {{.Name}} ({{.Category}})"}},
+			{URL: rejecting.URL},
+		},
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+	events := []NotifyEvent{
+		{Kind: NotifyTorrentAdded, Name: "a"},
+		{Kind: NotifyTorrentCompleted, Name: "a", Category: "tv"},
+		{Kind: NotifyTorrentErrored, Name: "b"},
+		{Kind: NotifyTorrentAdded, Name: "c"},
+	}
+	err = n.Send(context.Background(), events)
+	if err == nil || !strings.Contains(err.Error(), rejecting.URL) || strings.Contains(err.Error(), receiver.URL) {
+		t.Fatalf("unexpected error %v", err)
+	}
+	// the 503 is retried and the client error is not
+	if attempts != 3 || len(payloads) != 2 {
+		t.Fatalf("unexpected deliveries %d %+v", attempts, payloads)
+	}
+	if payloads[0].Text != "added a\ndone: a (tv)" || len(payloads[1].Events) != 1 || payloads[1].Events[0].Name != "c" {
+		t.Fatalf("unexpected payloads %+v", payloads)
+	}
+}
+
+func TestNotifier_Check(t *testing.T) {
+	var payloads []string
+	receiver := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		payloads = append(payloads, string(body))
+	}))
+	defer receiver.Close()
+
+	n, err := api.NewNotifier(NotifierOptions{Webhooks: []Webhook{{URL: receiver.URL}}})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for i := 0; i < 2; i++ {
+		events, err := n.Check(context.Background())
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(events, payloads)
+	}
+}
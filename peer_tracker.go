@@ -0,0 +1,172 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"net/http"
+	"net/url"
+	"strconv"
+	"sync"
+	"time"
+)
+
+// ErrTorrentRemoved is returned by PeerTracker when the tracked torrent no longer exists on the server
+var ErrTorrentRemoved = errors.New("torrent was removed")
+
+const DefaultPeerTrackerInterval = 2 * time.Second
+
+type torrentPeersDiff struct {
+	FullUpdate   bool                       `json:"full_update"`
+	Peers        map[string]json.RawMessage `json:"peers"`
+	PeersRemoved []string                   `json:"peers_removed"`
+	Rid          int64                      `json:"rid"`
+	ShowFlags    bool                       `json:"show_flags"`
+}
+
+// PeerStats is derived from the current peer table of a PeerTracker
+type PeerStats struct {
+	Total     int
+	ByCountry map[string]int
+	ByClient  map[string]int
+	DlSpeed   int64
+	UpSpeed   int64
+}
+
+// PeerTracker keeps the peer table of a single torrent up to date by polling sync/torrentPeers
+// and applying the partial updates it returns
+type PeerTracker struct {
+	api      *Api
+	hash     string
+	interval time.Duration
+
+	mu    sync.RWMutex
+	rid   int64
+	peers map[string]Peer
+}
+
+// NewPeerTracker create a tracker for torrent hash, interval below or equal zero means DefaultPeerTrackerInterval
+func (s *Sync) NewPeerTracker(hash string, interval time.Duration) *PeerTracker {
+	if interval <= 0 {
+		interval = DefaultPeerTrackerInterval
+	}
+	return &PeerTracker{
+		api:      s.api,
+		hash:     hash,
+		interval: interval,
+		peers:    map[string]Peer{},
+	}
+}
+
+func (s *Sync) torrentPeersDiff(ctx context.Context, hash string, rid int64) (diff *torrentPeersDiff, err error) {
+	path := "/api/v2/sync/torrentPeers"
+
+	query := url.Values{}
+	query.Add("hash", hash)
+	query.Add("rid", strconv.FormatInt(rid, 10))
+
+	err = s.api.doRequest(ctx, http.MethodGet, path, query, nil, &diff)
+	if err != nil {
+		return
+	}
+	return
+}
+
+// Update fetch changes since last update and merge them into peer table
+func (pt *PeerTracker) Update(ctx context.Context) (err error) {
+	pt.mu.RLock()
+	rid := pt.rid
+	pt.mu.RUnlock()
+
+	diff, err := pt.api.Sync.torrentPeersDiff(ctx, pt.hash, rid)
+	if err != nil {
+		var se *StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusNotFound {
+			err = ErrTorrentRemoved
+		}
+		return
+	}
+	return pt.apply(diff)
+}
+
+func (pt *PeerTracker) apply(diff *torrentPeersDiff) (err error) {
+	pt.mu.Lock()
+	defer pt.mu.Unlock()
+
+	if diff.FullUpdate {
+		pt.peers = map[string]Peer{}
+	}
+	for key, raw := range diff.Peers {
+		peer := pt.peers[key]
+		err = json.Unmarshal(raw, &peer)
+		if err != nil {
+			return
+		}
+		pt.peers[key] = peer
+	}
+	for _, key := range diff.PeersRemoved {
+		delete(pt.peers, key)
+	}
+	pt.rid = diff.Rid
+	return
+}
+
+// Run poll until ctx is done or the torrent is removed, onUpdate is called after each successful merge and may be nil
+func (pt *PeerTracker) Run(ctx context.Context, onUpdate func(pt *PeerTracker)) (err error) {
+	ticker := time.NewTicker(pt.interval)
+	defer ticker.Stop()
+
+	for {
+		err = pt.Update(ctx)
+		if err != nil {
+			return
+		}
+		if onUpdate != nil {
+			onUpdate(pt)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
+
+func (pt *PeerTracker) Hash() string {
+	return pt.hash
+}
+
+func (pt *PeerTracker) Rid() int64 {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+	return pt.rid
+}
+
+// Peers return a copy of current peer table keyed by "ip:port"
+func (pt *PeerTracker) Peers() map[string]Peer {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	peers := make(map[string]Peer, len(pt.peers))
+	for k, v := range pt.peers {
+		peers[k] = v
+	}
+	return peers
+}
+
+func (pt *PeerTracker) Stats() (stats PeerStats) {
+	pt.mu.RLock()
+	defer pt.mu.RUnlock()
+
+	stats.ByCountry = map[string]int{}
+	stats.ByClient = map[string]int{}
+	for _, peer := range pt.peers {
+		stats.Total += 1
+		stats.ByCountry[peer.Country] += 1
+		stats.ByClient[peer.Client] += 1
+		stats.DlSpeed += int64(peer.DlSpeed)
+		stats.UpSpeed += int64(peer.UpSpeed)
+	}
+	return
+}
@@ -0,0 +1,74 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"github.com/davecgh/go-spew/spew"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+	"time"
+)
+
+func TestPeerTracker_Merge(t *testing.T) {
+	responses := []string{
+		`{"full_update":true,"rid":1,"peers":{
+			"1.1.1.1:6881":{"client":"qBittorrent 4.5.4","country":"Germany","dl_speed":100,"up_speed":10,"progress":0.5},
+			"2.2.2.2:6881":{"client":"Transmission 3.00","country":"France","dl_speed":50,"up_speed":5,"progress":1}}}`,
+		`{"rid":2,"peers":{"1.1.1.1:6881":{"dl_speed":300}},"peers_removed":["2.2.2.2:6881"]}`,
+	}
+	var call = 0
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if call >= len(responses) {
+			w.WriteHeader(http.StatusNotFound)
+			w.Write([]byte("Not Found"))
+			return
+		}
+		if r.URL.Query().Get("rid") != []string{"0", "1"}[call] {
+			t.Errorf("unexpected rid %s", r.URL.Query().Get("rid"))
+		}
+		w.Write([]byte(responses[call]))
+		call += 1
+	}))
+	defer srv.Close()
+
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pt := client.Sync.NewPeerTracker("hash", time.Millisecond)
+
+	var updates = 0
+	err = pt.Run(context.Background(), func(pt *PeerTracker) {
+		updates += 1
+	})
+	if !errors.Is(err, ErrTorrentRemoved) {
+		t.Fatalf("expected ErrTorrentRemoved, got %v", err)
+	}
+	if updates != 2 || pt.Rid() != 2 {
+		t.Fatalf("unexpected updates %d rid %d", updates, pt.Rid())
+	}
+
+	peers := pt.Peers()
+	peer, ok := peers["1.1.1.1:6881"]
+	if len(peers) != 1 || !ok {
+		t.Fatalf("unexpected peers %v", peers)
+	}
+	if peer.DlSpeed != 300 || peer.UpSpeed != 10 || peer.Client != "qBittorrent 4.5.4" || peer.Progress != 0.5 {
+		t.Fatalf("partial update not merged %+v", peer)
+	}
+
+	stats := pt.Stats()
+	if stats.Total != 1 || stats.DlSpeed != 300 || stats.ByCountry["Germany"] != 1 || stats.ByClient["qBittorrent 4.5.4"] != 1 {
+		t.Fatalf("unexpected stats %+v", stats)
+	}
+}
+
+func TestPeerTracker_Update(t *testing.T) {
+	pt := api.Sync.NewPeerTracker("c697e22d8b385a4a667d773467a840adae200919", 0)
+	err := pt.Update(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	spew.Dump(pt.Stats())
+}
@@ -0,0 +1,323 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"image"
+	"image/color"
+	"image/png"
+	"io"
+	"strconv"
+	"strings"
+)
+
+// PieceRange is an inclusive range of piece indexes
+type PieceRange struct {
+	First int `json:"first"`
+	Last  int `json:"last"`
+}
+
+func (pr PieceRange) Len() int {
+	return pr.Last - pr.First + 1
+}
+
+// PieceMap combine piece states with the piece size and file layout of a torrent
+type PieceMap struct {
+	States    []PieceState
+	PieceSize int64
+	// TotalSize is the sum of the file sizes, the last piece is usually shorter than PieceSize
+	TotalSize int64
+	Files     []*TorrentManagementFile
+}
+
+// PieceMap fetch piece states, piece size and files of a torrent
+func (tm *TorrentManagement) PieceMap(ctx context.Context, hash string) (pm *PieceMap, err error) {
+	states, err := tm.PieceStates(ctx, hash)
+	if err != nil {
+		return
+	}
+	properties, err := tm.Properties(ctx, hash)
+	if err != nil {
+		return
+	}
+	files, err := tm.Files(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	pm = &PieceMap{States: states, PieceSize: int64(properties.PieceSize), Files: files}
+	for _, it := range files {
+		pm.TotalSize += it.Size
+	}
+	return
+}
+
+// Have return the number of downloaded pieces
+func (pm *PieceMap) Have() (n int) {
+	for _, it := range pm.States {
+		if it == PieceStateAlreadyDownloaded {
+			n++
+		}
+	}
+	return
+}
+
+// Runs return the contiguous ranges of pieces in one of states, in piece order
+func (pm *PieceMap) Runs(states ...PieceState) (ranges []PieceRange) {
+	in := func(state PieceState) bool {
+		for _, it := range states {
+			if it == state {
+				return true
+			}
+		}
+		return false
+	}
+	return pieceRuns(pm.States, 0, len(pm.States)-1, in)
+}
+
+func pieceRuns(states []PieceState, first, last int, in func(PieceState) bool) (ranges []PieceRange) {
+	start := -1
+	for i := first; i <= last && i < len(states); i++ {
+		if in(states[i]) {
+			if start < 0 {
+				start = i
+			}
+			continue
+		}
+		if start >= 0 {
+			ranges = append(ranges, PieceRange{start, i - 1})
+			start = -1
+		}
+	}
+	if start >= 0 {
+		end := last
+		if end >= len(states) {
+			end = len(states) - 1
+		}
+		ranges = append(ranges, PieceRange{start, end})
+	}
+	return
+}
+
+func notDownloaded(state PieceState) bool {
+	return state != PieceStateAlreadyDownloaded
+}
+
+// Downloaded return the contiguous downloaded ranges
+func (pm *PieceMap) Downloaded() []PieceRange {
+	return pm.Runs(PieceStateAlreadyDownloaded)
+}
+
+// Missing return the contiguous ranges not downloaded yet, pieces being downloaded included
+func (pm *PieceMap) Missing() []PieceRange {
+	return pieceRuns(pm.States, 0, len(pm.States)-1, notDownloaded)
+}
+
+// ContiguousFrom return how many pieces starting at piece are downloaded without a gap
+func (pm *PieceMap) ContiguousFrom(piece int) (n int) {
+	for i := piece; i >= 0 && i < len(pm.States) && pm.States[i] == PieceStateAlreadyDownloaded; i++ {
+		n++
+	}
+	return
+}
+
+// ByteRange return the half open byte span [start, end) of the pieces in the torrent
+func (pm *PieceMap) ByteRange(pr PieceRange) (start, end int64) {
+	start = int64(pr.First) * pm.PieceSize
+	end = int64(pr.Last+1) * pm.PieceSize
+	if pm.TotalSize > 0 && end > pm.TotalSize {
+		end = pm.TotalSize
+	}
+	return
+}
+
+// FilePieces is the piece view of a single file
+type FilePieces struct {
+	Index      int
+	Name       string
+	Size       int64
+	Pieces     PieceRange
+	Have       int
+	Completion float64
+	Missing    []PieceRange
+}
+
+// FilePieces compute per file completion from PieceRange, the pieces shared by two files count for both
+func (pm *PieceMap) FilePieces() (files []FilePieces) {
+	for _, file := range pm.Files {
+		fp := FilePieces{Index: file.Index, Name: file.Name, Size: file.Size}
+		if len(file.PieceRange) == 2 {
+			fp.Pieces = PieceRange{file.PieceRange[0], file.PieceRange[1]}
+			for i := fp.Pieces.First; i <= fp.Pieces.Last && i < len(pm.States); i++ {
+				if pm.States[i] == PieceStateAlreadyDownloaded {
+					fp.Have++
+				}
+			}
+			if n := fp.Pieces.Len(); n > 0 {
+				fp.Completion = float64(fp.Have) / float64(n)
+			}
+			fp.Missing = pieceRuns(pm.States, fp.Pieces.First, fp.Pieces.Last, notDownloaded)
+		}
+		files = append(files, fp)
+	}
+	return
+}
+
+// pieceBuckets split pieces into width columns and count the downloaded and downloading pieces of each,
+// with fewer pieces than columns a piece spans several columns
+func (pm *PieceMap) pieceBuckets(width int) (done, active, total []int) {
+	done, active, total = make([]int, width), make([]int, width), make([]int, width)
+	n := len(pm.States)
+	for c := 0; c < width; c++ {
+		first, end := c*n/width, (c+1)*n/width
+		if end == first {
+			end = first + 1
+		}
+		for _, it := range pm.States[first:end] {
+			total[c]++
+			switch it {
+			case PieceStateAlreadyDownloaded:
+				done[c]++
+			case PieceStateNowDownloading:
+				active[c]++
+			}
+		}
+	}
+	return
+}
+
+// ASCII render the pieces as a bar of width columns: # downloaded, + partly downloaded,
+// > being downloaded and . missing
+func (pm *PieceMap) ASCII(width int) string {
+	if width <= 0 || len(pm.States) == 0 {
+		return ""
+	}
+	done, active, total := pm.pieceBuckets(width)
+	bar := make([]byte, width)
+	for i := range bar {
+		switch {
+		case done[i] == total[i]:
+			bar[i] = '#'
+		case done[i] > 0:
+			bar[i] = '+'
+		case active[i] > 0:
+			bar[i] = '>'
+		default:
+			bar[i] = '.'
+		}
+	}
+	return string(bar)
+}
+
+var pieceMissingColor = color.RGBA{0xdd, 0xdd, 0xdd, 0xff}
+var pieceDoneColor = color.RGBA{0x2e, 0x9e, 0x44, 0xff}
+var pieceActiveColor = color.RGBA{0x3a, 0x7b, 0xd5, 0xff}
+
+func blend(a, b color.RGBA, f float64) color.RGBA {
+	mix := func(x, y uint8) uint8 { return uint8(float64(x) + (float64(y)-float64(x))*f) }
+	return color.RGBA{mix(a.R, b.R), mix(a.G, b.G), mix(a.B, b.B), 0xff}
+}
+
+// PNG render the pieces as a width x height bar, the green of a column grows with its downloaded pieces
+// and columns only being downloaded are blue
+func (pm *PieceMap) PNG(w io.Writer, width, height int) error {
+	if width <= 0 || height <= 0 {
+		return fmt.Errorf("invalid image size %dx%d", width, height)
+	}
+	img := image.NewRGBA(image.Rect(0, 0, width, height))
+	var done, active, total []int
+	if len(pm.States) > 0 {
+		done, active, total = pm.pieceBuckets(width)
+	}
+	for x := 0; x < width; x++ {
+		c := pieceMissingColor
+		if total != nil {
+			switch {
+			case done[x] > 0:
+				c = blend(pieceMissingColor, pieceDoneColor, float64(done[x])/float64(total[x]))
+			case active[x] > 0:
+				c = pieceActiveColor
+			}
+		}
+		for y := 0; y < height; y++ {
+			img.SetRGBA(x, y, c)
+		}
+	}
+	return png.Encode(w, img)
+}
+
+var pieceStateSymbols = map[PieceState]byte{
+	PieceStateNotDownloaded:     '.',
+	PieceStateNowDownloading:    '>',
+	PieceStateAlreadyDownloaded: '#',
+}
+
+// EncodePieceStates run length encode states, a run is its length followed by the state symbol
+// of ASCII, the length is omitted for a single piece: 120#>3.
+func EncodePieceStates(states []PieceState) (encoded string, err error) {
+	b := &strings.Builder{}
+	for i := 0; i < len(states); {
+		j := i
+		for j < len(states) && states[j] == states[i] {
+			j++
+		}
+		symbol, ok := pieceStateSymbols[states[i]]
+		if !ok {
+			return "", fmt.Errorf("piece states: unknown state %d at %d", states[i], i)
+		}
+		if j-i > 1 {
+			b.WriteString(strconv.Itoa(j - i))
+		}
+		b.WriteByte(symbol)
+		i = j
+	}
+	return b.String(), nil
+}
+
+// DecodePieceStates decode EncodePieceStates output, maxPieces bound the number of states
+// so a corrupted run length can not allocate without limit
+func DecodePieceStates(encoded string, maxPieces int) (states []PieceState, err error) {
+	if maxPieces <= 0 {
+		return nil, fmt.Errorf("piece states: invalid piece count %d", maxPieces)
+	}
+	count := 0
+	// digits tell an explicit run length from the implicit run of one
+	digits := false
+	for i := 0; i < len(encoded); i++ {
+		c := encoded[i]
+		if c >= '0' && c <= '9' {
+			count = count*10 + int(c-'0')
+			digits = true
+			// checked on every digit so count never overflows
+			if count > maxPieces-len(states) {
+				return nil, fmt.Errorf("piece states: more than %d pieces at %d", maxPieces, i)
+			}
+			continue
+		}
+		state := PieceState(-1)
+		for k, v := range pieceStateSymbols {
+			if v == c {
+				state = k
+			}
+		}
+		if state < 0 {
+			return nil, fmt.Errorf("piece states: unexpected %q at %d", c, i)
+		}
+		switch {
+		case digits && count == 0:
+			return nil, fmt.Errorf("piece states: empty run at %d", i)
+		case !digits:
+			count = 1
+		}
+		digits = false
+		if count > maxPieces-len(states) {
+			return nil, fmt.Errorf("piece states: more than %d pieces at %d", maxPieces, i)
+		}
+		for ; count > 0; count-- {
+			states = append(states, state)
+		}
+	}
+	if digits {
+		return nil, fmt.Errorf("piece states: run of %d without a state", count)
+	}
+	return
+}
@@ -0,0 +1,137 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"fmt"
+	"image/png"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"testing"
+)
+
+func testPieceMap() *PieceMap {
+	states, _ := DecodePieceStates("4#2>3.#2.", 12)
+	return &PieceMap{
+		States:    states,
+		PieceSize: 100,
+		TotalSize: 1150,
+		Files: []*TorrentManagementFile{
+			{Index: 0, Name: "a", Size: 450, PieceRange: []int{0, 4}},
+			{Index: 1, Name: "b", Size: 700, PieceRange: []int{4, 11}},
+		},
+	}
+}
+
+func TestPieceStatesEncoding(t *testing.T) {
+	states := []PieceState{2, 2, 2, 2, 1, 1, 0, 0, 0, 2, 0, 0}
+	if encoded, err := EncodePieceStates(states); err != nil || encoded != "4#2>3.#2." {
+		t.Fatalf("unexpected encoding %s %v", encoded, err)
+	}
+	decoded, err := DecodePieceStates("4#2>3.#2.", 12)
+	if err != nil || fmt.Sprint(decoded) != fmt.Sprint(states) {
+		t.Fatalf("unexpected decoding %v %v", decoded, err)
+	}
+	for _, it := range []string{"3", "2x", "99999999999999999999#", "9223372036854775807#", "10#3.", "12#.", "0#", "2#00.", "0"} {
+		if _, err = DecodePieceStates(it, 12); err == nil {
+			t.Errorf("expected an error for %q", it)
+		}
+	}
+	if _, err = DecodePieceStates("#", 0); err == nil {
+		t.Error("expected an error without a piece count")
+	}
+	if _, err = EncodePieceStates([]PieceState{2, 5}); err == nil {
+		t.Error("expected an error for an unknown state")
+	}
+}
+
+func TestPieceMap(t *testing.T) {
+	pm := testPieceMap()
+	if pm.Have() != 5 || pm.ContiguousFrom(0) != 4 || pm.ContiguousFrom(9) != 1 || pm.ContiguousFrom(4) != 0 {
+		t.Fatalf("unexpected counts %d %d", pm.Have(), pm.ContiguousFrom(0))
+	}
+	if fmt.Sprint(pm.Downloaded()) != "[{0 3} {9 9}]" || fmt.Sprint(pm.Missing()) != "[{4 8} {10 11}]" || fmt.Sprint(pm.Runs(PieceStateNowDownloading)) != "[{4 5}]" {
+		t.Fatalf("unexpected ranges %v %v", pm.Downloaded(), pm.Missing())
+	}
+	if start, end := pm.ByteRange(PieceRange{10, 11}); start != 1000 || end != 1150 {
+		t.Fatalf("unexpected byte range %d %d", start, end)
+	}
+
+	files := pm.FilePieces()
+	if files[0].Have != 4 || files[0].Completion != 0.8 || fmt.Sprint(files[0].Missing) != "[{4 4}]" {
+		t.Fatalf("unexpected first file %+v", files[0])
+	}
+	if files[1].Have != 1 || fmt.Sprint(files[1].Missing) != "[{4 8} {10 11}]" {
+		t.Fatalf("unexpected second file %+v", files[1])
+	}
+
+	if bar := pm.ASCII(6); bar != "##>.+." {
+		t.Fatalf("unexpected bar %q", bar)
+	}
+	// fewer pieces than columns
+	if bar := pm.ASCII(24); bar != "########>>>>......##...." {
+		t.Fatalf("unexpected wide bar %q", bar)
+	}
+}
+
+func TestPieceMap_PNG(t *testing.T) {
+	buf := &bytes.Buffer{}
+	err := testPieceMap().PNG(buf, 6, 2)
+	if err != nil {
+		t.Fatal(err)
+	}
+	img, err := png.Decode(buf)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if img.Bounds().Dx() != 6 || img.Bounds().Dy() != 2 {
+		t.Fatalf("unexpected size %v", img.Bounds())
+	}
+	if img.At(0, 0) != pieceDoneColor || img.At(2, 1) != pieceActiveColor || img.At(3, 0) != pieceMissingColor {
+		t.Fatalf("unexpected colors %v %v %v", img.At(0, 0), img.At(2, 1), img.At(3, 0))
+	}
+}
+
+func TestTorrentManagement_PieceMapOffline(t *testing.T) {
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/torrents/pieceStates":
+			w.Write([]byte(`[2,2,1,0]`))
+		case "/api/v2/torrents/properties":
+			w.Write([]byte(`{"piece_size":16384}`))
+		case "/api/v2/torrents/files":
+			w.Write([]byte(`[{"index":0,"name":"a","size":30000,"piece_range":[0,1]},{"index":1,"name":"b","size":30000,"piece_range":[1,3]}]`))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	pm, err := client.TorrentManagement.PieceMap(context.Background(), "hash")
+	if err != nil {
+		t.Fatal(err)
+	}
+	if pm.PieceSize != 16384 || pm.TotalSize != 60000 || len(pm.FilePieces()) != 2 || pm.ASCII(4) != "##>." {
+		t.Fatalf("unexpected piece map %+v", pm)
+	}
+}
+
+func TestTorrentManagement_PieceMap(t *testing.T) {
+	infoList, err := api.TorrentManagement.Info(context.Background(), TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, it := range infoList {
+		pm, err := api.TorrentManagement.PieceMap(context.Background(), it.Hash)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		encoded, err := EncodePieceStates(pm.States)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(it.Name, pm.ASCII(60), encoded)
+	}
+}
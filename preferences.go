@@ -0,0 +1,180 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"net/http"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// PreferenceChange is a single changed key, values are in their json form
+type PreferenceChange struct {
+	Key string
+	Old json.RawMessage
+	New json.RawMessage
+}
+
+func (pc PreferenceChange) String() string {
+	return fmt.Sprintf("%s: %s -> %s", pc.Key, pc.Old, pc.New)
+}
+
+func preferencesFields(pref *Preferences) (fields map[string]json.RawMessage, err error) {
+	content, err := json.Marshal(pref)
+	if err != nil {
+		return
+	}
+	err = json.Unmarshal(content, &fields)
+	return
+}
+
+// DiffPreferences list keys whose value differ between a and b sorted by key
+func DiffPreferences(a, b *Preferences) (changes []PreferenceChange, err error) {
+	before, err := preferencesFields(a)
+	if err != nil {
+		return
+	}
+	after, err := preferencesFields(b)
+	if err != nil {
+		return
+	}
+
+	for key, value := range after {
+		if !bytes.Equal(before[key], value) {
+			changes = append(changes, PreferenceChange{Key: key, Old: before[key], New: value})
+		}
+	}
+	sort.Slice(changes, func(i, j int) bool {
+		return changes[i].Key < changes[j].Key
+	})
+	return
+}
+
+// SetPreferenceValues send only the given keys, values are marshaled as they are
+func (a *App) SetPreferenceValues(ctx context.Context, values map[string]any) (err error) {
+	path := "/api/v2/app/setPreferences"
+
+	content, err := json.Marshal(values)
+	if err != nil {
+		return
+	}
+	formData := url.Values{
+		"json": []string{string(content)},
+	}
+	err = a.api.doRequest(ctx, http.MethodPost, path, nil, formData, emptyResponse)
+	if err != nil {
+		return
+	}
+	return
+}
+
+type PreferencesUpdateOptions struct {
+	// DryRun validate and return the changes without sending them
+	DryRun bool
+	// SkipValidation send values even if the changed keys fail ValidatePreferences
+	SkipValidation bool
+}
+
+// UpdatePreferences fetch current preferences, let update modify a copy and send only the keys it changed
+func (a *App) UpdatePreferences(ctx context.Context, update func(pref *Preferences), opts PreferencesUpdateOptions) (changes []PreferenceChange, err error) {
+	current, err := a.Preferences(ctx)
+	if err != nil {
+		return
+	}
+	desired := *current
+	update(&desired)
+	return a.ApplyPreferences(ctx, current, &desired, opts)
+}
+
+// ApplyPreferences send the keys that differ between current and desired
+func (a *App) ApplyPreferences(ctx context.Context, current, desired *Preferences, opts PreferencesUpdateOptions) (changes []PreferenceChange, err error) {
+	changes, err = DiffPreferences(current, desired)
+	if err != nil {
+		return
+	}
+	if !opts.SkipValidation {
+		// only the changed keys are checked so an invalid value already on the server does not block others
+		keys := make(map[string]bool, len(changes))
+		for _, it := range changes {
+			keys[it.Key] = true
+		}
+		err = validatePreferenceKeys(desired, keys)
+		if err != nil {
+			return
+		}
+	}
+	if opts.DryRun || len(changes) == 0 {
+		return
+	}
+
+	values := make(map[string]any, len(changes))
+	for _, it := range changes {
+		values[it.Key] = it.New
+	}
+	err = a.SetPreferenceValues(ctx, values)
+	return
+}
+
+// ValidatePreferences check enum fields and port ranges, every problem is joined in the returned error
+func ValidatePreferences(pref *Preferences) error {
+	return validatePreferenceKeys(pref, nil)
+}
+
+// validatePreferenceKeys only report the problems involving one of keys, nil keys check everything
+func validatePreferenceKeys(pref *Preferences, keys map[string]bool) error {
+	var errs []error
+	// names is the space separated list of keys the check depends on
+	check := func(names string, ok bool, format string, args ...any) {
+		if ok {
+			return
+		}
+		involved := keys == nil
+		for _, it := range strings.Fields(names) {
+			involved = involved || keys[it]
+		}
+		if involved {
+			errs = append(errs, fmt.Errorf(format, args...))
+		}
+	}
+	between := func(v, min, max int64) bool {
+		return v >= min && v <= max
+	}
+	port := func(name string, v int64, allowZero bool) {
+		var min int64 = 1
+		if allowZero {
+			min = 0
+		}
+		check(name, between(v, min, 65535), "%s %d is not a valid port", name, v)
+	}
+
+	check("proxy_type", pref.ProxyType == ProxyDisabled || between(int64(pref.ProxyType), 1, 5), "proxy_type %d is invalid", pref.ProxyType)
+	check("encryption", between(int64(pref.Encryption), 0, 2), "encryption %d is invalid", pref.Encryption)
+	check("max_ratio_act", between(int64(pref.MaxRatioAct), 0, 3), "max_ratio_act %d is invalid", pref.MaxRatioAct)
+	check("scheduler_days", between(int64(pref.SchedulerDays), 0, 9), "scheduler_days %d is invalid", pref.SchedulerDays)
+	check("dyndns_service", between(int64(pref.DyndnsService), 0, 1), "dyndns_service %d is invalid", pref.DyndnsService)
+	check("bittorrent_protocol", between(int64(pref.BittorrentProtocol), 0, 2), "bittorrent_protocol %d is invalid", pref.BittorrentProtocol)
+	check("upload_choking_algorithm", between(int64(pref.UploadChokingAlgorithm), 0, 2), "upload_choking_algorithm %d is invalid", pref.UploadChokingAlgorithm)
+	check("upload_slots_behavior", between(int64(pref.UploadSlotsBehavior), 0, 1), "upload_slots_behavior %d is invalid", pref.UploadSlotsBehavior)
+	check("utp_tcp_mixed_mode", between(int64(pref.UTPTCPMixedMode), 0, 1), "utp_tcp_mixed_mode %d is invalid", pref.UTPTCPMixedMode)
+
+	port("listen_port", pref.ListenPort, true)
+	port("web_ui_port", pref.WebUIPort, false)
+	port("embedded_tracker_port", pref.EmbeddedTrackerPort, true)
+	port("outgoing_ports_min", pref.OutgoingPortsMin, true)
+	port("outgoing_ports_max", pref.OutgoingPortsMax, true)
+	check("outgoing_ports_min outgoing_ports_max", pref.OutgoingPortsMax == 0 || pref.OutgoingPortsMin <= pref.OutgoingPortsMax,
+		"outgoing_ports_min %d is greater than outgoing_ports_max %d", pref.OutgoingPortsMin, pref.OutgoingPortsMax)
+	check("proxy_port proxy_type", between(pref.ProxyPort, 0, 65535) && (pref.ProxyType == ProxyDisabled || pref.ProxyPort > 0),
+		"proxy_port %d is not a valid port", pref.ProxyPort)
+
+	check("schedule_from_hour schedule_to_hour", between(pref.ScheduleFromHour, 0, 23) && between(pref.ScheduleToHour, 0, 23), "schedule hours must be between 0 and 23")
+	check("schedule_from_min schedule_to_min", between(pref.ScheduleFromMin, 0, 59) && between(pref.ScheduleToMin, 0, 59), "schedule minutes must be between 0 and 59")
+	check("max_ratio", pref.MaxRatio == -1 || pref.MaxRatio >= 0, "max_ratio %v is invalid", pref.MaxRatio)
+	check("max_seeding_time", pref.MaxSeedingTime >= -1, "max_seeding_time %d is invalid", pref.MaxSeedingTime)
+
+	return errors.Join(errs...)
+}
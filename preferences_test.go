@@ -0,0 +1,110 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"io"
+	"net/http"
+	"net/http/httptest"
+	"net/url"
+	"strings"
+	"testing"
+)
+
+func validPreferences() *Preferences {
+	return &Preferences{
+		SavePath:    "/downloads",
+		ListenPort:  6881,
+		WebUIPort:   8080,
+		ProxyType:   ProxyDisabled,
+		MaxRatio:    -1,
+		MaxRatioAct: PauseTorrent,
+	}
+}
+
+func TestDiffPreferences(t *testing.T) {
+	a := validPreferences()
+	b := *a
+	b.ListenPort = 51413
+	b.SchedulerDays = EveryWeekend
+
+	changes, err := DiffPreferences(a, &b)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || changes[0].Key != "listen_port" || string(changes[0].New) != "51413" || changes[1].Key != "scheduler_days" {
+		t.Fatalf("unexpected changes %v", changes)
+	}
+}
+
+func TestValidatePreferences(t *testing.T) {
+	if err := ValidatePreferences(validPreferences()); err != nil {
+		t.Fatal(err)
+	}
+
+	// a zero Preferences is what resets a server when sent whole
+	err := ValidatePreferences(&Preferences{ProxyType: 0, Encryption: 3, SchedulerDays: 10, ListenPort: 70000})
+	if err == nil {
+		t.Fatal("expected validation error")
+	}
+	for _, it := range []string{"proxy_type", "encryption", "scheduler_days", "listen_port", "web_ui_port"} {
+		if !strings.Contains(err.Error(), it) {
+			t.Errorf("%s is not reported in %v", it, err)
+		}
+	}
+}
+
+func TestApp_ApplyPreferences(t *testing.T) {
+	var sent map[string]any
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		body, _ := io.ReadAll(r.Body)
+		form, _ := url.ParseQuery(string(body))
+		json.Unmarshal([]byte(form.Get("json")), &sent)
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	current := validPreferences()
+	desired := *current
+	desired.DLLimit = 1024
+
+	_, err = client.App.ApplyPreferences(context.Background(), current, &desired, PreferencesUpdateOptions{DryRun: true})
+	if err != nil || sent != nil {
+		t.Fatalf("dry run sent %v err %v", sent, err)
+	}
+
+	changes, err := client.App.ApplyPreferences(context.Background(), current, &desired, PreferencesUpdateOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 1 || len(sent) != 1 || sent["dl_limit"] != float64(1024) {
+		t.Fatalf("unexpected request %v", sent)
+	}
+
+	desired.Encryption = 5
+	_, err = client.App.ApplyPreferences(context.Background(), current, &desired, PreferencesUpdateOptions{})
+	if err == nil {
+		t.Fatal("invalid preferences were sent")
+	}
+
+	// an invalid value already on the server does not block an unrelated change
+	current.Encryption = 5
+	sent = nil
+	_, err = client.App.ApplyPreferences(context.Background(), current, &desired, PreferencesUpdateOptions{})
+	if err != nil || len(sent) != 1 || sent["dl_limit"] != float64(1024) {
+		t.Fatalf("unexpected request %v err %v", sent, err)
+	}
+}
+
+func TestApp_UpdatePreferences(t *testing.T) {
+	changes, err := api.App.UpdatePreferences(context.Background(), func(pref *Preferences) {
+		pref.AltDLLimit = 10240
+	}, PreferencesUpdateOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(changes)
+}
@@ -0,0 +1,213 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultQueueManagerInterval = 30 * time.Second
+
+// QueueWeights is a ready made score, higher scores go to the front of the queue
+type QueueWeights struct {
+	// Categories add a weight per category
+	Categories map[string]float64
+	// Tags add a weight per tag, a torrent with several tags sums them
+	Tags map[string]float64
+	// PerGiB is added for every GiB of total size, negative values favor small torrents
+	PerGiB float64
+	// PerDay is added for every day since the torrent was added, positive values favor old torrents
+	PerDay float64
+}
+
+func (qw *QueueWeights) Score(torrent Torrent, now time.Time) (score float64) {
+	score += qw.Categories[torrent.Category]
+	for _, it := range SplitTags(torrent.Tags) {
+		score += qw.Tags[it]
+	}
+	score += qw.PerGiB * float64(torrent.TotalSize) / (1 << 30)
+	if torrent.AddedOn > 0 {
+		score += qw.PerDay * now.Sub(time.Unix(int64(torrent.AddedOn), 0)).Hours() / 24
+	}
+	return
+}
+
+type QueueOpKind string
+
+const QueueTop QueueOpKind = "top"
+const QueueBottom QueueOpKind = "bottom"
+
+// QueueOp move torrents to the top or bottom of the queue, qBittorrent keeps their relative order
+type QueueOp struct {
+	Kind   QueueOpKind
+	Hashes []string
+}
+
+func (qo QueueOp) String() string {
+	return fmt.Sprintf("%s %v", qo.Kind, qo.Hashes)
+}
+
+// planTop return the groups to move to the top, in call order, so current ends up ordered as desired.
+// The longest tail of desired already in order stays in place and the rest is cut in runs already in order
+func planTop(current, desired []string) (groups [][]string) {
+	pos := make(map[string]int, len(current))
+	for i, it := range current {
+		pos[it] = i
+	}
+	k := len(desired) - 1
+	for k > 0 && pos[desired[k-1]] < pos[desired[k]] {
+		k--
+	}
+	if len(desired) == 0 || k == 0 {
+		return
+	}
+	var runs [][]string
+	start := 0
+	for i := 1; i <= k; i++ {
+		if i == k || pos[desired[i]] < pos[desired[i-1]] {
+			runs = append(runs, desired[start:i])
+			start = i
+		}
+	}
+	for i := len(runs) - 1; i >= 0; i-- {
+		groups = append(groups, runs[i])
+	}
+	return
+}
+
+func reversed(list []string) []string {
+	r := make([]string, len(list))
+	for i, it := range list {
+		r[len(list)-1-i] = it
+	}
+	return r
+}
+
+func countHashes(groups [][]string) (n int) {
+	for _, it := range groups {
+		n += len(it)
+	}
+	return
+}
+
+// PlanQueue return the shortest of the top-only and bottom-only sequences turning current into desired,
+// moving fewer torrents on a tie, both list the same hashes from the front of the queue
+func PlanQueue(current, desired []string) (ops []QueueOp) {
+	top := planTop(current, desired)
+	// moving to the bottom is moving to the top of the reversed queue
+	bottom := planTop(reversed(current), reversed(desired))
+	kind, groups := QueueTop, top
+	if len(bottom) < len(top) || len(bottom) == len(top) && countHashes(bottom) < countHashes(top) {
+		kind, groups = QueueBottom, bottom
+	}
+	for _, it := range groups {
+		hashes := append([]string{}, it...)
+		if kind == QueueBottom {
+			hashes = reversed(hashes)
+		}
+		ops = append(ops, QueueOp{Kind: kind, Hashes: hashes})
+	}
+	return
+}
+
+type QueueManagerOptions struct {
+	// Score rank queued torrents, higher goes first and ties keep the current order
+	Score func(torrent Torrent, now time.Time) float64
+	// Interval default to DefaultQueueManagerInterval
+	Interval time.Duration
+	// DryRun only plan the moves
+	DryRun bool
+}
+
+// QueueManager keep the qBittorrent queue ordered by a score,
+// only torrents with a queue position, Priority above zero, are ordered
+type QueueManager struct {
+	api     *Api
+	opts    QueueManagerOptions
+	tracker *MainDataTracker
+	now     func() time.Time
+	mu      sync.Mutex
+}
+
+func (a *Api) NewQueueManager(opts QueueManagerOptions) *QueueManager {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultQueueManagerInterval
+	}
+	return &QueueManager{api: a, opts: opts, tracker: a.Sync.NewMainDataTracker(opts.Interval), now: time.Now}
+}
+
+// order return the queued hashes by current position and by score
+func (qm *QueueManager) order(torrents map[string]Torrent) (current, desired []string) {
+	for hash, torrent := range torrents {
+		if torrent.Priority > 0 {
+			current = append(current, hash)
+		}
+	}
+	sort.Slice(current, func(i, j int) bool {
+		return torrents[current[i]].Priority < torrents[current[j]].Priority
+	})
+
+	now := qm.now()
+	scores := make(map[string]float64, len(current))
+	for _, hash := range current {
+		scores[hash] = qm.opts.Score(torrents[hash], now)
+	}
+	desired = append([]string{}, current...)
+	sort.SliceStable(desired, func(i, j int) bool { return scores[desired[i]] > scores[desired[j]] })
+	return
+}
+
+// Check update torrents and reorder the queue when it does not follow the score
+func (qm *QueueManager) Check(ctx context.Context) (ops []QueueOp, err error) {
+	if qm.opts.Score == nil {
+		return nil, errors.New("queue manager needs a score")
+	}
+	err = qm.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	qm.mu.Lock()
+	defer qm.mu.Unlock()
+
+	ops = PlanQueue(qm.order(qm.tracker.Torrents()))
+	if qm.opts.DryRun {
+		return
+	}
+	for _, it := range ops {
+		if it.Kind == QueueTop {
+			err = qm.api.TorrentManagement.TopPriority(ctx, it.Hashes, false)
+		} else {
+			err = qm.api.TorrentManagement.BottomPriority(ctx, it.Hashes, false)
+		}
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Run check every Interval until ctx is done or a check fails, onCheck may be nil
+func (qm *QueueManager) Run(ctx context.Context, onCheck func(ops []QueueOp)) (err error) {
+	ticker := time.NewTicker(qm.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		var ops []QueueOp
+		ops, err = qm.Check(ctx)
+		if err != nil {
+			return
+		}
+		if onCheck != nil {
+			onCheck(ops)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
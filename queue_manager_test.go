@@ -0,0 +1,144 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"math/rand"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+// applyQueueOp move hashes like qBittorrent, keeping their relative order
+func applyQueueOp(queue []string, op QueueOp) []string {
+	moved := map[string]bool{}
+	for _, it := range op.Hashes {
+		moved[it] = true
+	}
+	var picked, rest []string
+	for _, it := range queue {
+		if moved[it] {
+			picked = append(picked, it)
+		} else {
+			rest = append(rest, it)
+		}
+	}
+	if op.Kind == QueueTop {
+		return append(picked, rest...)
+	}
+	return append(rest, picked...)
+}
+
+func TestPlanQueue(t *testing.T) {
+	cases := []struct {
+		current  string
+		desired  string
+		expected string
+	}{
+		{"a,b,c,d", "a,b,c,d", ""},
+		{"a,b,c,d", "d,a,b,c", "top [d]"},
+		{"a,b,c,d", "b,c,d,a", "bottom [a]"},
+		{"a,b,c,d,e", "c,e,a,b,d", "top [c e]"},
+		{"a,b,c,d", "d,c,b,a", "top [b];top [c];top [d]"},
+	}
+	for _, it := range cases {
+		var got []string
+		for _, op := range PlanQueue(strings.Split(it.current, ","), strings.Split(it.desired, ",")) {
+			got = append(got, op.String())
+		}
+		if strings.Join(got, ";") != it.expected {
+			t.Errorf("%s -> %s: got %q, want %q", it.current, it.desired, strings.Join(got, ";"), it.expected)
+		}
+	}
+
+	r := rand.New(rand.NewSource(1))
+	for i := 0; i < 200; i++ {
+		current := make([]string, r.Intn(12))
+		for j := range current {
+			current[j] = fmt.Sprint(j)
+		}
+		desired := append([]string{}, current...)
+		r.Shuffle(len(desired), func(i, j int) { desired[i], desired[j] = desired[j], desired[i] })
+		queue := current
+		for _, op := range PlanQueue(current, desired) {
+			queue = applyQueueOp(queue, op)
+		}
+		if strings.Join(queue, ",") != strings.Join(desired, ",") {
+			t.Fatalf("%v -> %v ended as %v", current, desired, queue)
+		}
+	}
+}
+
+func TestQueueWeights_Score(t *testing.T) {
+	now := time.Date(2024, 1, 11, 0, 0, 0, 0, time.UTC)
+	weights := &QueueWeights{Categories: map[string]float64{"tv": 10}, Tags: map[string]float64{"urgent": 100}, PerGiB: -1, PerDay: 0.5}
+	torrent := Torrent{Category: "tv", Tags: "hd, urgent", TotalSize: 4 << 30, AddedOn: int(now.Add(-10 * 24 * time.Hour).Unix())}
+	if score := weights.Score(torrent, now); score != 10+100-4+5 {
+		t.Fatalf("unexpected score %v", score)
+	}
+}
+
+func TestQueueManager_Check(t *testing.T) {
+	var mu sync.Mutex
+	queue := []string{"a", "b", "c", "d"}
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/sync/maindata":
+			var items []string
+			for i, hash := range queue {
+				items = append(items, fmt.Sprintf(`"%s":{"priority":%d,"tags":"%s"}`, hash, i+1, map[string]string{"c": "urgent"}[hash]))
+			}
+			items = append(items, `"seeding":{"priority":0,"tags":"urgent"}`)
+			fmt.Fprintf(w, `{"rid":1,"full_update":true,"torrents":{%s}}`, strings.Join(items, ","))
+		case "/api/v2/torrents/topPrio":
+			hashes := strings.Split(r.Form.Get("hashes"), "|")
+			calls = append(calls, "top "+r.Form.Get("hashes"))
+			// qBittorrent order the moved torrents by their current position
+			sort.Slice(hashes, func(i, j int) bool {
+				return strings.Index(strings.Join(queue, ""), hashes[i]) < strings.Index(strings.Join(queue, ""), hashes[j])
+			})
+			queue = applyQueueOp(queue, QueueOp{Kind: QueueTop, Hashes: hashes})
+		default:
+			calls = append(calls, r.URL.Path)
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	weights := &QueueWeights{Tags: map[string]float64{"urgent": 1}}
+	qm := client.NewQueueManager(QueueManagerOptions{Score: weights.Score})
+	ops, err := qm.Check(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(ops) != 1 || strings.Join(calls, ",") != "top c" || strings.Join(queue, ",") != "c,a,b,d" {
+		t.Fatalf("unexpected ops %v calls %v queue %v", ops, calls, queue)
+	}
+	ops, err = qm.Check(context.Background())
+	if err != nil || len(ops) != 0 {
+		t.Fatalf("queue already ordered %v %v", ops, err)
+	}
+}
+
+func TestQueueManager_DryRun(t *testing.T) {
+	weights := &QueueWeights{PerGiB: -1}
+	qm := api.NewQueueManager(QueueManagerOptions{Score: weights.Score, DryRun: true})
+	ops, err := qm.Check(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(ops)
+}
@@ -0,0 +1,352 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"path"
+	"regexp"
+	"sort"
+	"strconv"
+	"strings"
+	"text/template"
+)
+
+// RenameRule rename the file paths matching Match, either with a regexp Replace using $1 or ${name},
+// or with a text/template executed with the named groups plus path, base, dir and ext.
+// Template functions: spaces turn dots and underscores into spaces, pad zero pads numbers, lower, upper and trim
+type RenameRule struct {
+	Match    string
+	Replace  string
+	Template string
+}
+
+type renameRule struct {
+	re   *regexp.Regexp
+	rule RenameRule
+	tmpl *template.Template
+}
+
+var renameTemplateFuncs = template.FuncMap{
+	"spaces": func(s string) string {
+		return strings.Join(strings.FieldsFunc(s, func(r rune) bool { return r == '.' || r == '_' || r == ' ' }), " ")
+	},
+	"pad": func(width int, s string) string {
+		n, err := strconv.Atoi(s)
+		if err != nil {
+			return s
+		}
+		return fmt.Sprintf("%0*d", width, n)
+	},
+	"lower": strings.ToLower,
+	"upper": strings.ToUpper,
+	"trim":  strings.TrimSpace,
+}
+
+// Renamer compute new paths with the first matching rule
+type Renamer struct {
+	rules []renameRule
+}
+
+func NewRenamer(rules ...RenameRule) (renamer *Renamer, err error) {
+	renamer = &Renamer{}
+	for i, it := range rules {
+		compiled := renameRule{rule: it}
+		if (it.Replace == "") == (it.Template == "") {
+			return nil, fmt.Errorf("rename rule %d: set either replace or template", i+1)
+		}
+		compiled.re, err = regexp.Compile(it.Match)
+		if err != nil {
+			return nil, fmt.Errorf("rename rule %d: %w", i+1, err)
+		}
+		if it.Template != "" {
+			compiled.tmpl, err = template.New("rename").Funcs(renameTemplateFuncs).Option("missingkey=error").Parse(it.Template)
+			if err != nil {
+				return nil, fmt.Errorf("rename rule %d: %w", i+1, err)
+			}
+		}
+		renamer.rules = append(renamer.rules, compiled)
+	}
+	return
+}
+
+// Rename return the new path of p, ok is false when no rule matches
+func (r *Renamer) Rename(p string) (renamed string, ok bool, err error) {
+	for _, it := range r.rules {
+		match := it.re.FindStringSubmatchIndex(p)
+		if match == nil {
+			continue
+		}
+		if it.tmpl == nil {
+			return it.re.ReplaceAllString(p, it.rule.Replace), true, nil
+		}
+		data := map[string]string{"path": p, "base": path.Base(p), "dir": path.Dir(p), "ext": strings.TrimPrefix(path.Ext(p), ".")}
+		for i, name := range it.re.SubexpNames() {
+			if name != "" && match[2*i] >= 0 {
+				data[name] = p[match[2*i]:match[2*i+1]]
+			}
+		}
+		buf := &strings.Builder{}
+		err = it.tmpl.Execute(buf, data)
+		if err != nil {
+			return "", false, fmt.Errorf("%s: %w", p, err)
+		}
+		return buf.String(), true, nil
+	}
+	return p, false, nil
+}
+
+type RenameKind string
+
+const RenameFile RenameKind = "file"
+const RenameFolder RenameKind = "folder"
+
+type RenameOp struct {
+	Kind RenameKind
+	Old  string
+	New  string
+}
+
+func (ro RenameOp) String() string {
+	return fmt.Sprintf("%s %s -> %s", ro.Kind, ro.Old, ro.New)
+}
+
+// RenamePlan is the ordered renames of a torrent, applying them in order never overwrites a path
+type RenamePlan struct {
+	Hash string
+	Ops  []RenameOp
+}
+
+func (rp *RenamePlan) String() string {
+	lines := make([]string, len(rp.Ops))
+	for i, it := range rp.Ops {
+		lines[i] = it.String()
+	}
+	return strings.Join(lines, "\n")
+}
+
+func validRenamePath(p string) bool {
+	if p == "" || strings.HasPrefix(p, "/") || path.Clean(p) != p {
+		return false
+	}
+	for _, it := range strings.Split(p, "/") {
+		if it == ".." || it == "." {
+			return false
+		}
+	}
+	return true
+}
+
+// Plan compute the renames of the files of a torrent. Folders whose files all move together become
+// a single folder rename, collisions are errors and renames are ordered so a path is freed before it is reused
+func (r *Renamer) Plan(hash string, files []*TorrentManagementFile) (plan *RenamePlan, err error) {
+	renames := map[string]string{}
+	var paths []string
+	for _, file := range files {
+		paths = append(paths, file.Name)
+		renamed, ok, renameErr := r.Rename(file.Name)
+		if renameErr != nil {
+			return nil, renameErr
+		}
+		if !ok || renamed == file.Name {
+			continue
+		}
+		if !validRenamePath(renamed) {
+			return nil, fmt.Errorf("%s: invalid new path %q", file.Name, renamed)
+		}
+		renames[file.Name] = renamed
+	}
+	sort.Strings(paths)
+
+	err = checkRenameCollisions(paths, renames)
+	if err != nil {
+		return
+	}
+
+	plan = &RenamePlan{Hash: hash}
+	folders, rest := renameFolders(paths, renames)
+	plan.Ops = append(plan.Ops, folders...)
+	plan.Ops = append(plan.Ops, orderRenames(rest)...)
+	return
+}
+
+// checkRenameCollisions verify the final paths are distinct and no file ends up where a folder is needed
+func checkRenameCollisions(paths []string, renames map[string]string) error {
+	final := map[string]string{}
+	for _, it := range paths {
+		target := it
+		if renamed, ok := renames[it]; ok {
+			target = renamed
+		}
+		if other, ok := final[target]; ok {
+			return fmt.Errorf("%s and %s would both be renamed to %s", other, it, target)
+		}
+		final[target] = it
+	}
+	for target, source := range final {
+		for dir := path.Dir(target); dir != "."; dir = path.Dir(dir) {
+			if other, ok := final[dir]; ok {
+				return fmt.Errorf("%s would be renamed to %s inside the file %s", source, target, other)
+			}
+		}
+	}
+	return nil
+}
+
+// renameFolders return the folder renames moving every file of a folder at once, top folders first,
+// and the file renames left
+func renameFolders(paths []string, renames map[string]string) (ops []RenameOp, rest map[string]string) {
+	rest = map[string]string{}
+	for k, v := range renames {
+		rest[k] = v
+	}
+	dirs := map[string]bool{}
+	for _, it := range paths {
+		for dir := path.Dir(it); dir != "."; dir = path.Dir(dir) {
+			dirs[dir] = true
+		}
+	}
+	var sorted []string
+	for dir := range dirs {
+		sorted = append(sorted, dir)
+	}
+	sort.Slice(sorted, func(i, j int) bool {
+		di, dj := strings.Count(sorted[i], "/"), strings.Count(sorted[j], "/")
+		if di != dj {
+			return di < dj
+		}
+		return sorted[i] < sorted[j]
+	})
+
+	for _, dir := range sorted {
+		newDir := ""
+		moved := true
+		count := 0
+		for _, it := range paths {
+			if !strings.HasPrefix(it, dir+"/") {
+				continue
+			}
+			count++
+			renamed, ok := rest[it]
+			if !ok {
+				moved = false
+				break
+			}
+			rel := strings.TrimPrefix(it, dir+"/")
+			if !strings.HasSuffix(renamed, "/"+rel) {
+				moved = false
+				break
+			}
+			candidate := strings.TrimSuffix(renamed, "/"+rel)
+			if newDir != "" && candidate != newDir {
+				moved = false
+				break
+			}
+			newDir = candidate
+		}
+		if !moved || count == 0 || newDir == "" {
+			continue
+		}
+		// a folder cannot be renamed into an existing folder or over a file
+		if dirs[newDir] || strings.HasPrefix(newDir, dir+"/") || pathInUse(paths, newDir) {
+			continue
+		}
+		ops = append(ops, RenameOp{Kind: RenameFolder, Old: dir, New: newDir})
+		for _, it := range paths {
+			if strings.HasPrefix(it, dir+"/") {
+				delete(rest, it)
+			}
+		}
+		dirs[newDir] = true
+	}
+	return
+}
+
+func pathInUse(paths []string, p string) bool {
+	for _, it := range paths {
+		if it == p || strings.HasPrefix(it, p+"/") {
+			return true
+		}
+	}
+	return false
+}
+
+// orderRenames sort file renames so a target is only used once its current file moved away,
+// cycles go through a temporary name
+func orderRenames(renames map[string]string) (ops []RenameOp) {
+	pending := map[string]string{}
+	for k, v := range renames {
+		pending[k] = v
+	}
+	for len(pending) > 0 {
+		var sources []string
+		for source := range pending {
+			sources = append(sources, source)
+		}
+		sort.Strings(sources)
+
+		progress := false
+		for _, source := range sources {
+			target := pending[source]
+			if _, busy := pending[target]; busy {
+				continue
+			}
+			ops = append(ops, RenameOp{Kind: RenameFile, Old: source, New: target})
+			delete(pending, source)
+			progress = true
+		}
+		if progress {
+			continue
+		}
+		// every pending target is still occupied, break the cycle
+		source := sources[0]
+		tmp := source + ".renaming"
+		for i := 1; ; i++ {
+			if _, busy := pending[tmp]; !busy && renames[tmp] == "" {
+				break
+			}
+			tmp = fmt.Sprintf("%s.renaming%d", source, i)
+		}
+		ops = append(ops, RenameOp{Kind: RenameFile, Old: source, New: tmp})
+		pending[tmp] = pending[source]
+		delete(pending, source)
+	}
+	return
+}
+
+// PlanRename compute the renames of a torrent from its files
+func (tm *TorrentManagement) PlanRename(ctx context.Context, hash string, renamer *Renamer) (plan *RenamePlan, err error) {
+	files, err := tm.Files(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	return renamer.Plan(hash, files)
+}
+
+func (tm *TorrentManagement) applyRenameOp(ctx context.Context, hash string, op RenameOp) error {
+	if op.Kind == RenameFolder {
+		return tm.RenameFolder(ctx, hash, op.Old, op.New)
+	}
+	return tm.RenameFile(ctx, hash, op.Old, op.New)
+}
+
+// ApplyRename run the plan in order, when a rename fails the renames already done are reverted
+func (tm *TorrentManagement) ApplyRename(ctx context.Context, plan *RenamePlan) (err error) {
+	for i, op := range plan.Ops {
+		err = tm.applyRenameOp(ctx, plan.Hash, op)
+		if err == nil {
+			continue
+		}
+		err = fmt.Errorf("%s: %w", op, err)
+		errs := []error{err}
+		for j := i - 1; j >= 0; j-- {
+			undo := RenameOp{Kind: plan.Ops[j].Kind, Old: plan.Ops[j].New, New: plan.Ops[j].Old}
+			undoErr := tm.applyRenameOp(ctx, plan.Hash, undo)
+			if undoErr != nil {
+				errs = append(errs, fmt.Errorf("rollback %s: %w", undo, undoErr))
+			}
+		}
+		return errors.Join(errs...)
+	}
+	return
+}
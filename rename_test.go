@@ -0,0 +1,146 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const episodeMatch = `^(?:.*/)?(?P<show>[^/]+?)\.S(?P<season>\d+)E(?P<episode>\d+)[^/]*\.(?P<ext>mkv|mp4)$`
+const episodeTemplate = `{{spaces .show}}/Season {{pad 2 .season}}/{{spaces .show}} - S{{pad 2 .season}}E{{pad 2 .episode}}.{{.ext}}`
+
+func renameFiles(names ...string) (files []*TorrentManagementFile) {
+	for i, it := range names {
+		files = append(files, &TorrentManagementFile{Index: i, Name: it})
+	}
+	return
+}
+
+func planString(t *testing.T, renamer *Renamer, names ...string) string {
+	plan, err := renamer.Plan("hash", renameFiles(names...))
+	if err != nil {
+		t.Fatal(err)
+	}
+	return plan.String()
+}
+
+func TestRenamer_Plan(t *testing.T) {
+	renamer, err := NewRenamer(
+		RenameRule{Match: episodeMatch, Template: episodeTemplate},
+		RenameRule{Match: `\.nfo$`, Replace: ".txt"},
+	)
+	if err != nil {
+		t.Fatal(err)
+	}
+	got := planString(t, renamer, "Show.Name.S01E02.1080p/Show.Name.S1E2.1080p.mkv", "Show.Name.S01E02.1080p/info.nfo", "Show.Name.S01E02.1080p/cover.jpg")
+	expected := "file Show.Name.S01E02.1080p/Show.Name.S1E2.1080p.mkv -> Show Name/Season 01/Show Name - S01E02.mkv\n" +
+		"file Show.Name.S01E02.1080p/info.nfo -> Show.Name.S01E02.1080p/info.txt"
+	if got != expected {
+		t.Fatalf("unexpected plan\n%s", got)
+	}
+
+	// a folder whose files all move together is renamed at once
+	renamer, _ = NewRenamer(RenameRule{Match: `^Show\.Name\.S01/`, Replace: "Show Name/Season 01/"})
+	got = planString(t, renamer, "Show.Name.S01/e01.mkv", "Show.Name.S01/subs/e01.srt", "readme.txt")
+	if got != "folder Show.Name.S01 -> Show Name/Season 01" {
+		t.Fatalf("unexpected plan\n%s", got)
+	}
+
+	// swapping names goes through a temporary file
+	renamer, _ = NewRenamer(RenameRule{Match: `^a$`, Replace: "b"}, RenameRule{Match: `^b$`, Replace: "a"}, RenameRule{Match: `^c$`, Replace: "d"})
+	got = planString(t, renamer, "a", "b", "c")
+	if got != "file c -> d\nfile a -> a.renaming\nfile b -> a\nfile a.renaming -> b" {
+		t.Fatalf("unexpected plan\n%s", got)
+	}
+
+	// a chain is renamed from its end
+	renamer, _ = NewRenamer(RenameRule{Match: `^1$`, Replace: "2"}, RenameRule{Match: `^2$`, Replace: "3"})
+	got = planString(t, renamer, "1", "2")
+	if got != "file 2 -> 3\nfile 1 -> 2" {
+		t.Fatalf("unexpected plan\n%s", got)
+	}
+}
+
+func TestRenamer_PlanErrors(t *testing.T) {
+	cases := []struct {
+		rule  RenameRule
+		names []string
+		err   string
+	}{
+		{RenameRule{Match: `\.mkv$`, Replace: ".avi"}, []string{"a.mkv", "a.avi"}, "would both be renamed to a.avi"},
+		{RenameRule{Match: `^a$`, Replace: "b/c"}, []string{"a", "b"}, "inside the file b"},
+		{RenameRule{Match: `^a$`, Replace: "../a"}, []string{"a"}, "invalid new path"},
+		{RenameRule{Match: `^a$`, Template: "{{.missing}}"}, []string{"a"}, "missing"},
+	}
+	for _, it := range cases {
+		renamer, err := NewRenamer(it.rule)
+		if err != nil {
+			t.Fatal(err)
+		}
+		_, err = renamer.Plan("hash", renameFiles(it.names...))
+		if err == nil || !strings.Contains(err.Error(), it.err) {
+			t.Errorf("%v: unexpected error %v", it.rule, err)
+		}
+	}
+	_, err := NewRenamer(RenameRule{Match: "a", Replace: "b", Template: "c"})
+	if err == nil {
+		t.Fatal("expected an error for a rule with replace and template")
+	}
+}
+
+func TestTorrentManagement_ApplyRename(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		call := fmt.Sprintf("%s %s>%s", r.URL.Path[len("/api/v2/torrents/"):], r.Form.Get("oldPath"), r.Form.Get("newPath"))
+		calls = append(calls, call)
+		if r.Form.Get("oldPath") == "c" {
+			w.WriteHeader(http.StatusConflict)
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	plan := &RenamePlan{Hash: "hash", Ops: []RenameOp{
+		{Kind: RenameFolder, Old: "dir", New: "folder"},
+		{Kind: RenameFile, Old: "a", New: "b"},
+		{Kind: RenameFile, Old: "c", New: "d"},
+	}}
+	err = client.TorrentManagement.ApplyRename(context.Background(), plan)
+	if err == nil || !strings.Contains(err.Error(), "file c -> d") {
+		t.Fatalf("unexpected error %v", err)
+	}
+	expected := "renameFolder dir>folder,renameFile a>b,renameFile c>d,renameFile b>a,renameFolder folder>dir"
+	if strings.Join(calls, ",") != expected {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestTorrentManagement_PlanRename(t *testing.T) {
+	infoList, err := api.TorrentManagement.Info(context.Background(), TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	renamer, err := NewRenamer(RenameRule{Match: episodeMatch, Template: episodeTemplate})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, it := range infoList {
+		plan, err := api.TorrentManagement.PlanRename(context.Background(), it.Hash, renamer)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(it.Name)
+		fmt.Println(plan)
+	}
+}
@@ -66,8 +66,6 @@ func (r *Rss) MoveItem(ctx context.Context, itemPath, destPath string) (err erro
 	return
 }
 
-type RssItemResponse map[string]RssItem
-
 type RssItem struct {
 	Articles      []RssArticle `json:"articles"`
 	HasError      bool         `json:"hasError"`
@@ -84,18 +82,20 @@ type RssArticle struct {
 	Date        string `json:"date"`
 	Description string `json:"description"`
 	ID          string `json:"id"`
+	IsRead      bool   `json:"isRead"`
 	Link        string `json:"link"`
 	Title       string `json:"title"`
 	TorrentURL  string `json:"torrentURL"`
 }
 
-func (r *Rss) Items(ctx context.Context, withData bool) (rssItemResponse RssItemResponse, err error) {
+// Items return the whole feed tree, articles are only filled when withData is true
+func (r *Rss) Items(ctx context.Context, withData bool) (rssTree *RssTree, err error) {
 	path := "/api/v2/rss/items"
 
 	query := url.Values{}
 	query.Set("withData", strconv.FormatBool(withData))
 
-	err = r.api.doRequest(ctx, http.MethodGet, path, query, nil, &rssItemResponse)
+	err = r.api.doRequest(ctx, http.MethodGet, path, query, nil, &rssTree)
 	if err != nil {
 		return
 	}
@@ -132,19 +132,19 @@ func (r *Rss) RefreshItem(ctx context.Context, itemPath string) (err error) {
 }
 
 type RuleDef struct {
-	Enable                    bool     `json:"enable"`
-	MustContain               string   `json:"mustContain"`
-	MustNotContain            string   `json:"mustNotContain"`
-	UseRegex                  bool     `json:"useRegex"`
-	EpisodeFilter             string   `json:"episodeFilter"`
-	SmartFilter               bool     `json:"smartFilter"`
-	PreviouslyMatchedEpisodes []string `json:"previouslyMatchedEpisodes"`
-	AffectedFeeds             []string `json:"affectedFeeds"`
-	IgnoreDays                int64    `json:"ignoreDays"`
-	LastMatch                 string   `json:"lastMatch"`
-	AddPaused                 bool     `json:"addPaused"`
-	AssignedCategory          string   `json:"assignedCategory"`
-	SavePath                  string   `json:"savePath"`
+	Enable                    bool     `json:"enable" yaml:"enable,omitempty"`
+	MustContain               string   `json:"mustContain" yaml:"mustContain,omitempty"`
+	MustNotContain            string   `json:"mustNotContain" yaml:"mustNotContain,omitempty"`
+	UseRegex                  bool     `json:"useRegex" yaml:"useRegex,omitempty"`
+	EpisodeFilter             string   `json:"episodeFilter" yaml:"episodeFilter,omitempty"`
+	SmartFilter               bool     `json:"smartFilter" yaml:"smartFilter,omitempty"`
+	PreviouslyMatchedEpisodes []string `json:"previouslyMatchedEpisodes" yaml:"previouslyMatchedEpisodes,omitempty"`
+	AffectedFeeds             []string `json:"affectedFeeds" yaml:"affectedFeeds,omitempty"`
+	IgnoreDays                int64    `json:"ignoreDays" yaml:"ignoreDays,omitempty"`
+	LastMatch                 string   `json:"lastMatch" yaml:"lastMatch,omitempty"`
+	AddPaused                 bool     `json:"addPaused" yaml:"addPaused,omitempty"`
+	AssignedCategory          string   `json:"assignedCategory" yaml:"assignedCategory,omitempty"`
+	SavePath                  string   `json:"savePath" yaml:"savePath,omitempty"`
 }
 
 func (r *Rss) SetRule(ctx context.Context, ruleName string, ruleDef *RuleDef) (err error) {
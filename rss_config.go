@@ -0,0 +1,466 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"encoding/xml"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"path/filepath"
+	"reflect"
+	"sort"
+	"strings"
+)
+
+const RssConfigVersion = 1
+
+// RssConfig is a portable document of rss feeds, folders and auto download rules
+type RssConfig struct {
+	Version int `json:"version" yaml:"version"`
+	// Folders list folder paths, parents of feed paths are created even when not listed
+	Folders []string        `json:"folders,omitempty" yaml:"folders,omitempty"`
+	Feeds   []RssFeedConfig `json:"feeds,omitempty" yaml:"feeds,omitempty"`
+	Rules   []RssRuleConfig `json:"rules,omitempty" yaml:"rules,omitempty"`
+}
+
+type RssFeedConfig struct {
+	// Path is the full backslash separated item path including the feed name
+	Path string `json:"path" yaml:"path"`
+	URL  string `json:"url" yaml:"url"`
+}
+
+type RssRuleConfig struct {
+	Name string `json:"name" yaml:"name"`
+	// RenamedFrom list former rule names, an existing rule with one of these names is renamed instead of recreated
+	RenamedFrom []string `json:"renamedFrom,omitempty" yaml:"renamedFrom,omitempty"`
+	RuleDef     `yaml:",inline"`
+}
+
+type RssConfigFormat string
+
+const RssConfigJSON RssConfigFormat = "json"
+const RssConfigYAML RssConfigFormat = "yaml"
+const RssConfigOPML RssConfigFormat = "opml"
+
+// RssConfigFormatFromPath guess format from file extension, default to json
+func RssConfigFormatFromPath(path string) RssConfigFormat {
+	switch strings.ToLower(filepath.Ext(path)) {
+	case ".yaml", ".yml":
+		return RssConfigYAML
+	case ".opml", ".xml":
+		return RssConfigOPML
+	default:
+		return RssConfigJSON
+	}
+}
+
+type RssExportOptions struct {
+	// IncludeState keep LastMatch and PreviouslyMatchedEpisodes which are server side progress rather than configuration
+	IncludeState bool
+}
+
+// Export read feed tree and rules from server into a RssConfig
+func (r *Rss) Export(ctx context.Context, opts RssExportOptions) (cfg *RssConfig, err error) {
+	tree, err := r.Items(ctx, false)
+	if err != nil {
+		return
+	}
+	rules, err := r.Rules(ctx)
+	if err != nil {
+		return
+	}
+	cfg = NewRssConfig(tree, rules, opts)
+	return
+}
+
+func NewRssConfig(tree *RssTree, rules RulesResponse, opts RssExportOptions) *RssConfig {
+	cfg := &RssConfig{Version: RssConfigVersion}
+	tree.Walk(func(node *RssNode) error {
+		if node.IsFolder() {
+			cfg.Folders = append(cfg.Folders, node.Path)
+		} else {
+			cfg.Feeds = append(cfg.Feeds, RssFeedConfig{Path: node.Path, URL: node.Feed.URL})
+		}
+		return nil
+	})
+
+	var names []string
+	for name := range rules {
+		names = append(names, name)
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		def := rules[name]
+		if !opts.IncludeState {
+			def.LastMatch = ""
+			def.PreviouslyMatchedEpisodes = nil
+		}
+		cfg.Rules = append(cfg.Rules, RssRuleConfig{Name: name, RuleDef: def})
+	}
+	return cfg
+}
+
+func MarshalRssConfig(cfg *RssConfig, format RssConfigFormat) (data []byte, err error) {
+	switch format {
+	case RssConfigJSON:
+		return json.MarshalIndent(cfg, "", "  ")
+	case RssConfigYAML:
+		return yaml.Marshal(cfg)
+	case RssConfigOPML:
+		return marshalOPML(cfg)
+	default:
+		err = fmt.Errorf("unknown rss config format %q", format)
+		return
+	}
+}
+
+func UnmarshalRssConfig(data []byte, format RssConfigFormat) (cfg *RssConfig, err error) {
+	cfg = &RssConfig{}
+	switch format {
+	case RssConfigJSON:
+		err = json.Unmarshal(data, cfg)
+	case RssConfigYAML:
+		err = yaml.Unmarshal(data, cfg)
+	case RssConfigOPML:
+		cfg, err = unmarshalOPML(data)
+	default:
+		err = fmt.Errorf("unknown rss config format %q", format)
+	}
+	if err != nil {
+		return
+	}
+	if cfg.Version > RssConfigVersion {
+		err = fmt.Errorf("rss config version %d is newer than supported version %d", cfg.Version, RssConfigVersion)
+	}
+	return
+}
+
+type opmlDocument struct {
+	XMLName xml.Name      `xml:"opml"`
+	Version string        `xml:"version,attr"`
+	Title   string        `xml:"head>title"`
+	Body    []opmlOutline `xml:"body>outline"`
+}
+
+type opmlOutline struct {
+	Text     string        `xml:"text,attr"`
+	Title    string        `xml:"title,attr,omitempty"`
+	Type     string        `xml:"type,attr,omitempty"`
+	XMLURL   string        `xml:"xmlUrl,attr,omitempty"`
+	Children []opmlOutline `xml:"outline"`
+}
+
+// marshalOPML write folders and feeds only, rules have no OPML representation
+func marshalOPML(cfg *RssConfig) (data []byte, err error) {
+	root := &opmlOutline{}
+	folder := func(path string) *opmlOutline {
+		node := root
+		if path == "" {
+			return node
+		}
+		for _, name := range strings.Split(path, RssPathSeparator) {
+			var next *opmlOutline
+			for i := range node.Children {
+				if node.Children[i].XMLURL == "" && node.Children[i].Text == name {
+					next = &node.Children[i]
+					break
+				}
+			}
+			if next == nil {
+				node.Children = append(node.Children, opmlOutline{Text: name, Title: name})
+				next = &node.Children[len(node.Children)-1]
+			}
+			node = next
+		}
+		return node
+	}
+
+	for _, it := range cfg.Folders {
+		folder(it)
+	}
+	for _, it := range cfg.Feeds {
+		parent, name := SplitRssPath(it.Path)
+		node := folder(parent)
+		node.Children = append(node.Children, opmlOutline{Text: name, Title: name, Type: "rss", XMLURL: it.URL})
+	}
+
+	doc := opmlDocument{Version: "2.0", Title: "qBittorrent RSS feeds", Body: root.Children}
+	data, err = xml.MarshalIndent(doc, "", "  ")
+	if err != nil {
+		return
+	}
+	data = append([]byte(xml.Header), data...)
+	return
+}
+
+func unmarshalOPML(data []byte) (cfg *RssConfig, err error) {
+	var doc opmlDocument
+	err = xml.Unmarshal(data, &doc)
+	if err != nil {
+		return
+	}
+
+	cfg = &RssConfig{Version: RssConfigVersion}
+	var walk func(parent string, outlines []opmlOutline)
+	walk = func(parent string, outlines []opmlOutline) {
+		for _, it := range outlines {
+			name := it.Text
+			if name == "" {
+				name = it.Title
+			}
+			path := JoinRssPath(parent, name)
+			if it.XMLURL != "" {
+				if name == "" {
+					path = JoinRssPath(parent, it.XMLURL)
+				}
+				cfg.Feeds = append(cfg.Feeds, RssFeedConfig{Path: path, URL: it.XMLURL})
+				continue
+			}
+			cfg.Folders = append(cfg.Folders, path)
+			walk(path, it.Children)
+		}
+	}
+	walk("", doc.Body)
+	return
+}
+
+type RssActionKind string
+
+const RssActionAddFolder RssActionKind = "add_folder"
+const RssActionAddFeed RssActionKind = "add_feed"
+const RssActionMoveItem RssActionKind = "move_item"
+const RssActionRemoveItem RssActionKind = "remove_item"
+const RssActionRenameRule RssActionKind = "rename_rule"
+const RssActionSetRule RssActionKind = "set_rule"
+const RssActionRemoveRule RssActionKind = "remove_rule"
+
+// RssAction is a single api call of an import plan
+type RssAction struct {
+	Kind RssActionKind
+	// Path is the item path for folder and feed actions
+	Path string
+	// From is the source path of a move or the old name of a rename
+	From string
+	URL  string
+	Rule string
+	Def  *RuleDef
+}
+
+func (a RssAction) String() string {
+	switch a.Kind {
+	case RssActionAddFolder, RssActionRemoveItem:
+		return fmt.Sprintf("%s %s", a.Kind, a.Path)
+	case RssActionAddFeed:
+		return fmt.Sprintf("%s %s %s", a.Kind, a.Path, a.URL)
+	case RssActionMoveItem:
+		return fmt.Sprintf("%s %s -> %s", a.Kind, a.From, a.Path)
+	case RssActionRenameRule:
+		return fmt.Sprintf("%s %s -> %s", a.Kind, a.From, a.Rule)
+	default:
+		return fmt.Sprintf("%s %s", a.Kind, a.Rule)
+	}
+}
+
+type RssImportOptions struct {
+	// Prune remove feeds, folders and rules not present in the document
+	Prune bool
+	// DryRun only compute the plan
+	DryRun bool
+}
+
+// Import make server match cfg, running it twice with the same document is a no-op.
+// The returned actions are the plan, in DryRun mode nothing is applied.
+func (r *Rss) Import(ctx context.Context, cfg *RssConfig, opts RssImportOptions) (actions []RssAction, err error) {
+	tree, err := r.Items(ctx, false)
+	if err != nil {
+		return
+	}
+	rules, err := r.Rules(ctx)
+	if err != nil {
+		return
+	}
+
+	actions = PlanRssImport(tree, rules, cfg, opts.Prune)
+	if opts.DryRun {
+		return
+	}
+	err = r.ApplyActions(ctx, actions)
+	return
+}
+
+// PlanRssImport compute the calls needed to turn current state into cfg
+func PlanRssImport(tree *RssTree, rules RulesResponse, cfg *RssConfig, prune bool) (actions []RssAction) {
+	wantedURLs := map[string]bool{}
+	for _, it := range cfg.Feeds {
+		wantedURLs[it.URL] = true
+	}
+	// unwanted feeds go first so their paths can be reused by folders and feeds of the document
+	if prune {
+		for _, node := range tree.Feeds() {
+			if !wantedURLs[node.Feed.URL] {
+				actions = append(actions, RssAction{Kind: RssActionRemoveItem, Path: node.Path})
+			}
+		}
+	}
+
+	folders := map[string]bool{}
+	addFolder := func(path string) {
+		for path != "" {
+			folders[path] = true
+			path, _ = SplitRssPath(path)
+		}
+	}
+	for _, it := range cfg.Folders {
+		addFolder(it)
+	}
+	for _, it := range cfg.Feeds {
+		parent, _ := SplitRssPath(it.Path)
+		addFolder(parent)
+	}
+
+	// without prune, a feed not in the document still has to make room when its path is taken by the
+	// document, as when a feed keeps its path and changes url
+	if !prune {
+		taken := map[string]bool{}
+		for it := range folders {
+			taken[it] = true
+		}
+		for _, it := range cfg.Feeds {
+			taken[it.Path] = true
+		}
+		for _, node := range tree.Feeds() {
+			if taken[node.Path] && !wantedURLs[node.Feed.URL] {
+				actions = append(actions, RssAction{Kind: RssActionRemoveItem, Path: node.Path})
+			}
+		}
+	}
+
+	var folderList []string
+	for it := range folders {
+		folderList = append(folderList, it)
+	}
+	// parents sort before their children
+	sort.Strings(folderList)
+	for _, it := range folderList {
+		if node := tree.Find(it); node == nil || !node.IsFolder() {
+			actions = append(actions, RssAction{Kind: RssActionAddFolder, Path: it})
+		}
+	}
+
+	for _, it := range cfg.Feeds {
+		node := tree.FindByURL(it.URL)
+		if node == nil {
+			actions = append(actions, RssAction{Kind: RssActionAddFeed, Path: it.Path, URL: it.URL})
+		} else if node.Path != it.Path {
+			actions = append(actions, RssAction{Kind: RssActionMoveItem, From: node.Path, Path: it.Path})
+		}
+	}
+
+	kept := map[string]bool{}
+	for _, it := range cfg.Rules {
+		kept[it.Name] = true
+		current, exists := rules[it.Name]
+		if !exists {
+			for _, old := range it.RenamedFrom {
+				if previous, ok := rules[old]; ok && !kept[old] {
+					actions = append(actions, RssAction{Kind: RssActionRenameRule, From: old, Rule: it.Name})
+					kept[old] = true
+					current, exists = previous, true
+					break
+				}
+			}
+		}
+
+		def := it.RuleDef
+		if exists {
+			// keep server side progress unless the document carries it
+			if def.LastMatch == "" {
+				def.LastMatch = current.LastMatch
+			}
+			if def.PreviouslyMatchedEpisodes == nil {
+				def.PreviouslyMatchedEpisodes = current.PreviouslyMatchedEpisodes
+			}
+			if equalRuleDef(&def, &current) {
+				continue
+			}
+		}
+		actions = append(actions, RssAction{Kind: RssActionSetRule, Rule: it.Name, Def: &def})
+	}
+
+	if !prune {
+		return
+	}
+
+	var names []string
+	for name := range rules {
+		if !kept[name] {
+			names = append(names, name)
+		}
+	}
+	sort.Strings(names)
+	for _, name := range names {
+		actions = append(actions, RssAction{Kind: RssActionRemoveRule, Rule: name})
+	}
+
+	var removed []string
+	for _, node := range tree.Folders() {
+		if folders[node.Path] {
+			continue
+		}
+		parent, _ := SplitRssPath(node.Path)
+		var covered = false
+		for _, it := range removed {
+			if parent == it || strings.HasPrefix(parent, it+RssPathSeparator) {
+				covered = true
+				break
+			}
+		}
+		if !covered {
+			removed = append(removed, node.Path)
+			actions = append(actions, RssAction{Kind: RssActionRemoveItem, Path: node.Path})
+		}
+	}
+	return
+}
+
+func equalRuleDef(a, b *RuleDef) bool {
+	normalize := func(def RuleDef) RuleDef {
+		if len(def.PreviouslyMatchedEpisodes) == 0 {
+			def.PreviouslyMatchedEpisodes = nil
+		}
+		if len(def.AffectedFeeds) == 0 {
+			def.AffectedFeeds = nil
+		}
+		return def
+	}
+	return reflect.DeepEqual(normalize(*a), normalize(*b))
+}
+
+// ApplyActions run the actions in order and stop at first failure
+func (r *Rss) ApplyActions(ctx context.Context, actions []RssAction) (err error) {
+	for _, it := range actions {
+		switch it.Kind {
+		case RssActionAddFolder:
+			err = r.AddFolder(ctx, it.Path)
+		case RssActionAddFeed:
+			err = r.AddFeed(ctx, it.URL, it.Path)
+		case RssActionMoveItem:
+			err = r.MoveItem(ctx, it.From, it.Path)
+		case RssActionRemoveItem:
+			err = r.RemoveItem(ctx, it.Path)
+		case RssActionRenameRule:
+			err = r.RenameRule(ctx, it.From, it.Rule)
+		case RssActionSetRule:
+			err = r.SetRule(ctx, it.Rule, it.Def)
+		case RssActionRemoveRule:
+			err = r.RemoveRule(ctx, it.Rule)
+		default:
+			err = fmt.Errorf("unknown rss action %q", it.Kind)
+		}
+		if err != nil {
+			err = fmt.Errorf("%s: %w", it, err)
+			return
+		}
+	}
+	return
+}
@@ -0,0 +1,134 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"testing"
+)
+
+func TestRssConfig_RoundTrip(t *testing.T) {
+	var tree RssTree
+	err := json.Unmarshal([]byte(rssItemsWithData), &tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := RulesResponse{
+		"ani": {Enable: true, MustContain: "BLEACH", AffectedFeeds: []string{"https://dmhy.org/topics/rss/rss.xml"}, LastMatch: "15 Aug 2023 10:00:00 +0000"},
+	}
+	cfg := NewRssConfig(&tree, rules, RssExportOptions{})
+	if cfg.Rules[0].LastMatch != "" || len(cfg.Feeds) != 3 || len(cfg.Folders) != 2 {
+		t.Fatalf("unexpected export %+v", cfg)
+	}
+
+	for _, format := range []RssConfigFormat{RssConfigJSON, RssConfigYAML, RssConfigOPML} {
+		data, err := MarshalRssConfig(cfg, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		again, err := UnmarshalRssConfig(data, format)
+		if err != nil {
+			t.Fatal(err)
+		}
+		paths := map[string]string{}
+		for _, it := range again.Feeds {
+			paths[it.URL] = it.Path
+		}
+		if len(again.Feeds) != 3 || paths["https://distrowatch.com/news/torrents.xml"] != "linux" || paths["https://nyaa.si/?page=rss"] != `anime\old\nyaa` {
+			t.Fatalf("%s round trip lost feeds %+v", format, again.Feeds)
+		}
+		if format != RssConfigOPML && (len(again.Rules) != 1 || again.Rules[0].MustContain != "BLEACH" || !again.Rules[0].Enable) {
+			t.Fatalf("%s round trip lost rules %+v", format, again.Rules)
+		}
+	}
+
+	// importing the export of the same state is a no-op
+	if actions := PlanRssImport(&tree, rules, cfg, true); len(actions) != 0 {
+		t.Fatalf("expected no actions, got %v", actions)
+	}
+}
+
+func TestPlanRssImport(t *testing.T) {
+	var tree RssTree
+	err := json.Unmarshal([]byte(rssItemsWithData), &tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	rules := RulesResponse{
+		"old-name": {Enable: true, MustContain: "BLEACH"},
+		"extra":    {Enable: true},
+	}
+	cfg := &RssConfig{
+		Version: RssConfigVersion,
+		Feeds: []RssFeedConfig{
+			{Path: `anime\dmhy`, URL: "https://dmhy.org/topics/rss/rss.xml"},
+			{Path: `anime\nyaa`, URL: "https://nyaa.si/?page=rss"},
+			{Path: `linux\debian`, URL: "https://www.debian.org/rss.xml"},
+		},
+		Rules: []RssRuleConfig{
+			{Name: "bleach", RenamedFrom: []string{"old-name"}, RuleDef: RuleDef{Enable: true, MustContain: "BLEACH"}},
+			{Name: "new", RuleDef: RuleDef{Enable: true, MustContain: "x"}},
+		},
+	}
+
+	var got []string
+	for _, it := range PlanRssImport(&tree, rules, cfg, true) {
+		got = append(got, it.String())
+	}
+	expected := []string{
+		`remove_item linux`,
+		`add_folder linux`,
+		`move_item anime\old\nyaa -> anime\nyaa`,
+		`add_feed linux\debian https://www.debian.org/rss.xml`,
+		`rename_rule old-name -> bleach`,
+		`set_rule new`,
+		`remove_rule extra`,
+		`remove_item anime\old`,
+	}
+	if len(got) != len(expected) {
+		t.Fatalf("unexpected plan %q", got)
+	}
+	for i := range expected {
+		if got[i] != expected[i] {
+			t.Fatalf("unexpected plan %q", got)
+		}
+	}
+}
+
+func TestPlanRssImport_ChangedURL(t *testing.T) {
+	var tree RssTree
+	err := json.Unmarshal([]byte(rssItemsWithData), &tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	cfg := &RssConfig{
+		Version: RssConfigVersion,
+		Feeds:   []RssFeedConfig{{Path: "linux", URL: "https://example.com/linux.xml"}},
+	}
+	var got []string
+	for _, it := range PlanRssImport(&tree, RulesResponse{}, cfg, false) {
+		got = append(got, it.String())
+	}
+	if fmt.Sprint(got) != "[remove_item linux add_feed linux https://example.com/linux.xml]" {
+		t.Fatalf("unexpected plan %q", got)
+	}
+}
+
+func TestRss_Export(t *testing.T) {
+	cfg, err := api.Rss.Export(context.Background(), RssExportOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	data, err := MarshalRssConfig(cfg, RssConfigYAML)
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(string(data))
+
+	actions, err := api.Rss.Import(context.Background(), cfg, RssImportOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	spew.Dump(actions)
+}
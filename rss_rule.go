@@ -0,0 +1,492 @@
+package qbt_api
+
+import (
+	"fmt"
+	"regexp"
+	"strconv"
+	"strings"
+	"time"
+)
+
+// DefaultSmartEpisodeFilters is the default value of Preferences.RssSmartEpisodeFilters split by line
+var DefaultSmartEpisodeFilters = []string{
+	`s(\d+)e(\d+)`,
+	`(\d+)x(\d+)`,
+	`(\d{4}[.\-]\d{1,2}[.\-]\d{1,2})`,
+	`(\d{1,2}[.\-]\d{1,2}[.\-]\d{4})`,
+}
+
+var episodeFilterRegex = regexp.MustCompile(`(?i)(^\d{1,4})x(.*;$)`)
+var episodeRangeRegex1 = regexp.MustCompile(`(?i)\bs0?(\d{1,4})[ -_\.]?e(0?\d{1,4})(?:\D|\b)`)
+var episodeRangeRegex2 = regexp.MustCompile(`(?i)\b(\d{1,4})x(0?\d{1,4})(?:\D|\b)`)
+
+var rssDateLayouts = []string{
+	time.RFC1123Z,
+	time.RFC1123,
+	"Mon, 2 Jan 2006 15:04:05 -0700",
+	"2 Jan 2006 15:04:05 -0700",
+	"02 Jan 2006 15:04:05 -0700",
+	time.RFC822Z,
+	time.RFC822,
+	time.RFC3339,
+	"2006-01-02T15:04:05",
+	"02-Jan-2006 15:04:05",
+}
+
+// ParseRssDate parse article dates and RuleDef.LastMatch as qBittorrent writes them
+func ParseRssDate(value string) (t time.Time, err error) {
+	value = strings.TrimSpace(value)
+	for _, layout := range rssDateLayouts {
+		t, err = time.Parse(layout, value)
+		if err == nil {
+			return
+		}
+	}
+	err = fmt.Errorf("unknown date format %q", value)
+	return
+}
+
+// RuleEvaluatorOptions mirror the preferences qBittorrent consults while matching articles
+type RuleEvaluatorOptions struct {
+	// SmartEpisodeFilters default to DefaultSmartEpisodeFilters when empty
+	SmartEpisodeFilters []string
+	// DownloadRepacks mirror Preferences.RssDownloadRepackProperEpisodes
+	DownloadRepacks bool
+}
+
+func NewRuleEvaluatorOptions(pref *Preferences) RuleEvaluatorOptions {
+	var filters []string
+	for _, it := range strings.Split(pref.RssSmartEpisodeFilters, "\n") {
+		it = strings.TrimSpace(it)
+		if it != "" {
+			filters = append(filters, it)
+		}
+	}
+	return RuleEvaluatorOptions{
+		SmartEpisodeFilters: filters,
+		DownloadRepacks:     pref.RssDownloadRepackProperEpisodes,
+	}
+}
+
+// RuleEvaluator reproduce qBittorrent auto download rule matching locally so rules can be tested before Rss.SetRule
+type RuleEvaluator struct {
+	Name string
+	Rule RuleDef
+
+	opts           RuleEvaluatorOptions
+	mustContain    []ruleExpression
+	mustNotContain []ruleExpression
+	smartEpisode   *regexp.Regexp
+	lastMatch      time.Time
+	previous       map[string]bool
+}
+
+// RuleMatch explain the decision for a single article
+type RuleMatch struct {
+	FeedURL  string
+	FeedName string
+	Article  RssArticle
+	Matched  bool
+	Reason   string
+	// Episodes is the smart filter episode ids recorded when the article is accepted
+	Episodes []string
+}
+
+func NewRuleEvaluator(name string, rule *RuleDef, opts RuleEvaluatorOptions) (e *RuleEvaluator, err error) {
+	e = &RuleEvaluator{
+		Name:     name,
+		Rule:     *rule,
+		opts:     opts,
+		previous: map[string]bool{},
+	}
+
+	e.mustContain, err = compileRuleExpressions(rule.MustContain, rule.UseRegex)
+	if err != nil {
+		err = fmt.Errorf("mustContain: %w", err)
+		return
+	}
+	e.mustNotContain, err = compileRuleExpressions(rule.MustNotContain, rule.UseRegex)
+	if err != nil {
+		err = fmt.Errorf("mustNotContain: %w", err)
+		return
+	}
+
+	filters := opts.SmartEpisodeFilters
+	if len(filters) == 0 {
+		filters = DefaultSmartEpisodeFilters
+	}
+	e.smartEpisode, err = regexp.Compile(`(?i)(?:_|\b)(?:` + strings.Join(filters, "|") + `)(?:_|\b)`)
+	if err != nil {
+		err = fmt.Errorf("smart episode filters: %w", err)
+		return
+	}
+
+	if rule.LastMatch != "" {
+		e.lastMatch, err = ParseRssDate(rule.LastMatch)
+		if err != nil {
+			err = fmt.Errorf("lastMatch: %w", err)
+			return
+		}
+	}
+	for _, it := range rule.PreviouslyMatchedEpisodes {
+		e.previous[it] = true
+	}
+	return
+}
+
+// ruleExpression is one "|" alternative, every regex must match the title, an empty expression always matches
+type ruleExpression []*regexp.Regexp
+
+func (re ruleExpression) match(title string) bool {
+	for _, it := range re {
+		if !it.MatchString(title) {
+			return false
+		}
+	}
+	return true
+}
+
+// compileRuleExpressions split expression by "|" unless it is a regex, nil means no condition
+func compileRuleExpressions(expression string, useRegex bool) (list []ruleExpression, err error) {
+	if expression == "" {
+		return
+	}
+	if useRegex {
+		var re *regexp.Regexp
+		re, err = regexp.Compile("(?i)" + expression)
+		if err != nil {
+			return
+		}
+		return []ruleExpression{{re}}, nil
+	}
+
+	for _, alternative := range strings.Split(expression, "|") {
+		// every whitespace separated wildcard must be present, order is unimportant
+		var expr ruleExpression
+		for _, wildcard := range strings.Fields(alternative) {
+			var re *regexp.Regexp
+			re, err = regexp.Compile("(?i)" + wildcardToRegex(wildcard))
+			if err != nil {
+				return
+			}
+			expr = append(expr, re)
+		}
+		list = append(list, expr)
+	}
+	return
+}
+
+// wildcardToRegex follow Qt unanchored wildcard conversion, * and ? do not match "/"
+func wildcardToRegex(wildcard string) string {
+	var b strings.Builder
+	runes := []rune(wildcard)
+	for i := 0; i < len(runes); i++ {
+		switch c := runes[i]; c {
+		case '*':
+			b.WriteString(`[^/]*`)
+		case '?':
+			b.WriteString(`[^/]`)
+		case '[':
+			end := i + 1
+			if end < len(runes) && runes[end] == '!' {
+				end += 1
+			}
+			if end < len(runes) && runes[end] == ']' {
+				end += 1
+			}
+			for end < len(runes) && runes[end] != ']' {
+				end += 1
+			}
+			if end >= len(runes) {
+				b.WriteString(regexp.QuoteMeta(string(c)))
+				continue
+			}
+			class := runes[i+1 : end]
+			b.WriteString("[")
+			if len(class) > 0 && class[0] == '!' {
+				b.WriteString("^")
+				class = class[1:]
+			}
+			b.WriteString(strings.ReplaceAll(string(class), `\`, `\\`))
+			b.WriteString("]")
+			i = end
+		default:
+			b.WriteString(regexp.QuoteMeta(string(c)))
+		}
+	}
+	return b.String()
+}
+
+// qtAtoi behave like QString::toInt, invalid numbers are zero
+func qtAtoi(s string) int {
+	n, err := strconv.Atoi(s)
+	if err != nil {
+		return 0
+	}
+	return n
+}
+
+func (e *RuleEvaluator) matchesMustContain(title string) (ok bool, reason string) {
+	if len(e.mustContain) == 0 {
+		return true, ""
+	}
+	for i, expr := range e.mustContain {
+		if expr.match(title) {
+			return true, fmt.Sprintf("must contain expression %q matched", e.alternative(e.Rule.MustContain, i))
+		}
+	}
+	return false, fmt.Sprintf("must contain %q did not match", e.Rule.MustContain)
+}
+
+func (e *RuleEvaluator) matchesMustNotContain(title string) (ok bool, reason string) {
+	for i, expr := range e.mustNotContain {
+		if expr.match(title) {
+			return false, fmt.Sprintf("must not contain expression %q matched", e.alternative(e.Rule.MustNotContain, i))
+		}
+	}
+	return true, ""
+}
+
+func (e *RuleEvaluator) alternative(expression string, i int) string {
+	if e.Rule.UseRegex {
+		return expression
+	}
+	return strings.Split(expression, "|")[i]
+}
+
+func (e *RuleEvaluator) matchesEpisodeFilter(title string) (ok bool, reason string) {
+	if e.Rule.EpisodeFilter == "" {
+		return true, ""
+	}
+
+	matcher := episodeFilterRegex.FindStringSubmatch(e.Rule.EpisodeFilter)
+	if matcher == nil {
+		return false, fmt.Sprintf("episode filter %q is invalid", e.Rule.EpisodeFilter)
+	}
+	season := matcher[1]
+	seasonOurs := qtAtoi(season)
+
+	for _, episode := range strings.Split(matcher[2], ";") {
+		if episode == "" {
+			continue
+		}
+		// trim leading zeroes, but if it's all zeros then we want episode zero
+		for len(episode) > 1 && strings.HasPrefix(episode, "0") {
+			episode = episode[1:]
+		}
+
+		if !strings.Contains(episode, "-") {
+			re, err := regexp.Compile(fmt.Sprintf(`(?i)\b(?:s0?%[1]s[ -_\.]?e0?%[2]s|%[1]sx0?%[2]s)(?:\D|\b)`, season, episode))
+			if err == nil && re.MatchString(title) {
+				return true, fmt.Sprintf("episode filter matched %sx%s", season, episode)
+			}
+			continue
+		}
+
+		theirs := episodeRangeRegex1.FindStringSubmatch(title)
+		if theirs == nil {
+			theirs = episodeRangeRegex2.FindStringSubmatch(title)
+		}
+		if theirs == nil {
+			continue
+		}
+		seasonTheirs := qtAtoi(theirs[1])
+		episodeTheirs := qtAtoi(theirs[2])
+
+		if strings.HasSuffix(episode, "-") {
+			episodeOurs := qtAtoi(strings.TrimSuffix(episode, "-"))
+			if (seasonTheirs == seasonOurs && episodeTheirs >= episodeOurs) || seasonTheirs > seasonOurs {
+				return true, fmt.Sprintf("episode filter matched %sx%s", season, episode)
+			}
+			continue
+		}
+
+		// like qBittorrent, a malformed range such as 1-2-3 goes from the first to the last segment
+		bounds := strings.Split(episode, "-")
+		first, last := qtAtoi(bounds[0]), qtAtoi(bounds[len(bounds)-1])
+		if first > last {
+			continue
+		}
+		if seasonTheirs == seasonOurs && first <= episodeTheirs && last >= episodeTheirs {
+			return true, fmt.Sprintf("episode filter matched %sx%s", season, episode)
+		}
+	}
+	return false, fmt.Sprintf("episode filter %q did not match", e.Rule.EpisodeFilter)
+}
+
+// EpisodeName extract the smart filter episode id such as "1x2" or "2023.08.15" from title
+func (e *RuleEvaluator) EpisodeName(title string) string {
+	match := e.smartEpisode.FindStringSubmatch(title)
+	if match == nil {
+		return ""
+	}
+	var ret []string
+	for _, capture := range match[1:] {
+		if capture == "" {
+			continue
+		}
+		if n, err := strconv.Atoi(capture); err == nil {
+			capture = strconv.Itoa(n)
+		}
+		ret = append(ret, capture)
+	}
+	return strings.Join(ret, "x")
+}
+
+func (e *RuleEvaluator) matchesSmartFilter(title string) (ok bool, reason string, episodes []string) {
+	if !e.Rule.SmartFilter {
+		return true, "", nil
+	}
+
+	episode := e.EpisodeName(title)
+	if episode == "" {
+		return true, "", nil
+	}
+
+	if e.previous[episode] {
+		if !e.opts.DownloadRepacks {
+			return false, fmt.Sprintf("smart filter: episode %s was previously matched", episode), nil
+		}
+
+		upper := strings.ToUpper(title)
+		isRepack := strings.Contains(upper, "REPACK")
+		isProper := strings.Contains(upper, "PROPER")
+		if !isRepack && !isProper {
+			return false, fmt.Sprintf("smart filter: episode %s was previously matched", episode), nil
+		}
+
+		full := episode
+		if isRepack {
+			full += "-REPACK"
+		}
+		if isProper {
+			full += "-PROPER"
+		}
+		if e.previous[full] {
+			return false, fmt.Sprintf("smart filter: episode %s was previously matched", full), nil
+		}
+		episodes = append(episodes, full)
+		if isRepack && isProper {
+			episodes = append(episodes, episode+"-REPACK", episode+"-PROPER")
+		}
+	}
+
+	episodes = append(episodes, episode)
+	return true, fmt.Sprintf("smart filter: episode %s is new", episode), episodes
+}
+
+// Match test a single article without changing evaluator state, the same way Rss.MatchingArticles does
+func (e *RuleEvaluator) Match(article RssArticle) (m RuleMatch) {
+	m.Article = article
+
+	if e.Rule.IgnoreDays > 0 && !e.lastMatch.IsZero() {
+		date, _ := ParseRssDate(article.Date)
+		if date.Before(e.lastMatch.AddDate(0, 0, int(e.Rule.IgnoreDays))) {
+			m.Reason = fmt.Sprintf("ignored: within %d days of last match %s", e.Rule.IgnoreDays, e.lastMatch.Format(time.RFC1123Z))
+			return
+		}
+	}
+
+	var reasons []string
+	for _, check := range []func(title string) (bool, string){
+		e.matchesMustContain,
+		e.matchesMustNotContain,
+		e.matchesEpisodeFilter,
+	} {
+		ok, reason := check(article.Title)
+		if !ok {
+			m.Reason = reason
+			return
+		}
+		if reason != "" {
+			reasons = append(reasons, reason)
+		}
+	}
+
+	ok, reason, episodes := e.matchesSmartFilter(article.Title)
+	if !ok {
+		m.Reason = reason
+		return
+	}
+	if reason != "" {
+		reasons = append(reasons, reason)
+	}
+	if len(reasons) == 0 {
+		reasons = append(reasons, "rule has no conditions")
+	}
+
+	m.Matched = true
+	m.Reason = strings.Join(reasons, "; ")
+	m.Episodes = episodes
+	return
+}
+
+// Accept match article and on success record last match and smart filter episodes like the auto downloader does,
+// so later articles of the same episode or inside IgnoreDays are rejected
+func (e *RuleEvaluator) Accept(article RssArticle) (m RuleMatch) {
+	m = e.Match(article)
+	if !m.Matched {
+		return
+	}
+	if date, err := ParseRssDate(article.Date); err == nil {
+		e.lastMatch = date
+	}
+	for _, it := range m.Episodes {
+		if !e.previous[it] {
+			e.previous[it] = true
+			e.Rule.PreviouslyMatchedEpisodes = append(e.Rule.PreviouslyMatchedEpisodes, it)
+		}
+	}
+	return
+}
+
+// Evaluate match every article of the feeds in Rule.AffectedFeeds found in tree, tree must be fetched withData
+func (e *RuleEvaluator) Evaluate(tree *RssTree) (matches []RuleMatch) {
+	for _, feedURL := range e.Rule.AffectedFeeds {
+		node := tree.FindByURL(feedURL)
+		if node == nil {
+			continue
+		}
+		for _, article := range node.Feed.Articles {
+			m := e.Match(article)
+			m.FeedURL = feedURL
+			m.FeedName = node.Name
+			matches = append(matches, m)
+		}
+	}
+	return
+}
+
+// MatchingArticles build the same shape as Rss.MatchingArticles so local and server results can be compared
+func (e *RuleEvaluator) MatchingArticles(tree *RssTree) (resp MatchingArticleResponse) {
+	resp = MatchingArticleResponse{}
+	for _, m := range e.Evaluate(tree) {
+		if m.Matched {
+			resp[m.FeedName] = append(resp[m.FeedName], m.Article.Title)
+		}
+	}
+	return
+}
+
+// CompareMatchingArticles return titles only matched locally and titles only matched by the server
+func CompareMatchingArticles(local, remote MatchingArticleResponse) (onlyLocal, onlyRemote MatchingArticleResponse) {
+	onlyLocal = subtractMatchingArticles(local, remote)
+	onlyRemote = subtractMatchingArticles(remote, local)
+	return
+}
+
+func subtractMatchingArticles(a, b MatchingArticleResponse) MatchingArticleResponse {
+	diff := MatchingArticleResponse{}
+	for feed, titles := range a {
+		seen := map[string]bool{}
+		for _, it := range b[feed] {
+			seen[it] = true
+		}
+		for _, it := range titles {
+			if !seen[it] {
+				diff[feed] = append(diff[feed], it)
+			}
+		}
+	}
+	return diff
+}
@@ -0,0 +1,151 @@
+package qbt_api
+
+import (
+	"context"
+	"github.com/davecgh/go-spew/spew"
+	"testing"
+)
+
+func mustRuleEvaluator(t *testing.T, rule *RuleDef, opts RuleEvaluatorOptions) *RuleEvaluator {
+	e, err := NewRuleEvaluator("test", rule, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return e
+}
+
+func TestRuleEvaluator_Wildcard(t *testing.T) {
+	e := mustRuleEvaluator(t, &RuleDef{
+		MustContain:    "show*1080p x265|other show",
+		MustNotContain: "sample | cam",
+	}, RuleEvaluatorOptions{})
+
+	cases := map[string]bool{
+		"Show.Name.S01E02.1080p.WEB.x265":    true,
+		"x265 Show.Name.S01E02.1080p":        true,
+		"Show.Name.S01E02.720p.WEB.x265":     false,
+		"OTHER SHOW S01E01":                  true,
+		"Show.Name.S01E02.1080p.x265.SAMPLE": false,
+		"Show/Name 1080p x265":               false,
+	}
+	for title, expected := range cases {
+		if m := e.Match(RssArticle{Title: title}); m.Matched != expected {
+			t.Errorf("%q expected %v got %v: %s", title, expected, m.Matched, m.Reason)
+		}
+	}
+}
+
+func TestRuleEvaluator_Regex(t *testing.T) {
+	e := mustRuleEvaluator(t, &RuleDef{
+		MustContain: `^show\.name\.s\d+e\d+|^other`,
+		UseRegex:    true,
+	}, RuleEvaluatorOptions{})
+	if !e.Match(RssArticle{Title: "Show.Name.S01E02"}).Matched || !e.Match(RssArticle{Title: "Other"}).Matched {
+		t.Fatal("regex should match")
+	}
+	if e.Match(RssArticle{Title: "The Show.Name.S01E02"}).Matched {
+		t.Fatal("anchored regex should not match")
+	}
+
+	_, err := NewRuleEvaluator("bad", &RuleDef{MustContain: "(", UseRegex: true}, RuleEvaluatorOptions{})
+	if err == nil {
+		t.Fatal("expected invalid regex error")
+	}
+}
+
+func TestRuleEvaluator_EpisodeFilter(t *testing.T) {
+	e := mustRuleEvaluator(t, &RuleDef{EpisodeFilter: "1x2;8-15;20-;"}, RuleEvaluatorOptions{})
+	cases := map[string]bool{
+		"Show S01E02 720p": true,
+		"Show 1x02":        true,
+		"Show S01E03":      false,
+		"Show S01E08":      true,
+		"Show S01E15":      true,
+		"Show S01E16":      false,
+		"Show S01E25":      true,
+		"Show S02E01":      true,
+		"Show S02E08":      true,
+		"Show":             false,
+	}
+	for title, expected := range cases {
+		if m := e.Match(RssArticle{Title: title}); m.Matched != expected {
+			t.Errorf("%q expected %v got %v: %s", title, expected, m.Matched, m.Reason)
+		}
+	}
+
+	invalid := mustRuleEvaluator(t, &RuleDef{EpisodeFilter: "1x2"}, RuleEvaluatorOptions{})
+	if invalid.Match(RssArticle{Title: "Show S01E02"}).Matched {
+		t.Fatal("filter without trailing ; must not match")
+	}
+
+	// a malformed range goes from the first to the last segment
+	malformed := mustRuleEvaluator(t, &RuleDef{EpisodeFilter: "1x2-3-5;"}, RuleEvaluatorOptions{})
+	if !malformed.Match(RssArticle{Title: "Show S01E04"}).Matched || malformed.Match(RssArticle{Title: "Show S01E06"}).Matched {
+		t.Fatal("unexpected match for a malformed range")
+	}
+}
+
+func TestRuleEvaluator_SmartFilter(t *testing.T) {
+	rule := &RuleDef{
+		MustContain:               "show",
+		SmartFilter:               true,
+		PreviouslyMatchedEpisodes: []string{"1x1"},
+	}
+	e := mustRuleEvaluator(t, rule, RuleEvaluatorOptions{})
+	if e.EpisodeName("Show.S01E02.1080p") != "1x2" || e.EpisodeName("Show 2023.08.15") != "2023.08.15" {
+		t.Fatalf("unexpected episode names %q %q", e.EpisodeName("Show.S01E02.1080p"), e.EpisodeName("Show 2023.08.15"))
+	}
+	if e.Accept(RssArticle{Title: "Show S01E01 REPACK"}).Matched {
+		t.Fatal("repack must be rejected when repacks are disabled")
+	}
+	if !e.Accept(RssArticle{Title: "Show S01E02 1080p"}).Matched {
+		t.Fatal("new episode should match")
+	}
+	if e.Accept(RssArticle{Title: "Show S01E02 720p"}).Matched {
+		t.Fatal("same episode accepted twice")
+	}
+
+	repacks := mustRuleEvaluator(t, rule, RuleEvaluatorOptions{DownloadRepacks: true})
+	if m := repacks.Accept(RssArticle{Title: "Show S01E01 REPACK PROPER"}); !m.Matched || len(m.Episodes) != 4 {
+		t.Fatalf("unexpected repack match %+v", m)
+	}
+	if repacks.Accept(RssArticle{Title: "Show S01E01 PROPER"}).Matched {
+		t.Fatal("proper already covered by repack proper")
+	}
+}
+
+func TestRuleEvaluator_IgnoreDays(t *testing.T) {
+	e := mustRuleEvaluator(t, &RuleDef{
+		IgnoreDays: 2,
+		LastMatch:  "15 Aug 2023 10:00:00 +0000",
+	}, RuleEvaluatorOptions{})
+	if e.Match(RssArticle{Title: "a", Date: "Wed, 16 Aug 2023 10:00:00 +0000"}).Matched {
+		t.Fatal("article inside ignore days matched")
+	}
+	if !e.Match(RssArticle{Title: "a", Date: "Fri, 18 Aug 2023 10:00:00 +0000"}).Matched {
+		t.Fatal("article after ignore days did not match")
+	}
+}
+
+func TestRuleEvaluator_MatchingArticles(t *testing.T) {
+	var ruleName = "ani0"
+	rules, err := api.Rss.Rules(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	rule, ok := rules[ruleName]
+	if !ok {
+		t.Skip("rule not found")
+	}
+	tree, err := api.Rss.Items(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	remote, err := api.Rss.MatchingArticles(context.Background(), ruleName)
+	if err != nil {
+		t.Fatal(err)
+	}
+	e := mustRuleEvaluator(t, &rule, RuleEvaluatorOptions{})
+	onlyLocal, onlyRemote := CompareMatchingArticles(e.MatchingArticles(tree), remote)
+	spew.Dump(onlyLocal, onlyRemote)
+}
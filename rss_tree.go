@@ -0,0 +1,296 @@
+package qbt_api
+
+import (
+	"encoding/json"
+	"errors"
+	"sort"
+	"strings"
+)
+
+// RssPathSeparator separate folder and feed names in item paths used by AddFeed, AddFolder, MoveItem and RemoveItem
+const RssPathSeparator = `\`
+
+// ErrRssWalkSkip can be returned from a walk function to skip the children of a folder
+var ErrRssWalkSkip = errors.New("skip this folder")
+
+var errRssWalkStop = errors.New("stop walking")
+
+// RssNode is either a folder or a feed, Feed is nil for folders
+type RssNode struct {
+	Name     string
+	Path     string
+	Feed     *RssItem
+	Children []*RssNode
+}
+
+func (n *RssNode) IsFolder() bool {
+	return n.Feed == nil
+}
+
+// UnreadCount return unread articles of a feed or all feeds below a folder, articles are only available with withData
+func (n *RssNode) UnreadCount() (count int) {
+	if n.Feed != nil {
+		for _, article := range n.Feed.Articles {
+			if !article.IsRead {
+				count += 1
+			}
+		}
+		return
+	}
+	for _, child := range n.Children {
+		count += child.UnreadCount()
+	}
+	return
+}
+
+// RssTree decode the nested folders and feeds returned by rss/items
+type RssTree struct {
+	Root *RssNode
+}
+
+func JoinRssPath(elem ...string) string {
+	var parts []string
+	for _, it := range elem {
+		if it != "" {
+			parts = append(parts, it)
+		}
+	}
+	return strings.Join(parts, RssPathSeparator)
+}
+
+func SplitRssPath(path string) (parent, name string) {
+	i := strings.LastIndex(path, RssPathSeparator)
+	if i < 0 {
+		return "", path
+	}
+	return path[:i], path[i+len(RssPathSeparator):]
+}
+
+func (t *RssTree) UnmarshalJSON(data []byte) (err error) {
+	t.Root = &RssNode{}
+	return decodeRssFolder(t.Root, data)
+}
+
+func (t *RssTree) MarshalJSON() ([]byte, error) {
+	if t.Root == nil {
+		return []byte("{}"), nil
+	}
+	return json.Marshal(encodeRssFolder(t.Root))
+}
+
+func decodeRssFolder(folder *RssNode, data []byte) (err error) {
+	var entries map[string]json.RawMessage
+	err = json.Unmarshal(data, &entries)
+	if err != nil {
+		return
+	}
+
+	for name, raw := range entries {
+		node := &RssNode{
+			Name: name,
+			Path: JoinRssPath(folder.Path, name),
+		}
+		if isRssFeed(raw) {
+			node.Feed = &RssItem{}
+			err = json.Unmarshal(raw, node.Feed)
+		} else {
+			err = decodeRssFolder(node, raw)
+		}
+		if err != nil {
+			return
+		}
+		folder.Children = append(folder.Children, node)
+	}
+	sort.Slice(folder.Children, func(i, j int) bool {
+		return folder.Children[i].Name < folder.Children[j].Name
+	})
+	return
+}
+
+// isRssFeed tell feeds from folders, a feed always carries string uid and url fields
+func isRssFeed(raw json.RawMessage) bool {
+	var fields map[string]json.RawMessage
+	if json.Unmarshal(raw, &fields) != nil {
+		return false
+	}
+	uid, hasUID := fields["uid"]
+	u, hasURL := fields["url"]
+	return hasUID && hasURL && strings.HasPrefix(string(uid), `"`) && strings.HasPrefix(string(u), `"`)
+}
+
+func encodeRssFolder(folder *RssNode) map[string]any {
+	entries := make(map[string]any, len(folder.Children))
+	for _, child := range folder.Children {
+		if child.Feed != nil {
+			entries[child.Name] = child.Feed
+		} else {
+			entries[child.Name] = encodeRssFolder(child)
+		}
+	}
+	return entries
+}
+
+// Walk visit every node in depth first order, folders are visited before their children
+func (t *RssTree) Walk(fn func(node *RssNode) error) (err error) {
+	if t.Root == nil {
+		return
+	}
+	for _, child := range t.Root.Children {
+		err = walkRssNode(child, fn)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+func walkRssNode(node *RssNode, fn func(node *RssNode) error) (err error) {
+	err = fn(node)
+	if errors.Is(err, ErrRssWalkSkip) {
+		return nil
+	}
+	if err != nil {
+		return
+	}
+	for _, child := range node.Children {
+		err = walkRssNode(child, fn)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
+// Find return node at path or nil, empty path return root
+func (t *RssTree) Find(path string) *RssNode {
+	node := t.Root
+	if path == "" || node == nil {
+		return node
+	}
+	for _, name := range strings.Split(path, RssPathSeparator) {
+		var next *RssNode
+		for _, child := range node.Children {
+			if child.Name == name {
+				next = child
+				break
+			}
+		}
+		if next == nil {
+			return nil
+		}
+		node = next
+	}
+	return node
+}
+
+// FindByURL return the first feed subscribed to url or nil
+func (t *RssTree) FindByURL(url string) (found *RssNode) {
+	t.Walk(func(node *RssNode) error {
+		if node.Feed != nil && node.Feed.URL == url {
+			found = node
+			return errRssWalkStop
+		}
+		return nil
+	})
+	return
+}
+
+func (t *RssTree) Feeds() (feeds []*RssNode) {
+	t.Walk(func(node *RssNode) error {
+		if node.Feed != nil {
+			feeds = append(feeds, node)
+		}
+		return nil
+	})
+	return
+}
+
+func (t *RssTree) Folders() (folders []*RssNode) {
+	t.Walk(func(node *RssNode) error {
+		if node.Feed == nil {
+			folders = append(folders, node)
+		}
+		return nil
+	})
+	return
+}
+
+func (t *RssTree) UnreadCount() int {
+	if t.Root == nil {
+		return 0
+	}
+	return t.Root.UnreadCount()
+}
+
+type RssChangeKind string
+
+const RssChangeAdded RssChangeKind = "added"
+const RssChangeRemoved RssChangeKind = "removed"
+const RssChangeMoved RssChangeKind = "moved"
+const RssChangeURLChanged RssChangeKind = "url_changed"
+
+type RssChange struct {
+	Kind     RssChangeKind
+	IsFolder bool
+	OldPath  string
+	Path     string
+	OldURL   string
+	URL      string
+}
+
+// DiffRssTree compare two trees, feeds are matched by uid then by url so moved feeds are reported as moves
+func DiffRssTree(old, new *RssTree) (changes []RssChange) {
+	oldFeeds := old.Feeds()
+	newFeeds := new.Feeds()
+
+	matched := map[*RssNode]*RssNode{}
+	var used = map[*RssNode]bool{}
+	for _, match := range []func(a, b *RssItem) bool{
+		func(a, b *RssItem) bool { return a.UID != "" && a.UID == b.UID },
+		func(a, b *RssItem) bool { return a.URL == b.URL },
+	} {
+		for _, o := range oldFeeds {
+			if matched[o] != nil {
+				continue
+			}
+			for _, n := range newFeeds {
+				if !used[n] && match(o.Feed, n.Feed) {
+					matched[o] = n
+					used[n] = true
+					break
+				}
+			}
+		}
+	}
+
+	for _, folder := range old.Folders() {
+		if n := new.Find(folder.Path); n == nil || !n.IsFolder() {
+			changes = append(changes, RssChange{Kind: RssChangeRemoved, IsFolder: true, OldPath: folder.Path})
+		}
+	}
+	for _, folder := range new.Folders() {
+		if o := old.Find(folder.Path); o == nil || !o.IsFolder() {
+			changes = append(changes, RssChange{Kind: RssChangeAdded, IsFolder: true, Path: folder.Path})
+		}
+	}
+
+	for _, o := range oldFeeds {
+		n := matched[o]
+		if n == nil {
+			changes = append(changes, RssChange{Kind: RssChangeRemoved, OldPath: o.Path, OldURL: o.Feed.URL})
+			continue
+		}
+		if o.Path != n.Path {
+			changes = append(changes, RssChange{Kind: RssChangeMoved, OldPath: o.Path, Path: n.Path, OldURL: o.Feed.URL, URL: n.Feed.URL})
+		}
+		if o.Feed.URL != n.Feed.URL {
+			changes = append(changes, RssChange{Kind: RssChangeURLChanged, OldPath: o.Path, Path: n.Path, OldURL: o.Feed.URL, URL: n.Feed.URL})
+		}
+	}
+	for _, n := range newFeeds {
+		if !used[n] {
+			changes = append(changes, RssChange{Kind: RssChangeAdded, Path: n.Path, URL: n.Feed.URL})
+		}
+	}
+	return
+}
@@ -0,0 +1,106 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"github.com/davecgh/go-spew/spew"
+	"testing"
+)
+
+const rssItemsWithData = `{
+	"anime": {
+		"dmhy": {"uid": "{a1}", "url": "https://dmhy.org/topics/rss/rss.xml", "title": "dmhy", "articles": [
+			{"id": "1", "title": "ep1", "isRead": true},
+			{"id": "2", "title": "ep2"}
+		]},
+		"old": {
+			"nyaa": {"uid": "{b2}", "url": "https://nyaa.si/?page=rss", "articles": [{"id": "3", "title": "ep3"}]}
+		}
+	},
+	"linux": {"uid": "{c3}", "url": "https://distrowatch.com/news/torrents.xml"}
+}`
+
+func TestRssTree_UnmarshalJSON(t *testing.T) {
+	var tree RssTree
+	err := json.Unmarshal([]byte(rssItemsWithData), &tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	node := tree.Find(`anime\old\nyaa`)
+	if node == nil || node.IsFolder() || node.Feed.URL != "https://nyaa.si/?page=rss" {
+		t.Fatalf("unexpected node %+v", node)
+	}
+	if folder := tree.Find(`anime\old`); folder == nil || !folder.IsFolder() || len(folder.Children) != 1 {
+		t.Fatalf("unexpected folder %+v", folder)
+	}
+	if found := tree.FindByURL("https://distrowatch.com/news/torrents.xml"); found == nil || found.Path != "linux" {
+		t.Fatalf("unexpected feed %+v", found)
+	}
+	if len(tree.Feeds()) != 3 || len(tree.Folders()) != 2 {
+		t.Fatalf("unexpected feeds %d folders %d", len(tree.Feeds()), len(tree.Folders()))
+	}
+	if tree.UnreadCount() != 2 || tree.Find("anime").UnreadCount() != 2 || tree.Find(`anime\dmhy`).UnreadCount() != 1 {
+		t.Fatalf("unexpected unread count %d", tree.UnreadCount())
+	}
+
+	content, err := json.Marshal(&tree)
+	if err != nil {
+		t.Fatal(err)
+	}
+	var again RssTree
+	err = json.Unmarshal(content, &again)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if changes := DiffRssTree(&tree, &again); len(changes) != 0 {
+		t.Fatalf("round trip changed tree %+v", changes)
+	}
+}
+
+func TestDiffRssTree(t *testing.T) {
+	var old, new RssTree
+	err := json.Unmarshal([]byte(rssItemsWithData), &old)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = json.Unmarshal([]byte(`{
+		"anime": {
+			"dmhy": {"uid": "{a1}", "url": "https://share.dmhy.org/topics/rss/rss.xml"},
+			"nyaa": {"uid": "{b2}", "url": "https://nyaa.si/?page=rss"}
+		},
+		"debian": {"uid": "{d4}", "url": "https://www.debian.org/rss.xml"}
+	}`), &new)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var kinds = map[RssChangeKind]int{}
+	for _, change := range DiffRssTree(&old, &new) {
+		kinds[change.Kind] += 1
+		switch change.Kind {
+		case RssChangeMoved:
+			if change.OldPath != `anime\old\nyaa` || change.Path != `anime\nyaa` {
+				t.Errorf("unexpected move %+v", change)
+			}
+		case RssChangeURLChanged:
+			if change.Path != `anime\dmhy` {
+				t.Errorf("unexpected url change %+v", change)
+			}
+		}
+	}
+	// removed: folder anime\old and feed linux, added: feed debian
+	if kinds[RssChangeMoved] != 1 || kinds[RssChangeURLChanged] != 1 || kinds[RssChangeRemoved] != 2 || kinds[RssChangeAdded] != 1 {
+		t.Fatalf("unexpected changes %v", kinds)
+	}
+}
+
+func TestRss_Items_Tree(t *testing.T) {
+	var tree, err = api.Rss.Items(context.Background(), true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	for _, feed := range tree.Feeds() {
+		spew.Dump(feed.Path, feed.UnreadCount())
+	}
+}
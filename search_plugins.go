@@ -0,0 +1,275 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"path"
+	"sort"
+	"strconv"
+	"strings"
+)
+
+// PluginSpec declare a search plugin that should be installed
+type PluginSpec struct {
+	// Name as reported by Search.Plugins, when empty it is the base name of Source without .py,
+	// which is how qBittorrent names installed plugins
+	Name string `json:"name,omitempty" yaml:"name,omitempty"`
+	// Source is an url or a file path on the qBittorrent host passed to InstallPlugin
+	Source string `json:"source,omitempty" yaml:"source,omitempty"`
+	// Enabled default to true
+	Enabled *bool `json:"enabled,omitempty" yaml:"enabled,omitempty"`
+	// Version is the minimum version, older plugins are updated
+	Version string `json:"version,omitempty" yaml:"version,omitempty"`
+	// Categories list category ids the plugin must support
+	Categories []string `json:"categories,omitempty" yaml:"categories,omitempty"`
+}
+
+func (ps *PluginSpec) enabled() bool {
+	return ps.Enabled == nil || *ps.Enabled
+}
+
+func (ps *PluginSpec) name() string {
+	if ps.Name != "" || ps.Source == "" {
+		return ps.Name
+	}
+	source := ps.Source
+	if i := strings.IndexAny(source, "?#"); i >= 0 {
+		source = source[:i]
+	}
+	source = strings.ReplaceAll(source, `\`, "/")
+	return strings.TrimSuffix(path.Base(source), ".py")
+}
+
+func (ps *PluginSpec) String() string {
+	if ps.Name != "" {
+		return ps.Name
+	}
+	return ps.Source
+}
+
+type PluginDrift struct {
+	Plugin  string
+	Message string
+}
+
+func (pd PluginDrift) String() string {
+	return fmt.Sprintf("%s: %s", pd.Plugin, pd.Message)
+}
+
+// PluginPlan is the work needed to reach the declared plugins
+type PluginPlan struct {
+	Install   []string
+	Uninstall []string
+	Enable    []string
+	Disable   []string
+	// Reinstall list sources of outdated plugins, installing over an existing plugin upgrades it
+	Reinstall []string
+	// UpdateAll is set when an outdated plugin has no source and UpdatePlugins must be used
+	UpdateAll bool
+	// Drift describe every difference found, including ones the plan can not fix such as missing categories
+	Drift []PluginDrift
+}
+
+func (pp *PluginPlan) Empty() bool {
+	return len(pp.Install) == 0 && len(pp.Uninstall) == 0 && len(pp.Enable) == 0 && len(pp.Disable) == 0 &&
+		len(pp.Reinstall) == 0 && !pp.UpdateAll
+}
+
+func (pp *PluginPlan) String() string {
+	var lines []string
+	for _, it := range pp.Install {
+		lines = append(lines, "install "+it)
+	}
+	for _, it := range pp.Reinstall {
+		lines = append(lines, "reinstall "+it)
+	}
+	if pp.UpdateAll {
+		lines = append(lines, "update all plugins")
+	}
+	for _, it := range pp.Uninstall {
+		lines = append(lines, "uninstall "+it)
+	}
+	for _, it := range pp.Enable {
+		lines = append(lines, "enable "+it)
+	}
+	for _, it := range pp.Disable {
+		lines = append(lines, "disable "+it)
+	}
+	return strings.Join(lines, "\n")
+}
+
+// CompareVersions compare dotted versions numerically, return -1, 0 or 1
+func CompareVersions(a, b string) int {
+	as := strings.Split(a, ".")
+	bs := strings.Split(b, ".")
+	for i := 0; i < len(as) || i < len(bs); i++ {
+		var x, y int
+		if i < len(as) {
+			x, _ = strconv.Atoi(strings.TrimSpace(as[i]))
+		}
+		if i < len(bs) {
+			y, _ = strconv.Atoi(strings.TrimSpace(bs[i]))
+		}
+		if x < y {
+			return -1
+		}
+		if x > y {
+			return 1
+		}
+	}
+	return 0
+}
+
+func findPlugin(installed PluginsResponse, spec *PluginSpec) *Plugin {
+	name := spec.name()
+	for _, it := range installed {
+		if name != "" && it.Name == name {
+			return it
+		}
+	}
+	return nil
+}
+
+// PlanPlugins compare installed plugins with desired, prune uninstall plugins not declared
+func PlanPlugins(installed PluginsResponse, desired []PluginSpec, prune bool) (plan *PluginPlan) {
+	plan = &PluginPlan{}
+	declared := map[string]bool{}
+
+	for i := range desired {
+		spec := &desired[i]
+		plugin := findPlugin(installed, spec)
+		if plugin == nil {
+			if spec.Source == "" {
+				plan.Drift = append(plan.Drift, PluginDrift{spec.String(), "not installed and no source to install from"})
+				continue
+			}
+			plan.Install = append(plan.Install, spec.Source)
+			// installs are asynchronous and the server ignores disabling a plugin it does not know yet,
+			// so a freshly installed plugin stays enabled until the next plan disables it
+			if !spec.enabled() {
+				plan.Drift = append(plan.Drift, PluginDrift{spec.String(), "not installed, to be disabled once installed"})
+				continue
+			}
+			plan.Drift = append(plan.Drift, PluginDrift{spec.String(), "not installed"})
+			continue
+		}
+		declared[plugin.Name] = true
+
+		if spec.Version != "" && CompareVersions(plugin.Version, spec.Version) < 0 {
+			plan.Drift = append(plan.Drift, PluginDrift{plugin.Name, fmt.Sprintf("version %s is older than %s", plugin.Version, spec.Version)})
+			if spec.Source != "" {
+				plan.Reinstall = append(plan.Reinstall, spec.Source)
+			} else {
+				plan.UpdateAll = true
+			}
+		}
+
+		if plugin.Enabled != spec.enabled() {
+			plan.Drift = append(plan.Drift, PluginDrift{plugin.Name, fmt.Sprintf("enabled is %v, want %v", plugin.Enabled, spec.enabled())})
+			if spec.enabled() {
+				plan.Enable = append(plan.Enable, plugin.Name)
+			} else {
+				plan.Disable = append(plan.Disable, plugin.Name)
+			}
+		}
+
+		if missing := missingCategories(plugin, spec.Categories); len(missing) > 0 {
+			plan.Drift = append(plan.Drift, PluginDrift{plugin.Name, fmt.Sprintf("categories %s are not supported", strings.Join(missing, ", "))})
+		}
+	}
+
+	for _, it := range installed {
+		if declared[it.Name] {
+			continue
+		}
+		plan.Drift = append(plan.Drift, PluginDrift{it.Name, "installed but not declared"})
+		if prune {
+			plan.Uninstall = append(plan.Uninstall, it.Name)
+		}
+	}
+	sort.Strings(plan.Uninstall)
+	return
+}
+
+func missingCategories(plugin *Plugin, categories []string) (missing []string) {
+	supported := map[string]bool{}
+	for _, it := range plugin.SupportedCategories {
+		supported[it.Id] = true
+	}
+	for _, it := range categories {
+		if !supported[it] {
+			missing = append(missing, it)
+		}
+	}
+	return
+}
+
+type ReconcilePluginsOptions struct {
+	// Prune uninstall plugins which are not declared
+	Prune bool
+	// DryRun only compute the plan
+	DryRun bool
+}
+
+// ReconcilePlugins apply the plan and return it together with the drift left afterwards,
+// category mismatches and plugins which failed to install show up in remaining.
+// A plugin declared disabled is installed enabled and disabled by the next run once the server has it
+func (s *Search) ReconcilePlugins(ctx context.Context, desired []PluginSpec, opts ReconcilePluginsOptions) (plan *PluginPlan, remaining []PluginDrift, err error) {
+	installed, err := s.Plugins(ctx)
+	if err != nil {
+		return
+	}
+	plan = PlanPlugins(installed, desired, opts.Prune)
+	if opts.DryRun || plan.Empty() {
+		remaining = plan.Drift
+		return
+	}
+
+	err = s.ApplyPluginPlan(ctx, plan)
+	if err != nil {
+		return
+	}
+
+	// installs are asynchronous on the server, check what is left with the state we can observe now
+	installed, err = s.Plugins(ctx)
+	if err != nil {
+		return
+	}
+	after := PlanPlugins(installed, desired, opts.Prune)
+	remaining = after.Drift
+	return
+}
+
+func (s *Search) ApplyPluginPlan(ctx context.Context, plan *PluginPlan) (err error) {
+	if len(plan.Uninstall) > 0 {
+		err = s.UninstallPlugin(ctx, plan.Uninstall)
+		if err != nil {
+			return
+		}
+	}
+	if sources := append(append([]string{}, plan.Install...), plan.Reinstall...); len(sources) > 0 {
+		err = s.InstallPlugin(ctx, sources)
+		if err != nil {
+			return
+		}
+	}
+	if plan.UpdateAll {
+		err = s.UpdatePlugins(ctx)
+		if err != nil {
+			return
+		}
+	}
+	if len(plan.Enable) > 0 {
+		err = s.EnablePlugin(ctx, plan.Enable, true)
+		if err != nil {
+			return
+		}
+	}
+	if len(plan.Disable) > 0 {
+		err = s.EnablePlugin(ctx, plan.Disable, false)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
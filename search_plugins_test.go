@@ -0,0 +1,96 @@
+package qbt_api
+
+import (
+	"context"
+	"testing"
+)
+
+func TestPlanPlugins(t *testing.T) {
+	var disabled = false
+	installed := PluginsResponse{
+		{Name: "eztv", Version: "1.10", Enabled: true, Url: "https://eztv.re", SupportedCategories: []PluginCategory{{Id: "tv"}}},
+		{Name: "limetorrents", Version: "4.7", Enabled: false, SupportedCategories: []PluginCategory{{Id: "all"}, {Id: "movies"}}},
+		{Name: "piratebay", Version: "3.3", Enabled: true},
+	}
+	desired := []PluginSpec{
+		{Name: "eztv", Source: "https://example.com/eztv.py", Version: "1.9", Categories: []string{"tv", "anime"}},
+		{Name: "limetorrents", Version: "4.8"},
+		{Name: "jackett", Source: "/plugins/jackett.py", Enabled: &disabled},
+		{Name: "piratebay", Enabled: &disabled},
+	}
+
+	plan := PlanPlugins(installed, desired, true)
+	if len(plan.Install) != 1 || plan.Install[0] != "/plugins/jackett.py" {
+		t.Fatalf("unexpected install %v", plan.Install)
+	}
+	if !plan.UpdateAll || len(plan.Reinstall) != 0 {
+		t.Fatalf("limetorrents should be updated through UpdatePlugins %v", plan)
+	}
+	if len(plan.Enable) != 1 || plan.Enable[0] != "limetorrents" {
+		t.Fatalf("unexpected enable %v", plan.Enable)
+	}
+	// jackett is only disabled by a later plan once the server has installed it
+	if len(plan.Disable) != 1 || plan.Disable[0] != "piratebay" {
+		t.Fatalf("unexpected disable %v", plan.Disable)
+	}
+	if len(plan.Uninstall) != 0 {
+		t.Fatalf("unexpected uninstall %v", plan.Uninstall)
+	}
+
+	var categoryDrift = false
+	for _, it := range plan.Drift {
+		if it.Plugin == "eztv" && it.Message == "categories anime are not supported" {
+			categoryDrift = true
+		}
+	}
+	for _, it := range plan.Drift {
+		if it.Plugin == "jackett" && it.Message != "not installed, to be disabled once installed" {
+			t.Fatalf("unexpected jackett drift %v", it)
+		}
+	}
+	if !categoryDrift {
+		t.Fatalf("missing category drift %v", plan.Drift)
+	}
+
+	pruned := PlanPlugins(installed, desired[:1], true)
+	if len(pruned.Uninstall) != 2 {
+		t.Fatalf("unexpected uninstall %v", pruned.Uninstall)
+	}
+}
+
+func TestPlanPlugins_SourceOnly(t *testing.T) {
+	installed := PluginsResponse{
+		{Name: "eztv", Version: "1.10", Enabled: true, Url: "https://eztv.re"},
+		{Name: "jackett", Version: "4.0", Enabled: true, Url: "http://127.0.0.1:9117"},
+	}
+	desired := []PluginSpec{
+		{Source: "https://example.com/plugins/eztv.py?raw=1"},
+		{Source: `C:\plugins\jackett.py`},
+	}
+	plan := PlanPlugins(installed, desired, true)
+	if !plan.Empty() || len(plan.Drift) != 0 {
+		t.Fatalf("source only specs should match installed plugins %v %v", plan, plan.Drift)
+	}
+
+	plan = PlanPlugins(installed[:1], desired, true)
+	if len(plan.Install) != 1 || plan.Install[0] != `C:\plugins\jackett.py` || len(plan.Uninstall) != 0 {
+		t.Fatalf("unexpected plan %v", plan)
+	}
+}
+
+func TestCompareVersions(t *testing.T) {
+	if CompareVersions("1.10", "1.9") != 1 || CompareVersions("2.0", "2") != 0 || CompareVersions("4.7", "4.8") != -1 {
+		t.Fatal("unexpected version order")
+	}
+}
+
+func TestSearch_ReconcilePlugins(t *testing.T) {
+	plan, drift, err := api.Search.ReconcilePlugins(context.Background(), []PluginSpec{
+		{Name: "kickass_torrent"},
+	}, ReconcilePluginsOptions{DryRun: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+	t.Log(plan)
+	t.Log(drift)
+}
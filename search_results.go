@@ -0,0 +1,247 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/base32"
+	"encoding/hex"
+	"math"
+	"net/url"
+	"regexp"
+	"sort"
+	"strings"
+)
+
+var resultNameSeparators = regexp.MustCompile(`[\s._\-+\[\](){}]+`)
+
+// NormalizeResultName lower case name, drop .torrent suffix and turn punctuation used as separator into single spaces
+func NormalizeResultName(name string) string {
+	name = strings.ToLower(strings.TrimSpace(name))
+	name = strings.TrimSuffix(name, ".torrent")
+	name = resultNameSeparators.ReplaceAllString(name, " ")
+	return strings.TrimSpace(name)
+}
+
+// MagnetInfohash return the lower case hex v1 infohash of a magnet link, or empty string if link is not a magnet
+func MagnetInfohash(link string) string {
+	if !strings.HasPrefix(link, "magnet:?") {
+		return ""
+	}
+	query, err := url.ParseQuery(strings.TrimPrefix(link, "magnet:?"))
+	if err != nil {
+		return ""
+	}
+	for _, xt := range query["xt"] {
+		if !strings.HasPrefix(strings.ToLower(xt), "urn:btih:") {
+			continue
+		}
+		hash := xt[len("urn:btih:"):]
+		switch len(hash) {
+		case 40:
+			if _, err = hex.DecodeString(hash); err == nil {
+				return strings.ToLower(hash)
+			}
+		case 32:
+			raw, err := base32.StdEncoding.DecodeString(strings.ToUpper(hash))
+			if err == nil {
+				return hex.EncodeToString(raw)
+			}
+		}
+	}
+	return ""
+}
+
+type SearchResultFilter struct {
+	// MinSize and MaxSize in bytes, zero means no bound
+	MinSize    int64
+	MaxSize    int64
+	MinSeeders int64
+	// Include must match the file name when set
+	Include *regexp.Regexp
+	// Exclude must not match the file name when set
+	Exclude *regexp.Regexp
+}
+
+func (f SearchResultFilter) Match(r Result) bool {
+	if f.MinSize > 0 && r.FileSize < f.MinSize {
+		return false
+	}
+	if f.MaxSize > 0 && r.FileSize > f.MaxSize {
+		return false
+	}
+	if r.NbSeeders < f.MinSeeders {
+		return false
+	}
+	if f.Include != nil && !f.Include.MatchString(r.FileName) {
+		return false
+	}
+	if f.Exclude != nil && f.Exclude.MatchString(r.FileName) {
+		return false
+	}
+	return true
+}
+
+func FilterResults(results []Result, filter SearchResultFilter) (filtered []Result) {
+	for _, it := range results {
+		if filter.Match(it) {
+			filtered = append(filtered, it)
+		}
+	}
+	return
+}
+
+type SearchDedupOptions struct {
+	// SizeTolerance is the relative size difference still considered the same torrent, default 0.01
+	SizeTolerance float64
+	// NameSimilarity is the minimum token overlap of normalized names, default 0.8
+	NameSimilarity float64
+}
+
+var DefaultSearchDedupOptions = SearchDedupOptions{
+	SizeTolerance:  0.01,
+	NameSimilarity: 0.8,
+}
+
+// RankedResult is a deduplicated result, Result is the source with most seeders and Sources hold every duplicate
+type RankedResult struct {
+	Result
+	Infohash       string
+	NormalizedName string
+	Sources        []Result
+	Score          float64
+}
+
+// SiteUrls list the distinct sites that returned the torrent
+func (r *RankedResult) SiteUrls() (sites []string) {
+	seen := map[string]bool{}
+	for _, it := range r.Sources {
+		if !seen[it.SiteUrl] {
+			seen[it.SiteUrl] = true
+			sites = append(sites, it.SiteUrl)
+		}
+	}
+	return
+}
+
+// DedupResults merge results with the same magnet infohash, or without infohash the same fuzzy name and size
+func DedupResults(results []Result, opts SearchDedupOptions) (deduped []*RankedResult) {
+	if opts.SizeTolerance <= 0 {
+		opts.SizeTolerance = DefaultSearchDedupOptions.SizeTolerance
+	}
+	if opts.NameSimilarity <= 0 {
+		opts.NameSimilarity = DefaultSearchDedupOptions.NameSimilarity
+	}
+
+	byHash := map[string]*RankedResult{}
+	for _, it := range results {
+		hash := MagnetInfohash(it.FileUrl)
+		name := NormalizeResultName(it.FileName)
+
+		var group *RankedResult
+		if hash != "" {
+			group = byHash[hash]
+		}
+		if group == nil {
+			for _, candidate := range deduped {
+				if hash != "" && candidate.Infohash != "" {
+					continue
+				}
+				if sizeClose(candidate.FileSize, it.FileSize, opts.SizeTolerance) && nameSimilarity(candidate.NormalizedName, name) >= opts.NameSimilarity {
+					group = candidate
+					break
+				}
+			}
+		}
+
+		if group == nil {
+			group = &RankedResult{Result: it, Infohash: hash, NormalizedName: name}
+			deduped = append(deduped, group)
+		} else if it.NbSeeders > group.NbSeeders {
+			group.Result = it
+		}
+		if group.Infohash == "" && hash != "" {
+			group.Infohash = hash
+		}
+		if group.Infohash != "" {
+			byHash[group.Infohash] = group
+		}
+		group.Sources = append(group.Sources, it)
+	}
+	return
+}
+
+func sizeClose(a, b int64, tolerance float64) bool {
+	if a <= 0 || b <= 0 {
+		return a == b
+	}
+	return math.Abs(float64(a-b)) <= tolerance*math.Max(float64(a), float64(b))
+}
+
+// nameSimilarity is the Jaccard index of the name tokens
+func nameSimilarity(a, b string) float64 {
+	if a == b {
+		return 1
+	}
+	tokens := map[string]int{}
+	for _, it := range strings.Fields(a) {
+		tokens[it] |= 1
+	}
+	for _, it := range strings.Fields(b) {
+		tokens[it] |= 2
+	}
+	var both = 0
+	for _, mask := range tokens {
+		if mask == 3 {
+			both += 1
+		}
+	}
+	if len(tokens) == 0 {
+		return 0
+	}
+	return float64(both) / float64(len(tokens))
+}
+
+type SearchRanking struct {
+	SeedersWeight  float64
+	LeechersWeight float64
+	// PreferredSize in bytes, results are penalized by SizeWeight per order of magnitude away from it
+	PreferredSize int64
+	SizeWeight    float64
+}
+
+var DefaultSearchRanking = SearchRanking{
+	SeedersWeight:  1,
+	LeechersWeight: 0.25,
+}
+
+func (sr SearchRanking) Score(r Result) (score float64) {
+	score += sr.SeedersWeight * math.Log1p(math.Max(float64(r.NbSeeders), 0))
+	score += sr.LeechersWeight * math.Log1p(math.Max(float64(r.NbLeechers), 0))
+	if sr.PreferredSize > 0 && r.FileSize > 0 {
+		score -= sr.SizeWeight * math.Abs(math.Log10(float64(r.FileSize)/float64(sr.PreferredSize)))
+	}
+	return
+}
+
+// RankResults score and sort results best first, ties keep their order
+func RankResults(results []*RankedResult, ranking SearchRanking) {
+	for _, it := range results {
+		it.Score = ranking.Score(it.Result)
+	}
+	sort.SliceStable(results, func(i, j int) bool {
+		return results[i].Score > results[j].Score
+	})
+}
+
+// ProcessResults filter, deduplicate and rank results from one or many plugins
+func ProcessResults(results []Result, filter SearchResultFilter, dedup SearchDedupOptions, ranking SearchRanking) []*RankedResult {
+	ranked := DedupResults(FilterResults(results, filter), dedup)
+	RankResults(ranked, ranking)
+	return ranked
+}
+
+// AddSearchResult add the torrent behind a search result, Urls of opts is replaced by the result FileUrl
+func (tm *TorrentManagement) AddSearchResult(ctx context.Context, result Result, opts TorrentManagementAddOptions) (err error) {
+	opts.Urls = []string{result.FileUrl}
+	opts.Torrents = nil
+	return tm.Add(ctx, opts)
+}
@@ -0,0 +1,58 @@
+package qbt_api
+
+import (
+	"context"
+	"regexp"
+	"testing"
+)
+
+func TestMagnetInfohash(t *testing.T) {
+	cases := map[string]string{
+		"magnet:?xt=urn:btih:C697E22D8B385A4A667D773467A840ADAE200919&dn=x": "c697e22d8b385a4a667d773467a840adae200919",
+		"magnet:?xt=urn:btih:YSL6EXMLHBNEUZT5O42GPKCA5WXCACIZ":              "c497e25d8b385a4a667d773467a840edae200919",
+		"https://example.com/file.torrent":                                  "",
+	}
+	for link, expected := range cases {
+		if got := MagnetInfohash(link); got != expected {
+			t.Errorf("%s expected %q got %q", link, expected, got)
+		}
+	}
+}
+
+func TestProcessResults(t *testing.T) {
+	const gib = 1 << 30
+	results := []Result{
+		{FileName: "Ubuntu.22.04.Desktop.amd64", FileSize: 4 * gib, NbSeeders: 10, SiteUrl: "https://a", FileUrl: "magnet:?xt=urn:btih:c697e22d8b385a4a667d773467a840adae200919"},
+		{FileName: "[ubuntu] 22.04 desktop amd64", FileSize: 4*gib + 1000, NbSeeders: 50, SiteUrl: "https://b", FileUrl: "https://b/1.torrent"},
+		{FileName: "ubuntu 22.04 desktop amd64", FileSize: 4 * gib, NbSeeders: 5, SiteUrl: "https://c", FileUrl: "magnet:?xt=urn:btih:C697E22D8B385A4A667D773467A840ADAE200919"},
+		{FileName: "ubuntu 22.04 server amd64", FileSize: 2 * gib, NbSeeders: 100, SiteUrl: "https://a", FileUrl: "https://a/2.torrent"},
+		{FileName: "ubuntu 22.04 desktop amd64 CAM", FileSize: 4 * gib, NbSeeders: 1000, SiteUrl: "https://a", FileUrl: "https://a/3.torrent"},
+		{FileName: "tiny", FileSize: 1000, NbSeeders: 1000, SiteUrl: "https://a", FileUrl: "https://a/4.torrent"},
+	}
+
+	ranked := ProcessResults(results, SearchResultFilter{
+		MinSize: 1 << 20,
+		Exclude: regexp.MustCompile(`(?i)\bcam\b`),
+	}, SearchDedupOptions{}, DefaultSearchRanking)
+
+	if len(ranked) != 2 {
+		t.Fatalf("expected 2 results got %d", len(ranked))
+	}
+	if ranked[0].FileName != "ubuntu 22.04 server amd64" {
+		t.Fatalf("unexpected best result %s", ranked[0].FileName)
+	}
+	desktop := ranked[1]
+	if len(desktop.Sources) != 3 || desktop.NbSeeders != 50 || desktop.Infohash != "c697e22d8b385a4a667d773467a840adae200919" || len(desktop.SiteUrls()) != 3 {
+		t.Fatalf("unexpected merged result %+v", desktop)
+	}
+}
+
+func TestTorrentManagement_AddSearchResult(t *testing.T) {
+	var category = "search"
+	var err = api.TorrentManagement.AddSearchResult(context.Background(), Result{
+		FileUrl: "magnet:?xt=urn:btih:c697e22d8b385a4a667d773467a840adae200919",
+	}, TorrentManagementAddOptions{Category: &category, Tags: []string{"search"}, Paused: true})
+	if err != nil {
+		t.Fatal(err)
+	}
+}
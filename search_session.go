@@ -0,0 +1,200 @@
+package qbt_api
+
+import (
+	"context"
+	"sync"
+	"time"
+)
+
+// MaxConcurrentSearches is the number of running searches qBittorrent allows per session
+const MaxConcurrentSearches = 5
+
+const DefaultSearchPollInterval = time.Second
+const DefaultSearchPageSize int64 = 100
+
+type SearchSessionOptions struct {
+	// PollInterval default to DefaultSearchPollInterval
+	PollInterval time.Duration
+	// PageSize is the limit passed to Results, default to DefaultSearchPageSize
+	PageSize int64
+	// Timeout stop the search after this duration, zero means until the search stops by itself
+	Timeout time.Duration
+}
+
+// SearchManager start searches without exceeding MaxConcurrentSearches
+type SearchManager struct {
+	api   *Api
+	slots chan struct{}
+}
+
+// NewManager limit below or equal zero means MaxConcurrentSearches
+func (s *Search) NewManager(limit int) *SearchManager {
+	if limit <= 0 || limit > MaxConcurrentSearches {
+		limit = MaxConcurrentSearches
+	}
+	return &SearchManager{
+		api:   s.api,
+		slots: make(chan struct{}, limit),
+	}
+}
+
+// SearchSession stream results of a single search job and delete the job when it is done
+type SearchSession struct {
+	Id int64
+
+	api     *Api
+	opts    SearchSessionOptions
+	results chan Result
+	cancel  context.CancelFunc
+	done    chan struct{}
+
+	mu     sync.Mutex
+	err    error
+	total  int64
+	status StatusEnum
+}
+
+// Start wait for a free slot, start the search and stream its results until it stops, ctx is done or Timeout hits
+func (m *SearchManager) Start(ctx context.Context, opts *SearchOptions, sessionOpts SearchSessionOptions) (session *SearchSession, err error) {
+	select {
+	case m.slots <- struct{}{}:
+	case <-ctx.Done():
+		err = ctx.Err()
+		return
+	}
+
+	resp, err := m.api.Search.Start(ctx, opts)
+	if err != nil {
+		<-m.slots
+		return
+	}
+
+	if sessionOpts.PollInterval <= 0 {
+		sessionOpts.PollInterval = DefaultSearchPollInterval
+	}
+	if sessionOpts.PageSize <= 0 {
+		sessionOpts.PageSize = DefaultSearchPageSize
+	}
+
+	var runCtx context.Context
+	var cancel context.CancelFunc
+	if sessionOpts.Timeout > 0 {
+		runCtx, cancel = context.WithTimeout(ctx, sessionOpts.Timeout)
+	} else {
+		runCtx, cancel = context.WithCancel(ctx)
+	}
+
+	session = &SearchSession{
+		Id:      resp.Id,
+		api:     m.api,
+		opts:    sessionOpts,
+		results: make(chan Result),
+		cancel:  cancel,
+		done:    make(chan struct{}),
+		status:  StatusRunning,
+	}
+	go func() {
+		defer func() { <-m.slots }()
+		session.run(runCtx)
+	}()
+	return
+}
+
+// Results is closed once the search is finished and deleted, it must be drained
+func (ss *SearchSession) Results() <-chan Result {
+	return ss.results
+}
+
+// Cancel stop the search early, remaining results are not fetched
+func (ss *SearchSession) Cancel() {
+	ss.cancel()
+}
+
+// Wait block until the job is deleted, a deadline or cancellation is not reported as error
+func (ss *SearchSession) Wait() error {
+	<-ss.done
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.err
+}
+
+func (ss *SearchSession) Total() int64 {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.total
+}
+
+func (ss *SearchSession) Status() StatusEnum {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	return ss.status
+}
+
+func (ss *SearchSession) run(ctx context.Context) {
+	defer close(ss.done)
+	defer close(ss.results)
+	defer ss.cancel()
+	defer ss.cleanup()
+
+	ticker := time.NewTicker(ss.opts.PollInterval)
+	defer ticker.Stop()
+
+	var offset int64
+	for {
+		resp, err := ss.api.Search.Results(ctx, ss.Id, ss.opts.PageSize, offset)
+		if ctx.Err() != nil {
+			return
+		}
+		if err != nil {
+			ss.setErr(err)
+			return
+		}
+
+		ss.mu.Lock()
+		ss.total = resp.Total
+		ss.status = resp.Status
+		ss.mu.Unlock()
+
+		for _, it := range resp.Results {
+			select {
+			case ss.results <- it:
+			case <-ctx.Done():
+				return
+			}
+		}
+		offset += int64(len(resp.Results))
+
+		// keep paging without waiting while a full page came back
+		if int64(len(resp.Results)) == ss.opts.PageSize {
+			continue
+		}
+		if resp.Status == StatusStopped && offset >= resp.Total {
+			return
+		}
+
+		select {
+		case <-ctx.Done():
+			return
+		case <-ticker.C:
+		}
+	}
+}
+
+// cleanup always delete the job, ctx may already be done so a fresh one is used
+func (ss *SearchSession) cleanup() {
+	ctx, cancel := context.WithTimeout(context.Background(), 10*time.Second)
+	defer cancel()
+
+	err := ss.api.Search.Delete(ctx, ss.Id)
+	if err != nil {
+		ss.setErr(err)
+	}
+}
+
+func (ss *SearchSession) setErr(err error) {
+	ss.mu.Lock()
+	defer ss.mu.Unlock()
+	if ss.err == nil {
+		ss.err = err
+	}
+}
@@ -0,0 +1,146 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"fmt"
+	"net/http"
+	"net/http/httptest"
+	"strconv"
+	"sync"
+	"testing"
+	"time"
+)
+
+// fakeSearchServer serve a search whose results grow by one on every poll until total is reached
+func fakeSearchServer(t *testing.T, total int64) (srv *httptest.Server, deleted func() []int64) {
+	var mu sync.Mutex
+	var polls = map[int64]int64{}
+	var deletedIds []int64
+	var nextId int64
+
+	srv = httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		id, _ := strconv.ParseInt(r.Form.Get("id"), 10, 64)
+
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/search/start":
+			nextId += 1
+			fmt.Fprintf(w, `{"id":%d}`, nextId)
+		case "/api/v2/search/results":
+			polls[id] += 1
+			available := polls[id]
+			if available > total {
+				available = total
+			}
+			limit, _ := strconv.ParseInt(r.Form.Get("limit"), 10, 64)
+			offset, _ := strconv.ParseInt(r.Form.Get("offset"), 10, 64)
+			resp := ResultResponse{Status: StatusRunning, Total: available}
+			if available == total {
+				resp.Status = StatusStopped
+			}
+			for i := offset; i < available && (limit == 0 || i < offset+limit); i++ {
+				resp.Results = append(resp.Results, Result{FileName: fmt.Sprintf("result %d", i)})
+			}
+			json.NewEncoder(w).Encode(resp)
+		case "/api/v2/search/delete":
+			deletedIds = append(deletedIds, id)
+		default:
+			t.Errorf("unexpected path %s", r.URL.Path)
+		}
+	}))
+	deleted = func() []int64 {
+		mu.Lock()
+		defer mu.Unlock()
+		return append([]int64(nil), deletedIds...)
+	}
+	return
+}
+
+func TestSearchSession_Stream(t *testing.T) {
+	srv, deleted := fakeSearchServer(t, 5)
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := client.Search.NewManager(1)
+	session, err := manager.Start(context.Background(), &SearchOptions{Pattern: "x", UseAllPlugins: true, UseAllCategory: true}, SearchSessionOptions{
+		PollInterval: time.Millisecond,
+		PageSize:     2,
+	})
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	var names []string
+	for it := range session.Results() {
+		names = append(names, it.FileName)
+	}
+	if err = session.Wait(); err != nil {
+		t.Fatal(err)
+	}
+	if len(names) != 5 || names[4] != "result 4" || session.Status() != StatusStopped {
+		t.Fatalf("unexpected results %v status %s", names, session.Status())
+	}
+	if ids := deleted(); len(ids) != 1 || ids[0] != session.Id {
+		t.Fatalf("search was not deleted %v", ids)
+	}
+}
+
+func TestSearchSession_Timeout(t *testing.T) {
+	srv, deleted := fakeSearchServer(t, 1000)
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	manager := client.Search.NewManager(1)
+	opts := SearchSessionOptions{PollInterval: time.Millisecond, Timeout: 30 * time.Millisecond}
+	first, err := manager.Start(context.Background(), &SearchOptions{Pattern: "x"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	go func() {
+		for range first.Results() {
+		}
+	}()
+
+	// the only slot is taken so the second search waits for the first one to be deleted
+	second, err := manager.Start(context.Background(), &SearchOptions{Pattern: "y"}, opts)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if ids := deleted(); len(ids) != 1 || ids[0] != first.Id {
+		t.Fatalf("second search started before first was deleted %v", ids)
+	}
+	for range second.Results() {
+	}
+	second.Wait()
+	if ids := deleted(); len(ids) != 2 {
+		t.Fatalf("unexpected deleted searches %v", ids)
+	}
+}
+
+func TestSearchManager_Start(t *testing.T) {
+	manager := api.Search.NewManager(0)
+	session, err := manager.Start(context.Background(), &SearchOptions{
+		Pattern:        "life is like a boat",
+		UseAllPlugins:  true,
+		UseAllCategory: true,
+	}, SearchSessionOptions{Timeout: 30 * time.Second})
+	if err != nil {
+		t.Fatal(err)
+	}
+	for it := range session.Results() {
+		t.Log(it.FileName, it.NbSeeders)
+	}
+	err = session.Wait()
+	if err != nil {
+		t.Fatal(err)
+	}
+}
@@ -0,0 +1,422 @@
+package qbt_api
+
+import (
+	"context"
+	"encoding/json"
+	"errors"
+	"fmt"
+	"gopkg.in/yaml.v3"
+	"io"
+	"net/url"
+	"os"
+	"sort"
+	"strings"
+	"time"
+)
+
+type PolicyActionKind string
+
+// PolicyKeep stop the evaluation of later rules without doing anything
+const PolicyKeep PolicyActionKind = "keep"
+const PolicyPause PolicyActionKind = "pause"
+
+// PolicyDelete remove the torrent and keep its files
+const PolicyDelete PolicyActionKind = "delete"
+const PolicyDeleteFiles PolicyActionKind = "delete_files"
+const PolicySetCategory PolicyActionKind = "set_category"
+const PolicyAddTags PolicyActionKind = "add_tags"
+
+type PolicyAction struct {
+	Kind     PolicyActionKind `json:"kind" yaml:"kind"`
+	Category string           `json:"category,omitempty" yaml:"category,omitempty"`
+	Tags     []string         `json:"tags,omitempty" yaml:"tags,omitempty"`
+}
+
+func (pa PolicyAction) String() string {
+	switch pa.Kind {
+	case PolicySetCategory:
+		return fmt.Sprintf("%s %s", pa.Kind, pa.Category)
+	case PolicyAddTags:
+		return fmt.Sprintf("%s %s", pa.Kind, strings.Join(pa.Tags, ","))
+	default:
+		return string(pa.Kind)
+	}
+}
+
+// SeedingMatch is a set of conditions which must all hold, unset fields are ignored
+type SeedingMatch struct {
+	// Trackers match the tracker host or any of its parent domains
+	Trackers []string `json:"trackers,omitempty" yaml:"trackers,omitempty"`
+	// ExcludeTrackers skip torrents whose tracker host is one of them or a sub domain
+	ExcludeTrackers []string `json:"excludeTrackers,omitempty" yaml:"excludeTrackers,omitempty"`
+	Categories      []string `json:"categories,omitempty" yaml:"categories,omitempty"`
+	// Tags match torrents having at least one of them
+	Tags []string `json:"tags,omitempty" yaml:"tags,omitempty"`
+	// ExcludeTags skip torrents having any of them
+	ExcludeTags []string                     `json:"excludeTags,omitempty" yaml:"excludeTags,omitempty"`
+	States      []TorrentManagementInfoState `json:"states,omitempty" yaml:"states,omitempty"`
+	// IncludeIncomplete also match torrents which are not fully downloaded
+	IncludeIncomplete bool     `json:"includeIncomplete,omitempty" yaml:"includeIncomplete,omitempty"`
+	MinRatio          *float64 `json:"minRatio,omitempty" yaml:"minRatio,omitempty"`
+	// MinSeedingTime is written like 72h in yaml
+	MinSeedingTime *time.Duration `json:"minSeedingTime,omitempty" yaml:"minSeedingTime,omitempty"`
+	// RatioOrTime make reaching either MinRatio or MinSeedingTime enough
+	RatioOrTime bool `json:"ratioOrTime,omitempty" yaml:"ratioOrTime,omitempty"`
+	// MinSeeders and MaxSeeders bound NumComplete, the seeders in the swarm
+	MinSeeders *int `json:"minSeeders,omitempty" yaml:"minSeeders,omitempty"`
+	MaxSeeders *int `json:"maxSeeders,omitempty" yaml:"maxSeeders,omitempty"`
+}
+
+type SeedingRule struct {
+	Name   string       `json:"name" yaml:"name"`
+	Match  SeedingMatch `json:"match" yaml:"match"`
+	Action PolicyAction `json:"action" yaml:"action"`
+}
+
+// SeedingPolicy is an ordered list of rules, the first matching rule decide what happens to a torrent
+type SeedingPolicy struct {
+	Rules []SeedingRule `json:"rules" yaml:"rules"`
+}
+
+// LoadSeedingPolicy read a yaml or json file and validate it
+func LoadSeedingPolicy(path string) (policy *SeedingPolicy, err error) {
+	content, err := os.ReadFile(path)
+	if err != nil {
+		return
+	}
+	policy = &SeedingPolicy{}
+	err = yaml.Unmarshal(content, policy)
+	if err == nil {
+		err = policy.Validate()
+	}
+	if err != nil {
+		err = fmt.Errorf("%s: %w", path, err)
+	}
+	return
+}
+
+func (sp *SeedingPolicy) Validate() error {
+	var errs []error
+	for i, rule := range sp.Rules {
+		name := rule.Name
+		if name == "" {
+			name = fmt.Sprintf("rule %d", i+1)
+		}
+		switch rule.Action.Kind {
+		case PolicyKeep, PolicyPause, PolicyDelete, PolicyDeleteFiles:
+		case PolicySetCategory:
+			if rule.Action.Category == "" {
+				errs = append(errs, fmt.Errorf("%s: set_category needs a category", name))
+			}
+		case PolicyAddTags:
+			if len(rule.Action.Tags) == 0 {
+				errs = append(errs, fmt.Errorf("%s: add_tags needs tags", name))
+			}
+		default:
+			errs = append(errs, fmt.Errorf("%s: unknown action %q", name, rule.Action.Kind))
+		}
+	}
+	return errors.Join(errs...)
+}
+
+func (sp *SeedingPolicy) needTrackers() bool {
+	for _, rule := range sp.Rules {
+		if len(rule.Match.Trackers) > 0 || len(rule.Match.ExcludeTrackers) > 0 {
+			return true
+		}
+	}
+	return false
+}
+
+// PolicyDecision is the outcome of a rule for one torrent
+type PolicyDecision struct {
+	Hash   string
+	Name   string
+	Rule   string
+	Action PolicyAction
+	// Reason list the conditions which made the rule match
+	Reason string
+}
+
+func (pd PolicyDecision) String() string {
+	return fmt.Sprintf("%s: %s by rule %s (%s)", pd.Name, pd.Action, pd.Rule, pd.Reason)
+}
+
+// TrackerHost return the lower case host of a tracker url, or an empty string
+func TrackerHost(tracker string) string {
+	u, err := url.Parse(tracker)
+	if err != nil {
+		return ""
+	}
+	return strings.ToLower(u.Hostname())
+}
+
+func hostMatch(host string, domains []string) bool {
+	for _, it := range domains {
+		it = strings.ToLower(strings.TrimPrefix(it, "."))
+		if host == it || strings.HasSuffix(host, "."+it) {
+			return true
+		}
+	}
+	return false
+}
+
+func anyOf(values []string, set []string) bool {
+	for _, v := range values {
+		for _, it := range set {
+			if v == it {
+				return true
+			}
+		}
+	}
+	return false
+}
+
+// Match check the conditions against torrent, host is its tracker host,
+// reason describe the conditions that hold when ok is true
+func (sm *SeedingMatch) Match(torrent *TorrentManagementInfo, host string) (ok bool, reason string) {
+	var reasons []string
+	if !sm.IncludeIncomplete && torrent.Progress < 1 {
+		return false, ""
+	}
+	if len(sm.Trackers) > 0 {
+		if !hostMatch(host, sm.Trackers) {
+			return false, ""
+		}
+		reasons = append(reasons, "tracker "+host)
+	}
+	if hostMatch(host, sm.ExcludeTrackers) {
+		return false, ""
+	}
+	if len(sm.Categories) > 0 {
+		if !anyOf([]string{torrent.Category}, sm.Categories) {
+			return false, ""
+		}
+		reasons = append(reasons, "category "+torrent.Category)
+	}
+	tags := SplitTags(torrent.Tags)
+	if len(sm.Tags) > 0 {
+		if !anyOf(tags, sm.Tags) {
+			return false, ""
+		}
+		reasons = append(reasons, "tags "+torrent.Tags)
+	}
+	if anyOf(tags, sm.ExcludeTags) {
+		return false, ""
+	}
+	if len(sm.States) > 0 {
+		found := false
+		for _, it := range sm.States {
+			found = found || it == torrent.State
+		}
+		if !found {
+			return false, ""
+		}
+		reasons = append(reasons, "state "+string(torrent.State))
+	}
+
+	seedingTime := time.Duration(torrent.SeedingTime) * time.Second
+	ratioOk := sm.MinRatio == nil || torrent.Ratio >= *sm.MinRatio
+	timeOk := sm.MinSeedingTime == nil || seedingTime >= *sm.MinSeedingTime
+	if sm.RatioOrTime && sm.MinRatio != nil && sm.MinSeedingTime != nil {
+		if !ratioOk && !timeOk {
+			return false, ""
+		}
+	} else if !ratioOk || !timeOk {
+		return false, ""
+	}
+	if sm.MinRatio != nil && ratioOk {
+		reasons = append(reasons, fmt.Sprintf("ratio %.2f >= %.2f", torrent.Ratio, *sm.MinRatio))
+	}
+	if sm.MinSeedingTime != nil && timeOk {
+		reasons = append(reasons, fmt.Sprintf("seeding %s >= %s", seedingTime, *sm.MinSeedingTime))
+	}
+
+	if sm.MinSeeders != nil {
+		if torrent.NumComplete < *sm.MinSeeders {
+			return false, ""
+		}
+		reasons = append(reasons, fmt.Sprintf("%d seeders >= %d", torrent.NumComplete, *sm.MinSeeders))
+	}
+	if sm.MaxSeeders != nil {
+		if torrent.NumComplete > *sm.MaxSeeders {
+			return false, ""
+		}
+		reasons = append(reasons, fmt.Sprintf("%d seeders <= %d", torrent.NumComplete, *sm.MaxSeeders))
+	}
+
+	if len(reasons) == 0 {
+		reasons = append(reasons, "always")
+	}
+	return true, strings.Join(reasons, ", ")
+}
+
+// needed report whether the action would change anything on torrent
+func (pa PolicyAction) needed(torrent *TorrentManagementInfo) bool {
+	switch pa.Kind {
+	case PolicyKeep:
+		return false
+	case PolicyPause:
+		return !isPausedState(torrent.State)
+	case PolicySetCategory:
+		return torrent.Category != pa.Category
+	case PolicyAddTags:
+		tags := SplitTags(torrent.Tags)
+		for _, it := range pa.Tags {
+			if !anyOf([]string{it}, tags) {
+				return true
+			}
+		}
+		return false
+	}
+	return true
+}
+
+// Evaluate return one decision per torrent matched by a rule whose action would change something,
+// hosts map torrent hashes to tracker hosts and may be nil when no rule match trackers
+func (sp *SeedingPolicy) Evaluate(torrents []*TorrentManagementInfo, hosts map[string]string) (decisions []PolicyDecision) {
+	for _, torrent := range torrents {
+		host := hosts[torrent.Hash]
+		if host == "" {
+			host = TrackerHost(torrent.Tracker)
+		}
+		for i, rule := range sp.Rules {
+			ok, reason := rule.Match.Match(torrent, host)
+			if !ok {
+				continue
+			}
+			if rule.Action.needed(torrent) {
+				name := rule.Name
+				if name == "" {
+					name = fmt.Sprintf("rule %d", i+1)
+				}
+				decisions = append(decisions, PolicyDecision{Hash: torrent.Hash, Name: torrent.Name, Rule: name, Action: rule.Action, Reason: reason})
+			}
+			break
+		}
+	}
+	return
+}
+
+// trackerHosts look up the tracker of torrents which are not announcing to a working tracker right now
+func (tm *TorrentManagement) trackerHosts(ctx context.Context, torrents []*TorrentManagementInfo) (hosts map[string]string, err error) {
+	hosts = map[string]string{}
+	for _, torrent := range torrents {
+		if torrent.Tracker != "" {
+			hosts[torrent.Hash] = TrackerHost(torrent.Tracker)
+			continue
+		}
+		var trackers []*TorrentManagementTracker
+		trackers, err = tm.Trackers(ctx, torrent.Hash)
+		if err != nil {
+			return
+		}
+		for _, it := range trackers {
+			// DHT, PeX and LSD are listed as ** [DHT] **
+			if host := TrackerHost(it.URL); host != "" {
+				hosts[torrent.Hash] = host
+				break
+			}
+		}
+	}
+	return
+}
+
+type SeedingPolicyOptions struct {
+	// DryRun only evaluate the policy
+	DryRun bool
+	// AuditLog receive one json line per decision
+	AuditLog io.Writer
+}
+
+type policyAuditEntry struct {
+	Time   time.Time `json:"time"`
+	Hash   string    `json:"hash"`
+	Name   string    `json:"name"`
+	Rule   string    `json:"rule"`
+	Action string    `json:"action"`
+	Reason string    `json:"reason"`
+	DryRun bool      `json:"dryRun"`
+	Error  string    `json:"error,omitempty"`
+}
+
+// ApplySeedingPolicy evaluate policy against every torrent and carry out the decisions,
+// torrents sharing the same action are changed with a single call
+func (tm *TorrentManagement) ApplySeedingPolicy(ctx context.Context, policy *SeedingPolicy, opts SeedingPolicyOptions) (decisions []PolicyDecision, err error) {
+	err = policy.Validate()
+	if err != nil {
+		return
+	}
+	torrents, err := tm.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		return
+	}
+	var hosts map[string]string
+	if policy.needTrackers() {
+		hosts, err = tm.trackerHosts(ctx, torrents)
+		if err != nil {
+			return
+		}
+	}
+	decisions = policy.Evaluate(torrents, hosts)
+
+	groups := map[string][]PolicyDecision{}
+	var keys []string
+	for _, it := range decisions {
+		key := it.Action.String()
+		if _, ok := groups[key]; !ok {
+			keys = append(keys, key)
+		}
+		groups[key] = append(groups[key], it)
+	}
+	sort.Strings(keys)
+
+	var errs []error
+	for _, key := range keys {
+		group := groups[key]
+		var applyErr error
+		if !opts.DryRun {
+			applyErr = tm.applyPolicyAction(ctx, group[0].Action, group)
+			if applyErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", key, applyErr))
+			}
+		}
+		if opts.AuditLog != nil {
+			writePolicyAudit(opts.AuditLog, group, opts.DryRun, applyErr)
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+func (tm *TorrentManagement) applyPolicyAction(ctx context.Context, action PolicyAction, group []PolicyDecision) error {
+	hashes := make([]string, len(group))
+	for i, it := range group {
+		hashes[i] = it.Hash
+	}
+	switch action.Kind {
+	case PolicyPause:
+		return tm.Pause(ctx, hashes, false)
+	case PolicyDelete:
+		return tm.Delete(ctx, hashes, false, false)
+	case PolicyDeleteFiles:
+		return tm.Delete(ctx, hashes, false, true)
+	case PolicySetCategory:
+		return tm.SetCategory(ctx, hashes, false, action.Category)
+	case PolicyAddTags:
+		return tm.AddTags(ctx, hashes, false, action.Tags)
+	}
+	return fmt.Errorf("unknown action %q", action.Kind)
+}
+
+func writePolicyAudit(w io.Writer, group []PolicyDecision, dryRun bool, err error) {
+	now := time.Now().UTC()
+	enc := json.NewEncoder(w)
+	for _, it := range group {
+		entry := policyAuditEntry{Time: now, Hash: it.Hash, Name: it.Name, Rule: it.Rule, Action: it.Action.String(), Reason: it.Reason, DryRun: dryRun}
+		if err != nil {
+			entry.Error = err.Error()
+		}
+		enc.Encode(entry)
+	}
+}
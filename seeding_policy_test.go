@@ -0,0 +1,180 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"encoding/json"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+const seedingPolicyYAML = `
+rules:
+  - name: keep tagged
+    match:
+      tags: [keep]
+      includeIncomplete: true
+    action:
+      kind: keep
+  - name: rare on private
+    match:
+      trackers: [private.example]
+      minRatio: 1
+      minSeedingTime: 72h
+      maxSeeders: 2
+    action:
+      kind: add_tags
+      tags: [rare]
+  - name: done on private
+    match:
+      trackers: [private.example]
+      minRatio: 1
+      minSeedingTime: 72h
+    action:
+      kind: delete
+  - name: public
+    match:
+      excludeTrackers: [private.example]
+      minRatio: 2
+      minSeedingTime: 24h
+      ratioOrTime: true
+    action:
+      kind: pause
+`
+
+func loadTestSeedingPolicy(t *testing.T) *SeedingPolicy {
+	path := filepath.Join(t.TempDir(), "policy.yaml")
+	err := os.WriteFile(path, []byte(seedingPolicyYAML), 0o644)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy, err := LoadSeedingPolicy(path)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return policy
+}
+
+const hour = 3600
+
+func TestSeedingPolicy_Evaluate(t *testing.T) {
+	policy := loadTestSeedingPolicy(t)
+	torrents := []*TorrentManagementInfo{
+		// goals reached with few seeders
+		{Hash: "a", Name: "rare", Tracker: "https://tracker.private.example/announce/key", Progress: 1, Ratio: 1.2, SeedingTime: 80 * hour, NumComplete: 2, State: InfoStateUploading},
+		// goals reached
+		{Hash: "b", Name: "done", Tracker: "https://tracker.private.example/announce/key", Progress: 1, Ratio: 1.2, SeedingTime: 80 * hour, NumComplete: 10, State: InfoStateUploading},
+		// ratio reached but not the time
+		{Hash: "c", Name: "young", Tracker: "https://tracker.private.example/announce/key", Progress: 1, Ratio: 3, SeedingTime: 10 * hour, NumComplete: 10, State: InfoStateUploading},
+		// tagged keep
+		{Hash: "d", Name: "kept", Tracker: "https://tracker.private.example/announce/key", Progress: 1, Ratio: 5, SeedingTime: 100 * hour, Tags: "keep, hd", State: InfoStateUploading},
+		// public, time reached only
+		{Hash: "e", Name: "public", Tracker: "udp://open.tracker:1337", Progress: 1, Ratio: 0.1, SeedingTime: 30 * hour, State: InfoStateUploading},
+		// public, already paused
+		{Hash: "f", Name: "paused", Tracker: "udp://open.tracker:1337", Progress: 1, Ratio: 3, State: InfoStatePausedUP},
+		// incomplete
+		{Hash: "g", Name: "downloading", Tracker: "udp://open.tracker:1337", Progress: 0.5, Ratio: 3, State: InfoStateDownloading},
+		// the tracker is only known from the hosts map
+		{Hash: "h", Name: "lookup", Progress: 1, Ratio: 1.2, SeedingTime: 80 * hour, NumComplete: 10, State: InfoStateStalledUP},
+	}
+	decisions := policy.Evaluate(torrents, map[string]string{"h": "private.example"})
+
+	var got []string
+	for _, it := range decisions {
+		got = append(got, it.Name+" "+it.Action.String()+" by "+it.Rule)
+	}
+	expected := []string{
+		"rare add_tags rare by rare on private",
+		"done delete by done on private",
+		"public pause by public",
+		"lookup delete by done on private",
+	}
+	if strings.Join(got, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected decisions\n%s", strings.Join(got, "\n"))
+	}
+	if decisions[0].Reason != "tracker tracker.private.example, ratio 1.20 >= 1.00, seeding 80h0m0s >= 72h0m0s, 2 seeders <= 2" {
+		t.Fatalf("unexpected reason %q", decisions[0].Reason)
+	}
+}
+
+func TestSeedingPolicy_Validate(t *testing.T) {
+	policy := &SeedingPolicy{Rules: []SeedingRule{
+		{Name: "a", Action: PolicyAction{Kind: PolicySetCategory}},
+		{Action: PolicyAction{Kind: "archive"}},
+	}}
+	err := policy.Validate()
+	if err == nil || !strings.Contains(err.Error(), "a: set_category needs a category") || !strings.Contains(err.Error(), `rule 2: unknown action "archive"`) {
+		t.Fatalf("unexpected error %v", err)
+	}
+}
+
+func TestTorrentManagement_ApplySeedingPolicy(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/torrents/info":
+			w.Write([]byte(`[
+				{"hash":"a","name":"one","tracker":"https://tracker.private.example/a","progress":1,"ratio":1.5,"seeding_time":300000,"num_complete":9,"state":"uploading"},
+				{"hash":"b","name":"two","tracker":"","progress":1,"ratio":1.5,"seeding_time":300000,"num_complete":9,"state":"stalledUP"},
+				{"hash":"c","name":"three","tracker":"https://tracker.private.example/a","progress":1,"ratio":1.5,"seeding_time":300000,"num_complete":1,"state":"uploading"}]`))
+		case "/api/v2/torrents/trackers":
+			w.Write([]byte(`[{"url":"** [DHT] **","status":0},{"url":"https://private.example/announce","status":4}]`))
+		default:
+			calls = append(calls, r.URL.Path[len("/api/v2/torrents/"):]+" "+r.Form.Encode())
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	policy := loadTestSeedingPolicy(t)
+
+	audit := &bytes.Buffer{}
+	decisions, err := client.TorrentManagement.ApplySeedingPolicy(context.Background(), policy, SeedingPolicyOptions{DryRun: true, AuditLog: audit})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(decisions) != 3 || len(calls) != 0 {
+		t.Fatalf("unexpected dry run %v %v", decisions, calls)
+	}
+	lines := strings.Split(strings.TrimSpace(audit.String()), "\n")
+	var entry policyAuditEntry
+	if len(lines) != 3 || json.Unmarshal([]byte(lines[0]), &entry) != nil || !entry.DryRun {
+		t.Fatalf("unexpected audit log %s", audit)
+	}
+
+	_, err = client.TorrentManagement.ApplySeedingPolicy(context.Background(), policy, SeedingPolicyOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(calls)
+	expected := []string{
+		"addTags hashes=c&tags=rare",
+		"delete deleteFiles=false&hashes=a%7Cb",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected calls\n%s", strings.Join(calls, "\n"))
+	}
+}
+
+func TestTorrentManagement_SeedingPolicyDryRun(t *testing.T) {
+	policy := &SeedingPolicy{Rules: []SeedingRule{{Name: "pause seeded", Match: SeedingMatch{MinRatio: new(float64)}, Action: PolicyAction{Kind: PolicyPause}}}}
+	decisions, err := api.TorrentManagement.ApplySeedingPolicy(context.Background(), policy, SeedingPolicyOptions{DryRun: true})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(decisions)
+}
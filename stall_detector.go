@@ -0,0 +1,304 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net/http"
+	"sort"
+	"sync"
+	"time"
+)
+
+const DefaultStallDetectorInterval = time.Minute
+const DefaultStalledAfter = time.Hour
+const DefaultStallStepInterval = 30 * time.Minute
+const DefaultStallGiveUpAfter = 72 * time.Hour
+const DefaultStallGiveUpTag = "stalled"
+
+type StallKind string
+
+const StallNoMetadata StallKind = "no_metadata"
+const StallTrackerError StallKind = "tracker_error"
+const StallNoSeeds StallKind = "no_seeds"
+const StallNoActivity StallKind = "no_activity"
+
+type StallStep string
+
+const StallReannounce StallStep = "reannounce"
+const StallAddTrackers StallStep = "add_trackers"
+const StallRecheck StallStep = "recheck"
+const StallBottomPriority StallStep = "bottom_priority"
+const StallTag StallStep = "tag"
+const StallDelete StallStep = "delete"
+
+// stallSteps is the escalation order, one step is taken every StepInterval and steps that do not apply are skipped
+var stallSteps = []StallStep{StallReannounce, StallAddTrackers, StallRecheck, StallBottomPriority}
+
+type StallDetectorOptions struct {
+	// StalledAfter is how long a torrent stays stalledDL or metaDL before the first step, default to DefaultStalledAfter
+	StalledAfter time.Duration
+	// StepInterval separate two remediation steps, default to DefaultStallStepInterval
+	StepInterval time.Duration
+	// PublicTrackers are added to stalled torrents that are not private, the step is skipped when empty
+	PublicTrackers []string
+	// GiveUpAfter is how long a torrent may stay stalled before it is tagged or deleted, default to DefaultStallGiveUpAfter.
+	// A torrent is only given up once every step was tried and the last one had StepInterval to work
+	GiveUpAfter time.Duration
+	// GiveUpTag default to DefaultStallGiveUpTag
+	GiveUpTag string
+	// Delete the torrent when giving up instead of tagging it
+	Delete      bool
+	DeleteFiles bool
+	// DryRun report the steps without taking them
+	DryRun bool
+	// Interval default to DefaultStallDetectorInterval
+	Interval time.Duration
+}
+
+// StallAction is a remediation step taken on a stalled torrent
+type StallAction struct {
+	Hash    string
+	Name    string
+	Kind    StallKind
+	Stalled time.Duration
+	Step    StallStep
+	Err     error
+}
+
+type stallState struct {
+	since time.Time
+	next  int
+	// lastStep is when the last step was taken, zero before the first one
+	lastStep time.Time
+	givenUp  bool
+}
+
+// StallDetector follow torrents stuck in stalledDL or metaDL and escalate remediation until they move again,
+// a torrent is stalled until it downloads, completes or is removed so rechecking does not restart the escalation
+type StallDetector struct {
+	api     *Api
+	opts    StallDetectorOptions
+	tracker *MainDataTracker
+	now     func() time.Time
+
+	mu     sync.Mutex
+	states map[string]*stallState
+}
+
+func (a *Api) NewStallDetector(opts StallDetectorOptions) *StallDetector {
+	if opts.StalledAfter <= 0 {
+		opts.StalledAfter = DefaultStalledAfter
+	}
+	if opts.StepInterval <= 0 {
+		opts.StepInterval = DefaultStallStepInterval
+	}
+	if opts.GiveUpAfter <= 0 {
+		opts.GiveUpAfter = DefaultStallGiveUpAfter
+	}
+	if opts.GiveUpTag == "" {
+		opts.GiveUpTag = DefaultStallGiveUpTag
+	}
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultStallDetectorInterval
+	}
+	return &StallDetector{
+		api:     a,
+		opts:    opts,
+		tracker: a.Sync.NewMainDataTracker(opts.Interval),
+		now:     time.Now,
+		states:  map[string]*stallState{},
+	}
+}
+
+func isStalledState(state TorrentManagementInfoState) bool {
+	return state == InfoStateStalledDL || state == InfoStateMetaDL
+}
+
+// ClassifyStall tell why a torrent is stalled from its state, swarm and trackers
+func ClassifyStall(torrent Torrent, trackers []*TorrentManagementTracker) StallKind {
+	if TorrentManagementInfoState(torrent.State) == InfoStateMetaDL {
+		return StallNoMetadata
+	}
+	announce, failing := 0, 0
+	for _, it := range trackers {
+		if !isAnnounceURL(it) {
+			continue
+		}
+		announce++
+		if TorrentManagementTrackerStatus(it.Status) == TrackerStatusContractedAndNotWorking {
+			failing++
+		}
+	}
+	if announce > 0 && failing == announce {
+		return StallTrackerError
+	}
+	if torrent.NumSeeds == 0 && torrent.Availability < 1 {
+		return StallNoSeeds
+	}
+	return StallNoActivity
+}
+
+// track update the stall states and return the hashes of stalled torrents
+func (sd *StallDetector) track(torrents map[string]Torrent, now time.Time) (stalled []string) {
+	for hash, torrent := range torrents {
+		state := TorrentManagementInfoState(torrent.State)
+		switch {
+		case isStalledState(state):
+			if _, ok := sd.states[hash]; !ok {
+				since := now
+				if torrent.LastActivity > 0 {
+					if last := time.Unix(int64(torrent.LastActivity), 0); last.Before(since) {
+						since = last
+					}
+				}
+				sd.states[hash] = &stallState{since: since}
+			}
+			stalled = append(stalled, hash)
+		case isCompleteTorrent(torrent), state == InfoStateDownloading, state == InfoStateForcedDL:
+			delete(sd.states, hash)
+		}
+	}
+	for hash := range sd.states {
+		if _, ok := torrents[hash]; !ok {
+			delete(sd.states, hash)
+		}
+	}
+	sort.Strings(stalled)
+	return
+}
+
+// Check update torrents and take the remediation steps that are due
+func (sd *StallDetector) Check(ctx context.Context) (actions []StallAction, err error) {
+	err = sd.tracker.Update(ctx)
+	if err != nil {
+		return
+	}
+	torrents := sd.tracker.Torrents()
+
+	sd.mu.Lock()
+	defer sd.mu.Unlock()
+
+	now := sd.now()
+	for _, hash := range sd.track(torrents, now) {
+		state := sd.states[hash]
+		torrent := torrents[hash]
+		// the stall may have started long before the torrent was first seen, the steps are still spaced
+		// by StepInterval from the moment they are taken
+		stalled := now.Sub(state.since)
+		if state.givenUp || stalled < sd.opts.StalledAfter {
+			continue
+		}
+		if !state.lastStep.IsZero() && now.Sub(state.lastStep) < sd.opts.StepInterval {
+			continue
+		}
+		if state.next >= len(stallSteps) && stalled < sd.opts.GiveUpAfter {
+			continue
+		}
+
+		var trackers []*TorrentManagementTracker
+		trackers, err = sd.api.TorrentManagement.Trackers(ctx, hash)
+		if err != nil {
+			return
+		}
+		action := StallAction{Hash: hash, Name: torrent.Name, Kind: ClassifyStall(torrent, trackers), Stalled: stalled.Truncate(time.Second)}
+		for state.next < len(stallSteps) && action.Step == "" {
+			action.Step = stallSteps[state.next]
+			state.next++
+			var skip bool
+			skip, err = sd.skipStep(ctx, action)
+			if err != nil {
+				return
+			}
+			if skip {
+				action.Step = ""
+			}
+		}
+		switch {
+		case action.Step != "":
+			state.lastStep = now
+		case stalled >= sd.opts.GiveUpAfter:
+			action.Step = StallTag
+			if sd.opts.Delete {
+				action.Step = StallDelete
+			}
+			state.givenUp = true
+		default:
+			continue
+		}
+		if !sd.opts.DryRun {
+			action.Err = sd.takeStep(ctx, hash, action.Step)
+		}
+		actions = append(actions, action)
+	}
+	return
+}
+
+// skipStep tell whether a step does not apply to the torrent
+func (sd *StallDetector) skipStep(ctx context.Context, action StallAction) (skip bool, err error) {
+	switch action.Step {
+	case StallAddTrackers:
+		if len(sd.opts.PublicTrackers) == 0 {
+			return true, nil
+		}
+		var properties *TorrentManagementProperties
+		properties, err = sd.api.TorrentManagement.Properties(ctx, action.Hash)
+		if err != nil {
+			return
+		}
+		return properties.IsPrivate, nil
+	case StallRecheck:
+		// there is nothing to check without metadata
+		return action.Kind == StallNoMetadata, nil
+	}
+	return false, nil
+}
+
+func (sd *StallDetector) takeStep(ctx context.Context, hash string, step StallStep) (err error) {
+	tm := sd.api.TorrentManagement
+	hashes := []string{hash}
+	switch step {
+	case StallReannounce:
+		return tm.Reannounce(ctx, hashes, false)
+	case StallAddTrackers:
+		return tm.AddTrackers(ctx, hash, sd.opts.PublicTrackers)
+	case StallRecheck:
+		return tm.Recheck(ctx, hashes, false)
+	case StallBottomPriority:
+		err = tm.BottomPriority(ctx, hashes, false)
+		var se *StatusError
+		if errors.As(err, &se) && se.StatusCode == http.StatusConflict {
+			// queueing is disabled
+			return nil
+		}
+		return
+	case StallTag:
+		return tm.AddTags(ctx, hashes, false, []string{sd.opts.GiveUpTag})
+	case StallDelete:
+		return tm.Delete(ctx, hashes, false, sd.opts.DeleteFiles)
+	}
+	return fmt.Errorf("unknown step %q", step)
+}
+
+// Run check every Interval until ctx is done or a check fails, onCheck may be nil
+func (sd *StallDetector) Run(ctx context.Context, onCheck func(actions []StallAction)) (err error) {
+	ticker := time.NewTicker(sd.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		var actions []StallAction
+		actions, err = sd.Check(ctx)
+		if err != nil {
+			return
+		}
+		if onCheck != nil {
+			onCheck(actions)
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
@@ -0,0 +1,189 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"sync"
+	"testing"
+	"time"
+)
+
+func TestClassifyStall(t *testing.T) {
+	failing := []*TorrentManagementTracker{
+		{URL: "** [DHT] **", Status: int(TrackerStatusContractedAndWorking)},
+		{URL: "https://tracker.example/announce", Status: int(TrackerStatusContractedAndNotWorking)},
+	}
+	working := []*TorrentManagementTracker{{URL: "https://tracker.example/announce", Status: int(TrackerStatusContractedAndWorking)}}
+	cases := []struct {
+		torrent  Torrent
+		trackers []*TorrentManagementTracker
+		expected StallKind
+	}{
+		{Torrent{State: "metaDL"}, failing, StallNoMetadata},
+		{Torrent{State: "stalledDL", NumSeeds: 3}, failing, StallTrackerError},
+		{Torrent{State: "stalledDL", Availability: 0.4}, working, StallNoSeeds},
+		{Torrent{State: "stalledDL", Availability: 1.2}, working, StallNoActivity},
+		{Torrent{State: "stalledDL"}, nil, StallNoSeeds},
+	}
+	for i, it := range cases {
+		if got := ClassifyStall(it.torrent, it.trackers); got != it.expected {
+			t.Errorf("case %d: got %s, want %s", i, got, it.expected)
+		}
+	}
+}
+
+func TestStallDetector_Check(t *testing.T) {
+	var mu sync.Mutex
+	var calls []string
+	sState := "stalledDL"
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/sync/maindata":
+			w.Write([]byte(`{"rid":1,"full_update":true,"torrents":{
+				"m":{"name":"magnet","state":"metaDL"},
+				"s":{"name":"seedless","state":"` + sState + `"},
+				"t":{"name":"private","state":"stalledDL","num_seeds":4}}}`))
+		case "/api/v2/torrents/trackers":
+			status := "2"
+			if r.Form.Get("hash") == "t" {
+				status = "4"
+			}
+			w.Write([]byte(`[{"url":"https://tracker.example/announce","status":` + status + `}]`))
+		case "/api/v2/torrents/properties":
+			w.Write([]byte(`{"is_private":` + boolString(r.Form.Get("hash") == "t") + `}`))
+		case "/api/v2/torrents/bottomPrio":
+			w.WriteHeader(http.StatusConflict)
+		default:
+			calls = append(calls, r.URL.Path[len("/api/v2/torrents/"):]+" "+r.Form.Get("hashes")+r.Form.Get("hash"))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	sd := client.NewStallDetector(StallDetectorOptions{
+		StalledAfter:   time.Hour,
+		StepInterval:   time.Hour,
+		GiveUpAfter:    10 * time.Hour,
+		PublicTrackers: []string{"udp://open.example:1337/announce"},
+	})
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	check := func(at time.Duration) []string {
+		sd.now = func() time.Time { return start.Add(at) }
+		actions, err := sd.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		var got []string
+		for _, it := range actions {
+			if it.Err != nil {
+				t.Fatalf("%s failed: %v", it.Step, it.Err)
+			}
+			got = append(got, it.Name+" "+string(it.Kind)+" "+string(it.Step))
+		}
+		return got
+	}
+
+	steps := []struct {
+		at       time.Duration
+		expected string
+	}{
+		{0, ""},
+		{time.Hour, "magnet no_metadata reannounce,seedless no_seeds reannounce,private tracker_error reannounce"},
+		{time.Hour + time.Minute, ""},
+		// trackers are not added to the private torrent, it goes on with the next step
+		{2 * time.Hour, "magnet no_metadata add_trackers,seedless no_seeds add_trackers,private tracker_error recheck"},
+		// a torrent without metadata has nothing to recheck
+		{3 * time.Hour, "magnet no_metadata bottom_priority,seedless no_seeds recheck,private tracker_error bottom_priority"},
+		{5 * time.Hour, ""},
+		{10 * time.Hour, "magnet no_metadata tag,private tracker_error tag"},
+		{11 * time.Hour, ""},
+	}
+	for _, it := range steps {
+		if it.at == 5*time.Hour {
+			// seedless found peers after the recheck
+			mu.Lock()
+			sState = "downloading"
+			mu.Unlock()
+		}
+		if got := strings.Join(check(it.at), ","); got != it.expected {
+			t.Fatalf("at %s got %q, want %q", it.at, got, it.expected)
+		}
+	}
+
+	expected := []string{
+		"reannounce m", "reannounce s", "reannounce t",
+		"addTrackers m", "addTrackers s", "recheck t",
+		"recheck s",
+		"addTags m", "addTags t",
+	}
+	if strings.Join(calls, ",") != strings.Join(expected, ",") {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+}
+
+func TestStallDetector_LongIdle(t *testing.T) {
+	start := time.Date(2024, 1, 1, 0, 0, 0, 0, time.UTC)
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/sync/maindata":
+			// idle for a week before the detector started
+			fmt.Fprintf(w, `{"rid":1,"full_update":true,"torrents":{"o":{"name":"old","state":"stalledDL","last_activity":%d}}}`, start.Add(-7*24*time.Hour).Unix())
+		case "/api/v2/torrents/trackers":
+			w.Write([]byte(`[]`))
+		case "/api/v2/torrents/properties":
+			w.Write([]byte(`{"is_private":false}`))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sd := client.NewStallDetector(StallDetectorOptions{
+		StepInterval:   30 * time.Minute,
+		PublicTrackers: []string{"udp://open.example:1337/announce"},
+		Delete:         true,
+		DryRun:         true,
+	})
+	var steps []string
+	for at := time.Duration(0); at <= 3*time.Hour; at += time.Minute {
+		sd.now = func() time.Time { return start.Add(at) }
+		actions, err := sd.Check(context.Background())
+		if err != nil {
+			t.Fatal(err)
+		}
+		for _, it := range actions {
+			steps = append(steps, fmt.Sprintf("%s %s", at, it.Step))
+		}
+	}
+	// every step gets StepInterval before the next one and deleting comes last
+	expected := "0s reannounce,30m0s add_trackers,1h0m0s recheck,1h30m0s bottom_priority,2h0m0s delete"
+	if strings.Join(steps, ",") != expected {
+		t.Fatalf("unexpected steps %v", steps)
+	}
+}
+
+func TestStallDetector_DryRun(t *testing.T) {
+	sd := api.NewStallDetector(StallDetectorOptions{DryRun: true, StalledAfter: time.Second})
+	_, err := sd.Check(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	time.Sleep(2 * time.Second)
+	actions, err := sd.Check(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(actions)
+}
@@ -0,0 +1,207 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"sort"
+	"time"
+)
+
+const DefaultStreamPollInterval = time.Second
+
+type StreamOptions struct {
+	// Priority of the streamed file, default to FilePriorityMax
+	Priority TorrentManagementFilePriority
+	// SkipOtherFiles stop downloading the other files, by default their priority is only lowered to normal
+	SkipOtherFiles bool
+}
+
+// PrepareStream enable sequential download and first and last piece priority, raise the priority of the file
+// and lower the others. Only what differs is changed so calling it again does nothing
+func (tm *TorrentManagement) PrepareStream(ctx context.Context, hash string, index int, opts StreamOptions) (err error) {
+	if opts.Priority == FilePriorityNotDownloaded {
+		opts.Priority = FilePriorityMax
+	}
+	infoList, err := tm.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll, Hashes: []string{hash}})
+	if err != nil {
+		return
+	}
+	if len(infoList) == 0 {
+		return fmt.Errorf("torrent %s not found", hash)
+	}
+	info := infoList[0]
+	// the toggles flip the flag, only call them when the flag is off
+	if !info.SeqDl {
+		err = tm.ToggleSequentialDownload(ctx, []string{hash}, false)
+		if err != nil {
+			return
+		}
+	}
+	if !info.FLPiecePrio {
+		err = tm.ToggleFirstLastPiecePriority(ctx, []string{hash}, false)
+		if err != nil {
+			return
+		}
+	}
+
+	files, err := tm.Files(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	priorities := map[int]TorrentManagementFilePriority{}
+	found := false
+	for _, file := range files {
+		switch {
+		case file.Index == index:
+			found = true
+			if file.Priority != opts.Priority {
+				priorities[file.Index] = opts.Priority
+			}
+		case opts.SkipOtherFiles:
+			if file.Priority != FilePriorityNotDownloaded {
+				priorities[file.Index] = FilePriorityNotDownloaded
+			}
+		case file.Priority > FilePriorityNormal:
+			priorities[file.Index] = FilePriorityNormal
+		}
+	}
+	if !found {
+		return fmt.Errorf("torrent %s has no file %d", hash, index)
+	}
+	if len(priorities) == 0 {
+		return
+	}
+	return tm.SetFilePriorities(ctx, hash, priorities)
+}
+
+type StreamStatus struct {
+	Hash  string
+	Index int
+	Name  string
+	Size  int64
+	// Available is the number of contiguous bytes downloaded from the start of the file
+	Available int64
+	// Target is the buffer asked for, at most Size
+	Target int64
+	Ready  bool
+	// LastPieceReady tell whether the end of the file, where some containers keep their index, is downloaded
+	LastPieceReady bool
+	DlSpeed        int64
+	// ETA until Target is available, zero when ready and negative when unknown
+	ETA time.Duration
+}
+
+// fileOffsets return where every file starts in the torrent in one pass over the files in index order,
+// files of v2 and hybrid torrents start on a piece boundary so the piece range wins when it disagrees
+// with the sizes. offsets follow the order of files
+func fileOffsets(files []*TorrentManagementFile, pieceSize int64) (offsets []int64) {
+	order := make([]int, len(files))
+	for i := range order {
+		order[i] = i
+	}
+	sort.SliceStable(order, func(i, j int) bool { return files[order[i]].Index < files[order[j]].Index })
+
+	offsets = make([]int64, len(files))
+	var next int64
+	for _, i := range order {
+		file := files[i]
+		offset := next
+		// an empty file has no piece of its own to align on
+		if pieceSize > 0 && file.Size > 0 && len(file.PieceRange) == 2 && offset/pieceSize != int64(file.PieceRange[0]) {
+			offset = int64(file.PieceRange[0]) * pieceSize
+		}
+		offsets[i] = offset
+		if file.Size > 0 {
+			next = offset + file.Size
+		}
+	}
+	return
+}
+
+// Stream compute the streaming status of a file from the piece map and the download speed
+func (pm *PieceMap) Stream(index int, target int64, dlSpeed int64) (status *StreamStatus, err error) {
+	var file *TorrentManagementFile
+	position := 0
+	for i, it := range pm.Files {
+		if it.Index == index {
+			file, position = it, i
+		}
+	}
+	if file == nil {
+		return nil, fmt.Errorf("no file %d", index)
+	}
+	if pm.PieceSize <= 0 {
+		return nil, errors.New("unknown piece size")
+	}
+	status = &StreamStatus{Index: index, Name: file.Name, Size: file.Size, Target: target, DlSpeed: dlSpeed}
+	if status.Target <= 0 || status.Target > file.Size {
+		status.Target = file.Size
+	}
+
+	offset := fileOffsets(pm.Files, pm.PieceSize)[position]
+	first := int(offset / pm.PieceSize)
+	if n := pm.ContiguousFrom(first); n > 0 {
+		status.Available = int64(first+n)*pm.PieceSize - offset
+	}
+	if status.Available > file.Size {
+		status.Available = file.Size
+	}
+	if file.Size > 0 {
+		last := int((offset + file.Size - 1) / pm.PieceSize)
+		status.LastPieceReady = last < len(pm.States) && pm.States[last] == PieceStateAlreadyDownloaded
+	}
+
+	status.Ready = status.Available >= status.Target
+	switch {
+	case status.Ready:
+	case dlSpeed > 0:
+		status.ETA = time.Duration(float64(status.Target-status.Available) / float64(dlSpeed) * float64(time.Second))
+	default:
+		status.ETA = -1
+	}
+	return
+}
+
+// StreamStatus report how much of a file can be played from its start, target is the buffer in bytes
+// and zero means the whole file
+func (tm *TorrentManagement) StreamStatus(ctx context.Context, hash string, index int, target int64) (status *StreamStatus, err error) {
+	infoList, err := tm.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll, Hashes: []string{hash}})
+	if err != nil {
+		return
+	}
+	if len(infoList) == 0 {
+		return nil, fmt.Errorf("torrent %s not found", hash)
+	}
+	pm, err := tm.PieceMap(ctx, hash)
+	if err != nil {
+		return
+	}
+	status, err = pm.Stream(index, target, int64(infoList[0].DlSpeed))
+	if err != nil {
+		return nil, fmt.Errorf("torrent %s: %w", hash, err)
+	}
+	status.Hash = hash
+	return
+}
+
+// WaitStream poll StreamStatus until the buffer is ready or ctx is done,
+// interval below or equal zero means DefaultStreamPollInterval
+func (tm *TorrentManagement) WaitStream(ctx context.Context, hash string, index int, target int64, interval time.Duration) (status *StreamStatus, err error) {
+	if interval <= 0 {
+		interval = DefaultStreamPollInterval
+	}
+	ticker := time.NewTicker(interval)
+	defer ticker.Stop()
+	for {
+		status, err = tm.StreamStatus(ctx, hash, index, target)
+		if err != nil || status.Ready {
+			return
+		}
+		select {
+		case <-ctx.Done():
+			return status, ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
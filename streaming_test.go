@@ -0,0 +1,106 @@
+package qbt_api
+
+import (
+	"context"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"strings"
+	"testing"
+	"time"
+)
+
+func TestPieceMap_Stream(t *testing.T) {
+	pm := testPieceMap()
+	status, err := pm.Stream(0, 300, 50)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if status.Available != 400 || status.Target != 300 || !status.Ready || status.ETA != 0 || status.LastPieceReady {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	// zero target is the whole file
+	status, _ = pm.Stream(0, 0, 50)
+	if status.Target != 450 || status.Ready || status.ETA != time.Second {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	// the first piece of b is shared with a and not downloaded yet
+	status, _ = pm.Stream(1, 100, 0)
+	if status.Available != 0 || status.ETA >= 0 {
+		t.Fatalf("unexpected status %+v", status)
+	}
+	if _, err = pm.Stream(5, 0, 0); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+
+	// padded layout, b starts on a piece boundary
+	states, _ := DecodePieceStates("5.3#4.", 12)
+	pm = &PieceMap{
+		States:    states,
+		PieceSize: 100,
+		Files: []*TorrentManagementFile{
+			{Index: 0, Name: "a", Size: 450, PieceRange: []int{0, 4}},
+			{Index: 1, Name: "b", Size: 650, PieceRange: []int{5, 11}},
+		},
+	}
+	status, _ = pm.Stream(1, 0, 0)
+	if status.Available != 300 || status.Size != 650 {
+		t.Fatalf("unexpected padded status %+v", status)
+	}
+}
+
+func TestTorrentManagement_PrepareStreamOffline(t *testing.T) {
+	var calls []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/torrents/info":
+			w.Write([]byte(`[{"hash":"hash","seq_dl":true,"f_l_piece_prio":false}]`))
+		case "/api/v2/torrents/files":
+			w.Write([]byte(`[{"index":0,"name":"a","priority":6},{"index":1,"name":"b","priority":1},{"index":2,"name":"c","priority":0}]`))
+		default:
+			r.ParseForm()
+			calls = append(calls, strings.TrimPrefix(r.URL.Path, "/api/v2/torrents/")+" "+r.PostForm.Get("id")+" "+r.PostForm.Get("priority"))
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	err = client.TorrentManagement.PrepareStream(context.Background(), "hash", 1, StreamOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := "[toggleFirstLastPiecePrio   filePrio 0 1 filePrio 1 7]"
+	if fmt.Sprint(calls) != expected {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	calls = nil
+	err = client.TorrentManagement.PrepareStream(context.Background(), "hash", 1, StreamOptions{SkipOtherFiles: true, Priority: FilePriorityNormal})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(calls) != "[toggleFirstLastPiecePrio   filePrio 0 0]" {
+		t.Fatalf("unexpected calls %v", calls)
+	}
+
+	if err = client.TorrentManagement.PrepareStream(context.Background(), "hash", 3, StreamOptions{}); err == nil {
+		t.Fatal("expected an error for a missing file")
+	}
+}
+
+func TestTorrentManagement_StreamStatus(t *testing.T) {
+	infoList, err := api.TorrentManagement.Info(context.Background(), TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, it := range infoList {
+		status, err := api.TorrentManagement.StreamStatus(context.Background(), it.Hash, 0, 16<<20)
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Printf("%s %d/%d ready %v eta %v\n", it.Name, status.Available, status.Target, status.Ready, status.ETA)
+	}
+}
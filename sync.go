@@ -55,54 +55,54 @@ type ServerState struct {
 }
 
 type Torrent struct {
-	AddedOn           int    `json:"added_on"`
-	AmountLeft        int64  `json:"amount_left"`
-	AutoTmm           bool   `json:"auto_tmm"`
-	Availability      int    `json:"availability"`
-	Category          string `json:"category"`
-	Completed         int    `json:"completed"`
-	CompletionOn      int    `json:"completion_on"`
-	ContentPath       string `json:"content_path"`
-	DlLimit           int    `json:"dl_limit"`
-	Dlspeed           int    `json:"dlspeed"`
-	DownloadPath      string `json:"download_path"`
-	Downloaded        int    `json:"downloaded"`
-	DownloadedSession int    `json:"downloaded_session"`
-	Eta               int    `json:"eta"`
-	FLPiecePrio       bool   `json:"f_l_piece_prio"`
-	ForceStart        bool   `json:"force_start"`
-	InfohashV1        string `json:"infohash_v1"`
-	InfohashV2        string `json:"infohash_v2"`
-	LastActivity      int    `json:"last_activity"`
-	MagnetURI         string `json:"magnet_uri"`
-	MaxRatio          int    `json:"max_ratio"`
-	MaxSeedingTime    int    `json:"max_seeding_time"`
-	Name              string `json:"name"`
-	NumComplete       int    `json:"num_complete"`
-	NumIncomplete     int    `json:"num_incomplete"`
-	NumLeechs         int    `json:"num_leechs"`
-	NumSeeds          int    `json:"num_seeds"`
-	Priority          int    `json:"priority"`
-	Progress          int    `json:"progress"`
-	Ratio             int    `json:"ratio"`
-	RatioLimit        int    `json:"ratio_limit"`
-	SavePath          string `json:"save_path"`
-	SeedingTime       int    `json:"seeding_time"`
-	SeedingTimeLimit  int    `json:"seeding_time_limit"`
-	SeenComplete      int    `json:"seen_complete"`
-	SeqDl             bool   `json:"seq_dl"`
-	Size              int64  `json:"size"`
-	State             string `json:"state"`
-	SuperSeeding      bool   `json:"super_seeding"`
-	Tags              string `json:"tags"`
-	TimeActive        int    `json:"time_active"`
-	TotalSize         int64  `json:"total_size"`
-	Tracker           string `json:"tracker"`
-	TrackersCount     int    `json:"trackers_count"`
-	UpLimit           int    `json:"up_limit"`
-	Uploaded          int    `json:"uploaded"`
-	UploadedSession   int    `json:"uploaded_session"`
-	Upspeed           int    `json:"upspeed"`
+	AddedOn           int     `json:"added_on"`
+	AmountLeft        int64   `json:"amount_left"`
+	AutoTmm           bool    `json:"auto_tmm"`
+	Availability      float64 `json:"availability"`
+	Category          string  `json:"category"`
+	Completed         int     `json:"completed"`
+	CompletionOn      int     `json:"completion_on"`
+	ContentPath       string  `json:"content_path"`
+	DlLimit           int     `json:"dl_limit"`
+	Dlspeed           int     `json:"dlspeed"`
+	DownloadPath      string  `json:"download_path"`
+	Downloaded        int     `json:"downloaded"`
+	DownloadedSession int     `json:"downloaded_session"`
+	Eta               int     `json:"eta"`
+	FLPiecePrio       bool    `json:"f_l_piece_prio"`
+	ForceStart        bool    `json:"force_start"`
+	InfohashV1        string  `json:"infohash_v1"`
+	InfohashV2        string  `json:"infohash_v2"`
+	LastActivity      int     `json:"last_activity"`
+	MagnetURI         string  `json:"magnet_uri"`
+	MaxRatio          float64 `json:"max_ratio"`
+	MaxSeedingTime    int     `json:"max_seeding_time"`
+	Name              string  `json:"name"`
+	NumComplete       int     `json:"num_complete"`
+	NumIncomplete     int     `json:"num_incomplete"`
+	NumLeechs         int     `json:"num_leechs"`
+	NumSeeds          int     `json:"num_seeds"`
+	Priority          int     `json:"priority"`
+	Progress          float64 `json:"progress"`
+	Ratio             float64 `json:"ratio"`
+	RatioLimit        float64 `json:"ratio_limit"`
+	SavePath          string  `json:"save_path"`
+	SeedingTime       int     `json:"seeding_time"`
+	SeedingTimeLimit  int     `json:"seeding_time_limit"`
+	SeenComplete      int     `json:"seen_complete"`
+	SeqDl             bool    `json:"seq_dl"`
+	Size              int64   `json:"size"`
+	State             string  `json:"state"`
+	SuperSeeding      bool    `json:"super_seeding"`
+	Tags              string  `json:"tags"`
+	TimeActive        int     `json:"time_active"`
+	TotalSize         int64   `json:"total_size"`
+	Tracker           string  `json:"tracker"`
+	TrackersCount     int     `json:"trackers_count"`
+	UpLimit           int     `json:"up_limit"`
+	Uploaded          int     `json:"uploaded"`
+	UploadedSession   int     `json:"uploaded_session"`
+	Upspeed           int     `json:"upspeed"`
 }
 
 func (s *Sync) MainData(ctx context.Context, rid int64) (mainData *MainDataResponse, err error) {
@@ -118,29 +118,30 @@ func (s *Sync) MainData(ctx context.Context, rid int64) (mainData *MainDataRespo
 }
 
 type TorrentPeersResponse struct {
-	FullUpdate bool            `json:"full_update"`
-	Peers      map[string]Peer `json:"peers"`
-	Rid        int             `json:"rid"`
-	ShowFlags  bool            `json:"show_flags"`
+	FullUpdate   bool            `json:"full_update"`
+	Peers        map[string]Peer `json:"peers"`
+	PeersRemoved []string        `json:"peers_removed"`
+	Rid          int64           `json:"rid"`
+	ShowFlags    bool            `json:"show_flags"`
 }
 
 type Peer struct {
-	Client       string `json:"client"`
-	Connection   string `json:"connection"`
-	Country      string `json:"country"`
-	CountryCode  string `json:"country_code"`
-	DlSpeed      int    `json:"dl_speed"`
-	Downloaded   int    `json:"downloaded"`
-	Files        string `json:"files"`
-	Flags        string `json:"flags"`
-	FlagsDesc    string `json:"flags_desc"`
-	IP           string `json:"ip"`
-	PeerIDClient string `json:"peer_id_client"`
-	Port         int    `json:"port"`
-	Progress     int    `json:"progress"`
-	Relevance    int    `json:"relevance"`
-	UpSpeed      int    `json:"up_speed"`
-	Uploaded     int    `json:"uploaded"`
+	Client       string  `json:"client"`
+	Connection   string  `json:"connection"`
+	Country      string  `json:"country"`
+	CountryCode  string  `json:"country_code"`
+	DlSpeed      int     `json:"dl_speed"`
+	Downloaded   int     `json:"downloaded"`
+	Files        string  `json:"files"`
+	Flags        string  `json:"flags"`
+	FlagsDesc    string  `json:"flags_desc"`
+	IP           string  `json:"ip"`
+	PeerIDClient string  `json:"peer_id_client"`
+	Port         int     `json:"port"`
+	Progress     float64 `json:"progress"`
+	Relevance    float64 `json:"relevance"`
+	UpSpeed      int     `json:"up_speed"`
+	Uploaded     int     `json:"uploaded"`
 }
 
 func (s *Sync) TorrentPeers(ctx context.Context, hash string, rid int64) (torrentPeersResponse *TorrentPeersResponse, err error) {
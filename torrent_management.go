@@ -9,6 +9,7 @@ import (
 	"net/url"
 	"os"
 	"path/filepath"
+	"sort"
 	"strconv"
 	"strings"
 )
@@ -67,7 +68,7 @@ type TorrentManagementInfo struct {
 	AddedOn           int                        `json:"added_on"`
 	AmountLeft        int                        `json:"amount_left"`
 	AutoTmm           bool                       `json:"auto_tmm"`
-	Availability      int                        `json:"availability"`
+	Availability      float64                    `json:"availability"`
 	Category          string                     `json:"category"`
 	Completed         int64                      `json:"completed"`
 	CompletionOn      int                        `json:"completion_on"`
@@ -85,7 +86,7 @@ type TorrentManagementInfo struct {
 	InfohashV2        string                     `json:"infohash_v2"`
 	LastActivity      int                        `json:"last_activity"`
 	MagnetURI         string                     `json:"magnet_uri"`
-	MaxRatio          int                        `json:"max_ratio"`
+	MaxRatio          float64                    `json:"max_ratio"`
 	MaxSeedingTime    int                        `json:"max_seeding_time"`
 	Name              string                     `json:"name"`
 	NumComplete       int                        `json:"num_complete"`
@@ -93,17 +94,17 @@ type TorrentManagementInfo struct {
 	NumLeechs         int                        `json:"num_leechs"`
 	NumSeeds          int                        `json:"num_seeds"`
 	Priority          int                        `json:"priority"`
-	Progress          int                        `json:"progress"`
+	Progress          float64                    `json:"progress"`
 	Ratio             float64                    `json:"ratio"`
-	RatioLimit        int                        `json:"ratio_limit"`
+	RatioLimit        float64                    `json:"ratio_limit"`
 	SavePath          string                     `json:"save_path"`
 	SeedingTime       int                        `json:"seeding_time"`
 	SeedingTimeLimit  int                        `json:"seeding_time_limit"`
 	SeenComplete      int                        `json:"seen_complete"`
 	SeqDl             bool                       `json:"seq_dl"`
-	Size         int64                      `json:"size"`
-	State        TorrentManagementInfoState `json:"state"`
-	SuperSeeding bool                       `json:"super_seeding"`
+	Size              int64                      `json:"size"`
+	State             TorrentManagementInfoState `json:"state"`
+	SuperSeeding      bool                       `json:"super_seeding"`
 	Tags              string                     `json:"tags"`
 	TimeActive        int                        `json:"time_active"`
 	TotalSize         int64                      `json:"total_size"`
@@ -254,14 +255,14 @@ const FilePriorityHigh TorrentManagementFilePriority = 6
 const FilePriorityMax TorrentManagementFilePriority = 7
 
 type TorrentManagementFile struct {
-	Availability int                           `json:"availability"`
+	Availability float64                       `json:"availability"`
 	Index        int                           `json:"index"`
 	IsSeed       bool                          `json:"is_seed,omitempty"`
 	Name         string                        `json:"name"`
-	PieceRange []int                         `json:"piece_range"`
-	Priority   TorrentManagementFilePriority `json:"priority"`
-	Progress   int                           `json:"progress"`
-	Size         int                           `json:"size"`
+	PieceRange   []int                         `json:"piece_range"`
+	Priority     TorrentManagementFilePriority `json:"priority"`
+	Progress     float64                       `json:"progress"`
+	Size         int64                         `json:"size"`
 }
 
 func (tm *TorrentManagement) Files(ctx context.Context, hash string, indexes []int) (fileList []*TorrentManagementFile, err error) {
@@ -325,6 +326,22 @@ func joinHashes(hashes []string, all bool) string {
 	return strings.Join(hashes, "|")
 }
 
+// Export return the .torrent file content of a torrent
+func (tm *TorrentManagement) Export(ctx context.Context, hash string) (content []byte, err error) {
+	path := "/api/v2/torrents/export"
+
+	query := url.Values{}
+	query.Set("hash", hash)
+
+	var respText string
+	err = tm.api.doRequest(ctx, http.MethodGet, path, query, nil, &respText)
+	if err != nil {
+		return
+	}
+	content = []byte(respText)
+	return
+}
+
 func (tm *TorrentManagement) Pause(ctx context.Context, hashes []string, all bool) (err error) {
 	path := "/api/v2/torrents/pause"
 
@@ -441,10 +458,6 @@ func (tm *TorrentManagement) Add(ctx context.Context, opts TorrentManagementAddO
 			}
 			f.Close()
 		}
-		err = writer.Close()
-		if err != nil {
-			return
-		}
 	}
 
 	if opts.SavePath != nil {
@@ -512,7 +525,7 @@ func (tm *TorrentManagement) Add(ctx context.Context, opts TorrentManagementAddO
 	}
 
 	if opts.RatioLimit != nil {
-		err = writer.WriteField("ratioLimit", strconv.FormatFloat(*opts.RatioLimit, 'f', 0, 64))
+		err = writer.WriteField("ratioLimit", strconv.FormatFloat(*opts.RatioLimit, 'f', -1, 64))
 		if err != nil {
 			return
 		}
@@ -539,6 +552,11 @@ func (tm *TorrentManagement) Add(ctx context.Context, opts TorrentManagementAddO
 		return
 	}
 
+	err = writer.Close()
+	if err != nil {
+		return
+	}
+
 	err = tm.api.doRequestWithMultiPartForm(ctx, http.MethodPost, path, writer.FormDataContentType(), nil, body, emptyResponse)
 	if err != nil {
 		return
@@ -681,6 +699,30 @@ func (tm *TorrentManagement) SetFilePriority(ctx context.Context, hash string, i
 	return
 }
 
+// SetFilePriorities group files by priority and send one filePrio call per priority
+func (tm *TorrentManagement) SetFilePriorities(ctx context.Context, hash string, priorities map[int]TorrentManagementFilePriority) (err error) {
+	groups := map[TorrentManagementFilePriority][]int{}
+	for index, priority := range priorities {
+		groups[priority] = append(groups[priority], index)
+	}
+
+	var keys []TorrentManagementFilePriority
+	for priority := range groups {
+		keys = append(keys, priority)
+	}
+	sort.Slice(keys, func(i, j int) bool { return keys[i] < keys[j] })
+
+	for _, priority := range keys {
+		ids := groups[priority]
+		sort.Ints(ids)
+		err = tm.SetFilePriority(ctx, hash, ids, priority)
+		if err != nil {
+			return
+		}
+	}
+	return
+}
+
 type DownloadLimitResponse map[string]int
 
 func (tm *TorrentManagement) DownloadLimit(ctx context.Context, hashes []string, all bool) (downloadLimitResponse DownloadLimitResponse, err error) {
@@ -718,7 +760,7 @@ func (tm *TorrentManagement) SetShareLimits(ctx context.Context, hashes []string
 
 	formData := url.Values{}
 	formData.Set("hashes", joinHashes(hashes, all))
-	formData.Set("ratioLimit", strconv.FormatFloat(ratioLimit, 'f', 0, 64))
+	formData.Set("ratioLimit", strconv.FormatFloat(ratioLimit, 'f', -1, 64))
 	formData.Set("seedingTimeLimit", strconv.FormatInt(seedingTimeLimit, 10))
 
 	err = tm.api.doRequest(ctx, http.MethodPost, path, nil, formData, emptyResponse)
@@ -880,6 +922,16 @@ func (tm *TorrentManagement) RemoveTags(ctx context.Context, hashes []string, al
 	return
 }
 
+func (tm *TorrentManagement) Tags(ctx context.Context) (tags []string, err error) {
+	path := "/api/v2/torrents/tags"
+
+	err = tm.api.doRequest(ctx, http.MethodGet, path, nil, nil, &tags)
+	if err != nil {
+		return
+	}
+	return
+}
+
 func (tm *TorrentManagement) CreateTags(ctx context.Context, tags []string) (err error) {
 	path := "/api/v2/torrents/createTags"
 
@@ -362,6 +362,14 @@ func TestTorrentManagement_RemoveTags(t *testing.T) {
 	}
 }
 
+func TestTorrentManagement_Tags(t *testing.T) {
+	var tags, err = api.TorrentManagement.Tags(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(tags)
+}
+
 func TestTorrentManagement_CreateTags(t *testing.T) {
 	var tags = []string{
 		"111", "222",
@@ -0,0 +1,292 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"net"
+	"net/url"
+	"sort"
+	"strings"
+)
+
+// TrackerChange list the announce urls removed from and added to a torrent,
+// an edited url shows up in both
+type TrackerChange struct {
+	Hash    string
+	Name    string
+	Removed []string
+	Added   []string
+}
+
+// ReplaceTrackerHost return announce with its host replaced by newHost, keeping path and passkey,
+// the port is kept unless newHost has its own. ok is false when announce is not on oldHost
+func ReplaceTrackerHost(announce, oldHost, newHost string) (replaced string, ok bool) {
+	u, err := url.Parse(announce)
+	if err != nil || TrackerHost(announce) != TrackerHost("//"+oldHost) {
+		return
+	}
+	host, port, err := net.SplitHostPort(newHost)
+	if err != nil {
+		host, port = strings.Trim(newHost, "[]"), u.Port()
+	}
+	if port != "" {
+		u.Host = net.JoinHostPort(host, port)
+	} else if strings.Contains(host, ":") {
+		u.Host = "[" + host + "]"
+	} else {
+		u.Host = host
+	}
+	return u.String(), true
+}
+
+// isAnnounceURL filter out the ** [DHT] **, ** [PeX] ** and ** [LSD] ** entries
+func isAnnounceURL(tracker *TorrentManagementTracker) bool {
+	return TrackerHost(tracker.URL) != ""
+}
+
+// allTrackers list every torrent with its announce urls
+func (tm *TorrentManagement) allTrackers(ctx context.Context) (torrents []*TorrentManagementInfo, trackers map[string][]*TorrentManagementTracker, err error) {
+	torrents, err = tm.Info(ctx, TorrentManagementInfoOptions{Filter: FilterAll})
+	if err != nil {
+		return
+	}
+	sort.Slice(torrents, func(i, j int) bool { return torrents[i].Name < torrents[j].Name })
+	trackers = map[string][]*TorrentManagementTracker{}
+	for _, torrent := range torrents {
+		var list []*TorrentManagementTracker
+		list, err = tm.Trackers(ctx, torrent.Hash)
+		if err != nil {
+			err = fmt.Errorf("trackers of %s: %w", torrent.Hash, err)
+			return
+		}
+		for _, it := range list {
+			if isAnnounceURL(it) {
+				trackers[torrent.Hash] = append(trackers[torrent.Hash], it)
+			}
+		}
+	}
+	return
+}
+
+// ReplaceTrackerHosts move every announce url on oldHost to newHost across all torrents,
+// when the new url is already present the old one is removed instead
+func (tm *TorrentManagement) ReplaceTrackerHosts(ctx context.Context, oldHost, newHost string, dryRun bool) (changes []TrackerChange, err error) {
+	torrents, trackers, err := tm.allTrackers(ctx)
+	if err != nil {
+		return
+	}
+	var errs []error
+	for _, torrent := range torrents {
+		existing := map[string]bool{}
+		for _, it := range trackers[torrent.Hash] {
+			existing[it.URL] = true
+		}
+		change := TrackerChange{Hash: torrent.Hash, Name: torrent.Name}
+		var duplicates []string
+		for _, it := range trackers[torrent.Hash] {
+			newURL, ok := ReplaceTrackerHost(it.URL, oldHost, newHost)
+			if !ok || newURL == it.URL {
+				continue
+			}
+			change.Removed = append(change.Removed, it.URL)
+			if existing[newURL] {
+				duplicates = append(duplicates, it.URL)
+				continue
+			}
+			existing[newURL] = true
+			change.Added = append(change.Added, newURL)
+			if !dryRun {
+				editErr := tm.EditTracker(ctx, torrent.Hash, it.URL, newURL)
+				if editErr != nil {
+					errs = append(errs, fmt.Errorf("%s: %w", torrent.Hash, editErr))
+				}
+			}
+		}
+		if len(duplicates) > 0 && !dryRun {
+			removeErr := tm.RemoveTrackers(ctx, torrent.Hash, duplicates)
+			if removeErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", torrent.Hash, removeErr))
+			}
+		}
+		if len(change.Removed) > 0 {
+			changes = append(changes, change)
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// AddPublicTrackers add the missing urls to every torrent that is not private,
+// private torrents are detected with Properties.IsPrivate and left untouched
+func (tm *TorrentManagement) AddPublicTrackers(ctx context.Context, urls []string, dryRun bool) (changes []TrackerChange, err error) {
+	torrents, trackers, err := tm.allTrackers(ctx)
+	if err != nil {
+		return
+	}
+	var errs []error
+	for _, torrent := range torrents {
+		var properties *TorrentManagementProperties
+		properties, err = tm.Properties(ctx, torrent.Hash)
+		if err != nil {
+			err = fmt.Errorf("properties of %s: %w", torrent.Hash, err)
+			return
+		}
+		if properties.IsPrivate {
+			continue
+		}
+		existing := map[string]bool{}
+		for _, it := range trackers[torrent.Hash] {
+			existing[it.URL] = true
+		}
+		change := TrackerChange{Hash: torrent.Hash, Name: torrent.Name}
+		for _, it := range urls {
+			if !existing[it] {
+				existing[it] = true
+				change.Added = append(change.Added, it)
+			}
+		}
+		if len(change.Added) == 0 {
+			continue
+		}
+		changes = append(changes, change)
+		if !dryRun {
+			addErr := tm.AddTrackers(ctx, torrent.Hash, change.Added)
+			if addErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", torrent.Hash, addErr))
+			}
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
+
+// TrackerHealth summarize the status of a tracker host across the torrents announcing to it
+type TrackerHealth struct {
+	Host         string
+	Torrents     int
+	Working      int
+	NotWorking   int
+	NotContacted int
+	Updating     int
+	Disabled     int
+	// Messages count the tracker messages of the torrents where it is not working
+	Messages map[string]int
+	// Urls map torrent hashes to their announce urls on this host
+	Urls map[string][]string
+}
+
+// Dead report whether the host is contacted and not working for every torrent
+func (th *TrackerHealth) Dead() bool {
+	return th.Torrents > 0 && th.NotWorking == th.Torrents
+}
+
+// trackerHealth group trackers by host, a torrent with several urls on a host count as working
+// if any of them works
+func trackerHealth(trackers map[string][]*TorrentManagementTracker) (report []*TrackerHealth) {
+	hosts := map[string]*TrackerHealth{}
+	for hash, list := range trackers {
+		byHost := map[string][]*TorrentManagementTracker{}
+		for _, it := range list {
+			host := TrackerHost(it.URL)
+			byHost[host] = append(byHost[host], it)
+		}
+		for host, list := range byHost {
+			health, ok := hosts[host]
+			if !ok {
+				health = &TrackerHealth{Host: host, Messages: map[string]int{}, Urls: map[string][]string{}}
+				hosts[host] = health
+			}
+			health.Torrents++
+			status := TrackerStatusDisabled
+			for _, it := range list {
+				health.Urls[hash] = append(health.Urls[hash], it.URL)
+				if s := TorrentManagementTrackerStatus(it.Status); trackerStatusRank(s) > trackerStatusRank(status) {
+					status = s
+				}
+			}
+			switch status {
+			case TrackerStatusContractedAndWorking:
+				health.Working++
+			case TrackerStatusContractedAndNotWorking:
+				health.NotWorking++
+				for _, it := range list {
+					if it.Msg != "" {
+						health.Messages[it.Msg]++
+					}
+				}
+			case TrackerStatusNotContacted:
+				health.NotContacted++
+			case TrackerStatusUpdating:
+				health.Updating++
+			default:
+				health.Disabled++
+			}
+		}
+	}
+	for _, it := range hosts {
+		report = append(report, it)
+	}
+	sort.Slice(report, func(i, j int) bool { return report[i].Host < report[j].Host })
+	return
+}
+
+// trackerStatusRank order statuses from the least to the most conclusive
+func trackerStatusRank(status TorrentManagementTrackerStatus) int {
+	switch status {
+	case TrackerStatusContractedAndWorking:
+		return 4
+	case TrackerStatusUpdating:
+		return 3
+	case TrackerStatusNotContacted:
+		return 2
+	case TrackerStatusContractedAndNotWorking:
+		return 1
+	}
+	return 0
+}
+
+// TrackerHealth report the status of every tracker host sorted by host
+func (tm *TorrentManagement) TrackerHealth(ctx context.Context) (report []*TrackerHealth, err error) {
+	_, trackers, err := tm.allTrackers(ctx)
+	if err != nil {
+		return
+	}
+	report = trackerHealth(trackers)
+	return
+}
+
+// RemoveDeadTrackers remove the urls of every host that is not working for any torrent
+func (tm *TorrentManagement) RemoveDeadTrackers(ctx context.Context, dryRun bool) (changes []TrackerChange, err error) {
+	torrents, trackers, err := tm.allTrackers(ctx)
+	if err != nil {
+		return
+	}
+	removed := map[string][]string{}
+	for _, health := range trackerHealth(trackers) {
+		if !health.Dead() {
+			continue
+		}
+		for hash, urls := range health.Urls {
+			removed[hash] = append(removed[hash], urls...)
+		}
+	}
+
+	var errs []error
+	for _, torrent := range torrents {
+		urls := removed[torrent.Hash]
+		if len(urls) == 0 {
+			continue
+		}
+		sort.Strings(urls)
+		changes = append(changes, TrackerChange{Hash: torrent.Hash, Name: torrent.Name, Removed: urls})
+		if !dryRun {
+			removeErr := tm.RemoveTrackers(ctx, torrent.Hash, urls)
+			if removeErr != nil {
+				errs = append(errs, fmt.Errorf("%s: %w", torrent.Hash, removeErr))
+			}
+		}
+	}
+	err = errors.Join(errs...)
+	return
+}
@@ -0,0 +1,187 @@
+package qbt_api
+
+import (
+	"context"
+	"github.com/davecgh/go-spew/spew"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"sort"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestReplaceTrackerHost(t *testing.T) {
+	cases := []struct {
+		announce string
+		expected string
+		ok       bool
+	}{
+		{"https://old.example/announce/key", "https://new.example/announce/key", true},
+		{"udp://OLD.example:1337/announce", "udp://new.example:1337/announce", true},
+		{"https://tracker.old.example/announce", "", false},
+		{"** [DHT] **", "", false},
+	}
+	for _, it := range cases {
+		got, ok := ReplaceTrackerHost(it.announce, "old.example", "new.example")
+		if got != it.expected || ok != it.ok {
+			t.Errorf("ReplaceTrackerHost(%s) = %q %v", it.announce, got, ok)
+		}
+	}
+
+	// a port in the new host replaces the announce port
+	hosts := []struct {
+		newHost  string
+		expected string
+	}{
+		{"new.example:8443", "udp://new.example:8443/announce"},
+		{"new.example", "udp://new.example:1337/announce"},
+		{"[2001:db8::1]:8443", "udp://[2001:db8::1]:8443/announce"},
+		{"2001:db8::1", "udp://[2001:db8::1]:1337/announce"},
+	}
+	for _, it := range hosts {
+		got, _ := ReplaceTrackerHost("udp://old.example:1337/announce", "old.example", it.newHost)
+		if got != it.expected {
+			t.Errorf("ReplaceTrackerHost(%s) = %q", it.newHost, got)
+		}
+	}
+	if got, _ := ReplaceTrackerHost("https://old.example/announce", "old.example", "2001:db8::1"); got != "https://[2001:db8::1]/announce" {
+		t.Errorf("unexpected ipv6 host %q", got)
+	}
+}
+
+func newTrackerServer(t *testing.T, calls *[]string) *Api {
+	var mu sync.Mutex
+	trackers := map[string]string{
+		"a": `[{"url":"** [DHT] **","status":2},
+			{"url":"https://old.example/announce","status":4,"msg":"unregistered"},
+			{"url":"udp://open.example:1337/announce","status":2}]`,
+		"b": `[{"url":"https://old.example/announce","status":4,"msg":"unregistered"},
+			{"url":"https://new.example/announce","status":2},
+			{"url":"udp://dead.example:80/announce","status":4,"msg":"timed out"}]`,
+		"c": `[{"url":"https://private.example/key","status":2},
+			{"url":"udp://dead.example:80/announce","status":4,"msg":"timed out"},
+			{"url":"udp://open.example:1337/announce","status":4,"msg":"timed out"}]`,
+	}
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		r.ParseForm()
+		mu.Lock()
+		defer mu.Unlock()
+		switch r.URL.Path {
+		case "/api/v2/torrents/info":
+			w.Write([]byte(`[{"hash":"a","name":"one"},{"hash":"b","name":"two"},{"hash":"c","name":"three"}]`))
+		case "/api/v2/torrents/trackers":
+			w.Write([]byte(trackers[r.Form.Get("hash")]))
+		case "/api/v2/torrents/properties":
+			w.Write([]byte(`{"is_private":` + boolString(r.Form.Get("hash") == "c") + `}`))
+		default:
+			*calls = append(*calls, r.URL.Path[len("/api/v2/torrents/"):]+" "+r.Form.Encode())
+		}
+	}))
+	t.Cleanup(srv.Close)
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	return client
+}
+
+func boolString(b bool) string {
+	if b {
+		return "true"
+	}
+	return "false"
+}
+
+func TestTorrentManagement_ReplaceTrackerHosts(t *testing.T) {
+	var calls []string
+	client := newTrackerServer(t, &calls)
+
+	changes, err := client.TorrentManagement.ReplaceTrackerHosts(context.Background(), "old.example", "new.example", false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || len(changes[0].Added) != 1 || len(changes[1].Added) != 0 {
+		t.Fatalf("unexpected changes %+v", changes)
+	}
+	expected := []string{
+		"editTracker hash=a&newUrl=https%3A%2F%2Fnew.example%2Fannounce&origUrl=https%3A%2F%2Fold.example%2Fannounce",
+		// b already announce to the new host
+		"removeTrackers hash=b&urls=https%3A%2F%2Fold.example%2Fannounce",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected calls\n%s", strings.Join(calls, "\n"))
+	}
+}
+
+func TestTorrentManagement_AddPublicTrackers(t *testing.T) {
+	var calls []string
+	client := newTrackerServer(t, &calls)
+
+	urls := []string{"udp://open.example:1337/announce", "udp://extra.example:6969/announce"}
+	changes, err := client.TorrentManagement.AddPublicTrackers(context.Background(), urls, true)
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(changes) != 2 || len(changes[0].Added) != 1 || len(changes[1].Added) != 2 || len(calls) != 0 {
+		t.Fatalf("unexpected dry run %+v %v", changes, calls)
+	}
+
+	_, err = client.TorrentManagement.AddPublicTrackers(context.Background(), urls, false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	expected := []string{
+		"addTrackers hash=a&urls=udp%3A%2F%2Fextra.example%3A6969%2Fannounce",
+		"addTrackers hash=b&urls=udp%3A%2F%2Fopen.example%3A1337%2Fannounce%0Audp%3A%2F%2Fextra.example%3A6969%2Fannounce",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected calls\n%s", strings.Join(calls, "\n"))
+	}
+}
+
+func TestTorrentManagement_RemoveDeadTrackers(t *testing.T) {
+	var calls []string
+	client := newTrackerServer(t, &calls)
+
+	report, err := client.TorrentManagement.TrackerHealth(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	var dead []string
+	for _, it := range report {
+		if it.Dead() {
+			dead = append(dead, it.Host)
+		}
+	}
+	// open.example is only failing for one torrent
+	if strings.Join(dead, ",") != "dead.example,old.example" {
+		t.Fatalf("unexpected dead hosts %v", dead)
+	}
+	if report[0].Host != "dead.example" || report[0].Messages["timed out"] != 2 {
+		t.Fatalf("unexpected messages %+v", report[0])
+	}
+
+	_, err = client.TorrentManagement.RemoveDeadTrackers(context.Background(), false)
+	if err != nil {
+		t.Fatal(err)
+	}
+	sort.Strings(calls)
+	expected := []string{
+		"removeTrackers hash=a&urls=https%3A%2F%2Fold.example%2Fannounce",
+		"removeTrackers hash=b&urls=https%3A%2F%2Fold.example%2Fannounce%7Cudp%3A%2F%2Fdead.example%3A80%2Fannounce",
+		"removeTrackers hash=c&urls=udp%3A%2F%2Fdead.example%3A80%2Fannounce",
+	}
+	if strings.Join(calls, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected calls\n%s", strings.Join(calls, "\n"))
+	}
+}
+
+func TestTorrentManagement_TrackerHealth(t *testing.T) {
+	report, err := api.TorrentManagement.TrackerHealth(context.Background())
+	if err != nil {
+		log.Fatalln(err)
+	}
+	spew.Dump(report)
+}
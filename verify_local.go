@@ -0,0 +1,291 @@
+package qbt_api
+
+import (
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"errors"
+	"fmt"
+	"os"
+	"path/filepath"
+	"runtime"
+	"sort"
+	"sync"
+)
+
+type LocalPieceState int
+
+const LocalPieceOk LocalPieceState = 0
+const LocalPieceCorrupt LocalPieceState = 1
+const LocalPieceMissing LocalPieceState = 2
+
+// LocalPieceSkipped is a piece only made of files not downloaded
+const LocalPieceSkipped LocalPieceState = 3
+
+type VerifyLocalOptions struct {
+	// Workers hashing pieces, default to the number of CPUs
+	Workers int
+	// Progress is called after every piece from the workers, it may be nil
+	Progress func(done, total int)
+}
+
+// FileVerification is the result of the pieces of a single file, pieces shared by two files count for both
+type FileVerification struct {
+	Index int
+	Name  string
+	Path  string
+	// Exists is false when the local file is missing or is not a regular file
+	Exists  bool
+	Pieces  PieceRange
+	Corrupt []PieceRange
+	Missing []PieceRange
+}
+
+func (fv *FileVerification) Ok() bool {
+	return fv.Exists && len(fv.Corrupt) == 0 && len(fv.Missing) == 0
+}
+
+type VerifyLocalResult struct {
+	States  []LocalPieceState
+	Ok      int
+	Corrupt int
+	Missing int
+	Skipped int
+	Files   []FileVerification
+}
+
+type localFile struct {
+	file   *TorrentManagementFile
+	path   string
+	offset int64
+	size   int64
+	// exists is set when the file is a regular file at least as large as expected
+	exists bool
+}
+
+// localReader keep the last file read by a worker open, so at most one file per worker is open
+// and consecutive pieces of a large file reuse it
+type localReader struct {
+	lf *localFile
+	f  *os.File
+}
+
+func (lr *localReader) readAt(lf *localFile, buf []byte, off int64) (err error) {
+	if lr.lf != lf {
+		lr.close()
+		lr.f, err = os.Open(lf.path)
+		if err != nil {
+			return
+		}
+		lr.lf = lf
+	}
+	_, err = lr.f.ReadAt(buf, off)
+	return
+}
+
+func (lr *localReader) close() {
+	if lr.f != nil {
+		lr.f.Close()
+	}
+	lr.lf, lr.f = nil, nil
+}
+
+// VerifyLocalPieces hash the pieces from the files under root and compare them with hashes,
+// files of v2 and hybrid torrents start on a piece boundary and the padding between them is zeros.
+// A file that is missing, too short or can not be read makes its pieces missing.
+// Only SHA-1 piece hashes are supported
+func VerifyLocalPieces(ctx context.Context, root string, files []*TorrentManagementFile, pieceSize int64, hashes []string, opts VerifyLocalOptions) (result *VerifyLocalResult, err error) {
+	if pieceSize <= 0 {
+		return nil, errors.New("unknown piece size")
+	}
+	expected := make([][]byte, len(hashes))
+	for i, it := range hashes {
+		expected[i], err = hex.DecodeString(it)
+		if err != nil || len(expected[i]) != sha1.Size {
+			return nil, fmt.Errorf("piece %d: not a SHA-1 hash %q", i, it)
+		}
+	}
+	if opts.Workers <= 0 {
+		opts.Workers = runtime.NumCPU()
+	}
+
+	offsets := fileOffsets(files, pieceSize)
+	locals := make([]*localFile, len(files))
+	var total int64
+	for i, it := range files {
+		lf := &localFile{file: it, path: filepath.Join(root, filepath.FromSlash(it.Name)), offset: offsets[i], size: it.Size}
+		info, statErr := os.Stat(lf.path)
+		lf.exists = statErr == nil && info.Mode().IsRegular() && info.Size() >= lf.size
+		locals[i] = lf
+		if lf.offset+lf.size > total {
+			total = lf.offset + lf.size
+		}
+	}
+	// pieces find their files by binary search over the files sorted by offset
+	byOffset := make([]*localFile, 0, len(locals))
+	for _, lf := range locals {
+		if lf.size > 0 {
+			byOffset = append(byOffset, lf)
+		}
+	}
+	sort.Slice(byOffset, func(i, j int) bool { return byOffset[i].offset < byOffset[j].offset })
+
+	result = &VerifyLocalResult{States: make([]LocalPieceState, len(hashes))}
+	pieces := make(chan int)
+	wg := sync.WaitGroup{}
+	mu := sync.Mutex{}
+	unreadable := map[*localFile]bool{}
+	done := 0
+	for w := 0; w < opts.Workers; w++ {
+		wg.Add(1)
+		go func() {
+			defer wg.Done()
+			reader := &localReader{}
+			defer reader.close()
+			buf := make([]byte, pieceSize)
+			for piece := range pieces {
+				state, failed := verifyPiece(byOffset, reader, total, pieceSize, piece, expected[piece], buf)
+				mu.Lock()
+				result.States[piece] = state
+				for _, it := range failed {
+					unreadable[it] = true
+				}
+				done++
+				if opts.Progress != nil {
+					opts.Progress(done, len(hashes))
+				}
+				mu.Unlock()
+			}
+		}()
+	}
+feed:
+	for i := range hashes {
+		select {
+		case <-ctx.Done():
+			break feed
+		case pieces <- i:
+		}
+	}
+	close(pieces)
+	wg.Wait()
+	if ctx.Err() != nil {
+		return nil, ctx.Err()
+	}
+
+	for _, it := range result.States {
+		switch it {
+		case LocalPieceOk:
+			result.Ok++
+		case LocalPieceCorrupt:
+			result.Corrupt++
+		case LocalPieceMissing:
+			result.Missing++
+		case LocalPieceSkipped:
+			result.Skipped++
+		}
+	}
+	for _, lf := range locals {
+		fv := FileVerification{Index: lf.file.Index, Name: lf.file.Name, Path: lf.path, Exists: lf.exists && !unreadable[lf]}
+		if len(lf.file.PieceRange) == 2 {
+			fv.Pieces = PieceRange{lf.file.PieceRange[0], lf.file.PieceRange[1]}
+			fv.Corrupt = localPieceRuns(result.States, fv.Pieces, LocalPieceCorrupt)
+			fv.Missing = localPieceRuns(result.States, fv.Pieces, LocalPieceMissing)
+		}
+		result.Files = append(result.Files, fv)
+	}
+	return
+}
+
+// verifyPiece read a piece into buf, zero filling the padding, and compare its hash.
+// failed list the files that could not be opened or read, their pieces are missing
+func verifyPiece(byOffset []*localFile, reader *localReader, total, pieceSize int64, piece int, expected []byte, buf []byte) (state LocalPieceState, failed []*localFile) {
+	start := int64(piece) * pieceSize
+	end := start + pieceSize
+	if end > total {
+		end = total
+	}
+	if end <= start {
+		return LocalPieceMissing, nil
+	}
+	buf = buf[:end-start]
+	for i := range buf {
+		buf[i] = 0
+	}
+
+	wanted := false
+	missing := false
+	first := sort.Search(len(byOffset), func(i int) bool { return byOffset[i].offset+byOffset[i].size > start })
+	for _, lf := range byOffset[first:] {
+		if lf.offset >= end {
+			break
+		}
+		from, to := lf.offset, lf.offset+lf.size
+		if from < start {
+			from = start
+		}
+		if to > end {
+			to = end
+		}
+		if lf.file.Priority != FilePriorityNotDownloaded {
+			wanted = true
+		}
+		if !lf.exists {
+			missing = true
+			continue
+		}
+		// a read error, or a file that shrank since it was checked, leave the piece missing
+		if err := reader.readAt(lf, buf[from-start:to-start], from-lf.offset); err != nil {
+			reader.close()
+			missing = true
+			failed = append(failed, lf)
+		}
+	}
+	switch {
+	case !wanted:
+		return LocalPieceSkipped, failed
+	case missing:
+		return LocalPieceMissing, failed
+	}
+	sum := sha1.Sum(buf)
+	if string(sum[:]) != string(expected) {
+		return LocalPieceCorrupt, nil
+	}
+	return LocalPieceOk, nil
+}
+
+func localPieceRuns(states []LocalPieceState, pr PieceRange, state LocalPieceState) (ranges []PieceRange) {
+	start := -1
+	for i := pr.First; i <= pr.Last+1; i++ {
+		in := i <= pr.Last && i < len(states) && states[i] == state
+		if in && start < 0 {
+			start = i
+		}
+		if !in && start >= 0 {
+			ranges = append(ranges, PieceRange{start, i - 1})
+			start = -1
+		}
+	}
+	return
+}
+
+// VerifyLocal fetch the files, piece size and piece hashes of a torrent and verify its content under root,
+// root is the local path of the save path
+func (tm *TorrentManagement) VerifyLocal(ctx context.Context, hash string, root string, opts VerifyLocalOptions) (result *VerifyLocalResult, err error) {
+	properties, err := tm.Properties(ctx, hash)
+	if err != nil {
+		return
+	}
+	files, err := tm.Files(ctx, hash, nil)
+	if err != nil {
+		return
+	}
+	hashes, err := tm.PieceHashes(ctx, hash)
+	if err != nil {
+		return
+	}
+	result, err = VerifyLocalPieces(ctx, root, files, int64(properties.PieceSize), hashes, opts)
+	if err != nil {
+		return nil, fmt.Errorf("torrent %s: %w", hash, err)
+	}
+	return
+}
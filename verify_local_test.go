@@ -0,0 +1,186 @@
+package qbt_api
+
+import (
+	"bytes"
+	"context"
+	"crypto/sha1"
+	"encoding/hex"
+	"encoding/json"
+	"fmt"
+	"log"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"testing"
+)
+
+func pieceHashes(data []byte, pieceSize int) (hashes []string) {
+	for i := 0; i < len(data); i += pieceSize {
+		end := i + pieceSize
+		if end > len(data) {
+			end = len(data)
+		}
+		sum := sha1.Sum(data[i:end])
+		hashes = append(hashes, hex.EncodeToString(sum[:]))
+	}
+	return
+}
+
+func writeLocalFiles(t *testing.T, root string, files map[string][]byte) {
+	for name, data := range files {
+		p := filepath.Join(root, filepath.FromSlash(name))
+		if err := os.MkdirAll(filepath.Dir(p), 0o755); err != nil {
+			t.Fatal(err)
+		}
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+}
+
+func TestVerifyLocalPieces(t *testing.T) {
+	a, b := bytes.Repeat([]byte("a"), 150), bytes.Repeat([]byte("b"), 130)
+	hashes := pieceHashes(append(append([]byte{}, a...), b...), 100)
+	files := []*TorrentManagementFile{
+		{Index: 0, Name: "t/a", Size: 150, PieceRange: []int{0, 1}, Priority: FilePriorityNormal},
+		{Index: 1, Name: "t/b", Size: 130, PieceRange: []int{1, 2}, Priority: FilePriorityNormal},
+	}
+	root := t.TempDir()
+	writeLocalFiles(t, root, map[string][]byte{"t/a": a, "t/b": b})
+
+	result, err := VerifyLocalPieces(context.Background(), root, files, 100, hashes, VerifyLocalOptions{Workers: 2})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok != 3 || !result.Files[0].Ok() || !result.Files[1].Ok() {
+		t.Fatalf("unexpected result %+v", result)
+	}
+
+	corrupt := append([]byte{}, b...)
+	corrupt[120] = 'x'
+	writeLocalFiles(t, root, map[string][]byte{"t/b": corrupt})
+	os.Remove(filepath.Join(root, "t", "a"))
+	calls := 0
+	result, err = VerifyLocalPieces(context.Background(), root, files, 100, hashes, VerifyLocalOptions{Progress: func(done, total int) { calls++ }})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if fmt.Sprint(result.States) != "[2 2 1]" || result.Missing != 2 || result.Corrupt != 1 || calls != 3 {
+		t.Fatalf("unexpected result %+v", result)
+	}
+	if result.Files[0].Exists || fmt.Sprint(result.Files[0].Missing) != "[{0 1}]" {
+		t.Fatalf("unexpected first file %+v", result.Files[0])
+	}
+	if !result.Files[1].Exists || fmt.Sprint(result.Files[1].Corrupt) != "[{2 2}]" || fmt.Sprint(result.Files[1].Missing) != "[{1 1}]" {
+		t.Fatalf("unexpected second file %+v", result.Files[1])
+	}
+
+	// a missing file not downloaded does not count
+	files[0].Priority = FilePriorityNotDownloaded
+	result, _ = VerifyLocalPieces(context.Background(), root, files, 100, hashes, VerifyLocalOptions{})
+	if fmt.Sprint(result.States) != "[3 2 1]" || result.Skipped != 1 {
+		t.Fatalf("unexpected states %v", result.States)
+	}
+
+	if _, err = VerifyLocalPieces(context.Background(), root, files, 100, []string{"abcd"}, VerifyLocalOptions{}); err == nil {
+		t.Fatal("expected an error for a short hash")
+	}
+}
+
+func TestVerifyLocalPieces_Padded(t *testing.T) {
+	a, b := bytes.Repeat([]byte("a"), 150), bytes.Repeat([]byte("b"), 130)
+	data := append(append(append([]byte{}, a...), make([]byte, 50)...), b...)
+	hashes := pieceHashes(data, 100)
+	files := []*TorrentManagementFile{
+		{Index: 0, Name: "a", Size: 150, PieceRange: []int{0, 1}, Priority: FilePriorityNormal},
+		{Index: 1, Name: "b", Size: 130, PieceRange: []int{2, 3}, Priority: FilePriorityNormal},
+	}
+	root := t.TempDir()
+	writeLocalFiles(t, root, map[string][]byte{"a": a, "b": b})
+	result, err := VerifyLocalPieces(context.Background(), root, files, 100, hashes, VerifyLocalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok != 4 {
+		t.Fatalf("unexpected states %v", result.States)
+	}
+}
+
+func TestVerifyLocalPieces_ManyFiles(t *testing.T) {
+	var data []byte
+	var files []*TorrentManagementFile
+	contents := map[string][]byte{}
+	for i := 0; i < 500; i++ {
+		content := bytes.Repeat([]byte{byte(i)}, 7+i%13)
+		name := fmt.Sprintf("t/%03d", i)
+		first := len(data) / 64
+		data = append(data, content...)
+		files = append(files, &TorrentManagementFile{Index: i, Name: name, Size: int64(len(content)), PieceRange: []int{first, (len(data) - 1) / 64}, Priority: FilePriorityNormal})
+		contents[name] = content
+	}
+	root := t.TempDir()
+	writeLocalFiles(t, root, contents)
+	// a file that can not be read counts as missing instead of failing the run
+	unreadable := filepath.Join(root, "t", "250")
+	os.Chmod(unreadable, 0)
+	_, openErr := os.Open(unreadable)
+
+	result, err := VerifyLocalPieces(context.Background(), root, files, 64, pieceHashes(data, 64), VerifyLocalOptions{Workers: 4})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if openErr == nil {
+		// running as root, every file is readable
+		if result.Ok != len(result.States) {
+			t.Fatalf("unexpected states %v", result.States)
+		}
+		return
+	}
+	if result.Files[250].Exists || len(result.Files[250].Missing) == 0 || result.Ok+result.Missing != len(result.States) {
+		t.Fatalf("unexpected result for an unreadable file %+v", result.Files[250])
+	}
+}
+
+func TestTorrentManagement_VerifyLocalOffline(t *testing.T) {
+	data := bytes.Repeat([]byte("data"), 10)
+	hashes, _ := json.Marshal(pieceHashes(data, 16))
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		switch r.URL.Path {
+		case "/api/v2/torrents/properties":
+			w.Write([]byte(`{"piece_size":16}`))
+		case "/api/v2/torrents/files":
+			w.Write([]byte(`[{"index":0,"name":"d","size":40,"piece_range":[0,2],"priority":1}]`))
+		case "/api/v2/torrents/pieceHashes":
+			w.Write(hashes)
+		}
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+	root := t.TempDir()
+	writeLocalFiles(t, root, map[string][]byte{"d": data})
+	result, err := client.TorrentManagement.VerifyLocal(context.Background(), "hash", root, VerifyLocalOptions{})
+	if err != nil {
+		t.Fatal(err)
+	}
+	if result.Ok != 3 {
+		t.Fatalf("unexpected states %v", result.States)
+	}
+}
+
+func TestTorrentManagement_VerifyLocal(t *testing.T) {
+	infoList, err := api.TorrentManagement.Info(context.Background(), TorrentManagementInfoOptions{Filter: FilterCompleted})
+	if err != nil {
+		log.Fatalln(err)
+	}
+	for _, it := range infoList {
+		result, err := api.TorrentManagement.VerifyLocal(context.Background(), it.Hash, it.SavePath, VerifyLocalOptions{})
+		if err != nil {
+			log.Fatalln(err)
+		}
+		fmt.Println(it.Name, result.Ok, result.Corrupt, result.Missing, result.Skipped)
+	}
+}
@@ -0,0 +1,300 @@
+package qbt_api
+
+import (
+	"context"
+	"errors"
+	"fmt"
+	"io/fs"
+	"net/http"
+	"os"
+	"path"
+	"path/filepath"
+	"sort"
+	"strings"
+	"time"
+)
+
+const DefaultWatchFolderInterval = 5 * time.Second
+
+const DefaultWatchDoneDir = ".done"
+const DefaultWatchFailedDir = ".failed"
+
+// WatchRoute pick the add options of a dropped file, every condition set must hold
+type WatchRoute struct {
+	Name string
+	// Subfolder match files dropped under this folder relative to the watched directory
+	Subfolder string
+	// Pattern match the file name with path.Match syntax
+	Pattern string
+	// Trackers match any announce host of the torrent or magnet, subdomains included
+	Trackers []string
+
+	Category *string
+	Tags     []string
+	SavePath *string
+	Paused   *bool
+}
+
+func (wr *WatchRoute) match(rel string, hosts []string) bool {
+	if wr.Subfolder != "" {
+		dir := filepath.ToSlash(filepath.Dir(rel))
+		sub := strings.Trim(filepath.ToSlash(wr.Subfolder), "/")
+		if dir != sub && !strings.HasPrefix(dir, sub+"/") {
+			return false
+		}
+	}
+	if wr.Pattern != "" {
+		ok, _ := path.Match(wr.Pattern, filepath.Base(rel))
+		if !ok {
+			return false
+		}
+	}
+	if len(wr.Trackers) > 0 {
+		found := false
+		for _, host := range hosts {
+			if hostMatch(host, wr.Trackers) {
+				found = true
+				break
+			}
+		}
+		if !found {
+			return false
+		}
+	}
+	return true
+}
+
+type WatchFolderOptions struct {
+	// Dirs are scanned recursively for .torrent and .magnet files
+	Dirs []string
+	// Routes are tried in order, files matching no route are added with the qBittorrent defaults
+	Routes []WatchRoute
+	// Interval default to DefaultWatchFolderInterval
+	Interval time.Duration
+	// DoneDir and FailedDir receive processed files keeping their relative path,
+	// relative values are inside each watched directory
+	DoneDir   string
+	FailedDir string
+}
+
+// WatchEvent describe a processed file, Moved is empty when the file is left for the next scan
+type WatchEvent struct {
+	Path     string
+	Name     string
+	InfoHash string
+	Hosts    []string
+	Route    string
+	Moved    string
+	Err      error
+}
+
+type watchStamp struct {
+	size    int64
+	modTime time.Time
+}
+
+// WatchFolder add the torrents dropped in local directories. Directories are polled and a file
+// is only picked once its size and modification time did not change between two scans,
+// so files still being written are never read
+type WatchFolder struct {
+	api     *Api
+	opts    WatchFolderOptions
+	pending map[string]watchStamp
+}
+
+func (a *Api) NewWatchFolder(opts WatchFolderOptions) *WatchFolder {
+	if opts.Interval <= 0 {
+		opts.Interval = DefaultWatchFolderInterval
+	}
+	if opts.DoneDir == "" {
+		opts.DoneDir = DefaultWatchDoneDir
+	}
+	if opts.FailedDir == "" {
+		opts.FailedDir = DefaultWatchFailedDir
+	}
+	return &WatchFolder{api: a, opts: opts, pending: map[string]watchStamp{}}
+}
+
+func (w *WatchFolder) destDir(dir, dest string) string {
+	if filepath.IsAbs(dest) {
+		return dest
+	}
+	return filepath.Join(dir, dest)
+}
+
+func isWatchedFile(name string) bool {
+	ext := strings.ToLower(filepath.Ext(name))
+	return ext == ".torrent" || ext == ".magnet"
+}
+
+// Scan process the files that settled since the previous scan
+func (w *WatchFolder) Scan(ctx context.Context) (events []WatchEvent, err error) {
+	seen := map[string]bool{}
+	for _, dir := range w.opts.Dirs {
+		skip := map[string]bool{
+			filepath.Clean(w.destDir(dir, w.opts.DoneDir)):   true,
+			filepath.Clean(w.destDir(dir, w.opts.FailedDir)): true,
+		}
+		var ready []string
+		err = filepath.WalkDir(dir, func(p string, entry fs.DirEntry, err error) error {
+			if err != nil {
+				return err
+			}
+			if entry.IsDir() {
+				if skip[filepath.Clean(p)] {
+					return filepath.SkipDir
+				}
+				return nil
+			}
+			if !entry.Type().IsRegular() || !isWatchedFile(p) {
+				return nil
+			}
+			info, err := entry.Info()
+			if err != nil {
+				return err
+			}
+			seen[p] = true
+			stamp := watchStamp{size: info.Size(), modTime: info.ModTime()}
+			if last, ok := w.pending[p]; ok && last == stamp {
+				ready = append(ready, p)
+			}
+			w.pending[p] = stamp
+			return nil
+		})
+		if err != nil {
+			return
+		}
+		sort.Strings(ready)
+		for _, p := range ready {
+			if err = ctx.Err(); err != nil {
+				return
+			}
+			event := w.process(ctx, dir, p)
+			if event.Moved != "" {
+				delete(w.pending, p)
+			}
+			events = append(events, event)
+		}
+	}
+	for p := range w.pending {
+		if !seen[p] {
+			delete(w.pending, p)
+		}
+	}
+	return
+}
+
+func (w *WatchFolder) process(ctx context.Context, dir, p string) (event WatchEvent) {
+	event.Path = p
+	rel, _ := filepath.Rel(dir, p)
+
+	var opts TorrentManagementAddOptions
+	if strings.ToLower(filepath.Ext(p)) == ".magnet" {
+		data, err := os.ReadFile(p)
+		if err != nil {
+			event.Err = err
+			return
+		}
+		var magnet *Magnet
+		magnet, event.Err = ParseMagnet(string(data))
+		if event.Err != nil {
+			w.move(&event, dir, w.opts.FailedDir, rel)
+			return
+		}
+		event.Name, event.InfoHash, event.Hosts = magnet.Name, magnet.InfoHash, magnet.TrackerHosts()
+		opts.Urls = []string{magnet.URI}
+	} else {
+		var m *Metainfo
+		m, event.Err = ReadMetainfo(p)
+		if event.Err != nil {
+			w.move(&event, dir, w.opts.FailedDir, rel)
+			return
+		}
+		event.Name, event.InfoHash, event.Hosts = m.Name, m.InfoHash, m.TrackerHosts()
+		opts.Torrents = []string{p}
+	}
+
+	for i, route := range w.opts.Routes {
+		if !route.match(rel, event.Hosts) {
+			continue
+		}
+		event.Route = route.Name
+		if event.Route == "" {
+			event.Route = fmt.Sprintf("route %d", i+1)
+		}
+		opts.Category = route.Category
+		opts.Tags = route.Tags
+		opts.SavePath = route.SavePath
+		if route.Paused != nil {
+			opts.Paused = *route.Paused
+		}
+		break
+	}
+
+	event.Err = w.api.TorrentManagement.Add(ctx, opts)
+	switch {
+	case event.Err == nil:
+		w.move(&event, dir, w.opts.DoneDir, rel)
+	case refusedFile(event.Err):
+		// qBittorrent refused the file, retrying would not help
+		w.move(&event, dir, w.opts.FailedDir, rel)
+	}
+	return
+}
+
+// refusedFile tell whether qBittorrent rejected the file itself, such as 415 for an invalid torrent
+// or 409 for a duplicate. An expired session, throttling and server errors leave the file for the next scan
+func refusedFile(err error) bool {
+	var se *StatusError
+	if !errors.As(err, &se) || se.StatusCode < 400 || se.StatusCode >= 500 {
+		return false
+	}
+	switch se.StatusCode {
+	case http.StatusUnauthorized, http.StatusForbidden, http.StatusRequestTimeout, http.StatusTooManyRequests:
+		return false
+	}
+	return true
+}
+
+// move the file to dest keeping its relative path, an existing file of the same name is not overwritten
+func (w *WatchFolder) move(event *WatchEvent, dir, dest, rel string) {
+	target := filepath.Join(w.destDir(dir, dest), rel)
+	err := os.MkdirAll(filepath.Dir(target), 0o755)
+	if err == nil {
+		if _, statErr := os.Stat(target); statErr == nil {
+			ext := filepath.Ext(target)
+			target = fmt.Sprintf("%s.%d%s", strings.TrimSuffix(target, ext), time.Now().UnixNano(), ext)
+		}
+		err = os.Rename(event.Path, target)
+	}
+	if err != nil {
+		event.Err = errors.Join(event.Err, err)
+		return
+	}
+	event.Moved = target
+}
+
+// Run scan every Interval until ctx is done, onEvent may be nil
+func (w *WatchFolder) Run(ctx context.Context, onEvent func(event WatchEvent)) (err error) {
+	ticker := time.NewTicker(w.opts.Interval)
+	defer ticker.Stop()
+
+	for {
+		var events []WatchEvent
+		events, err = w.Scan(ctx)
+		if err != nil {
+			return
+		}
+		if onEvent != nil {
+			for _, it := range events {
+				onEvent(it)
+			}
+		}
+
+		select {
+		case <-ctx.Done():
+			return ctx.Err()
+		case <-ticker.C:
+		}
+	}
+}
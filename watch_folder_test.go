@@ -0,0 +1,141 @@
+package qbt_api
+
+import (
+	"context"
+	"mime"
+	"mime/multipart"
+	"net/http"
+	"net/http/httptest"
+	"os"
+	"path/filepath"
+	"strings"
+	"sync"
+	"testing"
+)
+
+func TestWatchRoute_Match(t *testing.T) {
+	route := WatchRoute{Subfolder: "movies/", Pattern: "*.torrent", Trackers: []string{"private.example"}}
+	cases := map[string]bool{
+		"movies/a.torrent":    true,
+		"movies/hd/a.torrent": true,
+		"moviesx/a.torrent":   false,
+		"movies/a.magnet":     false,
+	}
+	for rel, expected := range cases {
+		if got := route.match(rel, []string{"tracker.private.example"}); got != expected {
+			t.Errorf("match(%s) = %v", rel, got)
+		}
+	}
+	if route.match("movies/a.torrent", []string{"open.example"}) {
+		t.Error("tracker condition ignored")
+	}
+}
+
+func TestWatchFolder_Scan(t *testing.T) {
+	var mu sync.Mutex
+	var added []string
+	srv := httptest.NewServer(http.HandlerFunc(func(w http.ResponseWriter, r *http.Request) {
+		if r.URL.Path != "/api/v2/torrents/add" {
+			http.NotFound(w, r)
+			return
+		}
+		_, params, _ := mime.ParseMediaType(r.Header.Get("Content-Type"))
+		form, err := multipart.NewReader(r.Body, params["boundary"]).ReadForm(1 << 20)
+		if err != nil {
+			t.Error(err)
+			return
+		}
+		mu.Lock()
+		defer mu.Unlock()
+		source := strings.Join(form.Value["urls"], "")
+		for _, it := range form.File["torrents"] {
+			source = it.Filename
+		}
+		switch source {
+		case "refused.torrent":
+			w.WriteHeader(http.StatusUnsupportedMediaType)
+			return
+		case "expired.torrent":
+			w.WriteHeader(http.StatusForbidden)
+			return
+		case "busy.torrent":
+			w.WriteHeader(http.StatusServiceUnavailable)
+			return
+		}
+		added = append(added, source+" category="+strings.Join(form.Value["category"], "")+
+			" tags="+strings.Join(form.Value["tags"], "")+" paused="+strings.Join(form.Value["paused"], ""))
+	}))
+	defer srv.Close()
+	client, err := NewApi(srv.URL)
+	if err != nil {
+		t.Fatal(err)
+	}
+
+	dir := t.TempDir()
+	write := func(rel string, data []byte) {
+		p := filepath.Join(dir, rel)
+		os.MkdirAll(filepath.Dir(p), 0o755)
+		if err := os.WriteFile(p, data, 0o644); err != nil {
+			t.Fatal(err)
+		}
+	}
+	write("private.torrent", testTorrent("https://tracker.private.example/announce"))
+	write("refused.torrent", testTorrent("https://open.example/announce"))
+	write("broken.torrent", []byte("not bencode"))
+	write("expired.torrent", testTorrent("https://open.example/announce"))
+	write("busy.torrent", testTorrent("https://open.example/announce"))
+	write("tv/show.magnet", []byte("magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=show"))
+	write("notes.txt", []byte("ignored"))
+
+	movies, paused := "movies", true
+	watcher := client.NewWatchFolder(WatchFolderOptions{
+		Dirs: []string{dir},
+		Routes: []WatchRoute{
+			{Name: "private", Trackers: []string{"private.example"}, Category: &movies, Paused: &paused},
+			{Name: "tv", Subfolder: "tv", Tags: []string{"tv", "auto"}},
+		},
+	})
+
+	// the first scan only records the files
+	events, err := watcher.Scan(context.Background())
+	if err != nil || len(events) != 0 {
+		t.Fatalf("unexpected first scan %v %v", events, err)
+	}
+	events, err = watcher.Scan(context.Background())
+	if err != nil {
+		t.Fatal(err)
+	}
+	if len(events) != 6 {
+		t.Fatalf("unexpected events %+v", events)
+	}
+
+	expected := []string{
+		"private.torrent category=movies tags= paused=true",
+		"magnet:?xt=urn:btih:0123456789abcdef0123456789abcdef01234567&dn=show category= tags=tv|auto paused=false",
+	}
+	if strings.Join(added, "\n") != strings.Join(expected, "\n") {
+		t.Fatalf("unexpected adds\n%s", strings.Join(added, "\n"))
+	}
+	for rel, exists := range map[string]bool{
+		".done/private.torrent":   true,
+		".done/tv/show.magnet":    true,
+		".failed/refused.torrent": true,
+		".failed/broken.torrent":  true,
+		"notes.txt":               true,
+		"private.torrent":         false,
+		// an expired session or a server error leave the file for the next scan
+		"expired.torrent": true,
+		"busy.torrent":    true,
+	} {
+		_, statErr := os.Stat(filepath.Join(dir, rel))
+		if (statErr == nil) != exists {
+			t.Errorf("%s exists %v", rel, statErr == nil)
+		}
+	}
+
+	// processed folders are not scanned again, files left in place are retried
+	events, err = watcher.Scan(context.Background())
+	if err != nil || len(events) != 2 || events[0].Moved != "" || events[1].Moved != "" {
+		t.Fatalf("unexpected rescan %v %v", events, err)
+	}
+}